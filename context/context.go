@@ -1,6 +1,8 @@
 package context
 
 import (
+	"image"
+
 	"gioui.org/f32"
 	"gioui.org/io/system"
 	"gioui.org/layout"
@@ -43,4 +45,124 @@ type CreateMatrix struct {
 	Pos        f32.Point
 	Rows, Cols int
 	Bounds     f32x.Rectangle
+	Paste      string
+}
+
+type RenameMatrix struct {
+	From, To string
+}
+
+type DefineMatrix struct {
+	Matrix, Name, Expr string
+}
+
+type SetScript struct {
+	Src string
+}
+
+type GoalSeek struct {
+	Target, Value, Input string
+}
+
+type Optimize struct {
+	Objective   string
+	Maximise    bool
+	Variables   string
+	Constraints string
+}
+
+type SaveScenario struct {
+	Name, Cells string
+}
+
+type ApplyScenario struct {
+	Name string
+}
+
+type DataTable struct {
+	Target, Input, Values, Input2, Values2 string
+}
+
+type EditCell struct {
+	Matrix string
+	Cell   image.Point
+	Text   string
+}
+
+type Reveal struct {
+	Bounds f32x.Rectangle
+}
+
+type Paste struct {
+	Matrix string
+	Cell   image.Point
+	Text   string
+}
+
+type ClearCells struct {
+	Matrix string
+	Cells  []image.Point
+}
+
+type ShiftCells struct {
+	Matrix string
+	Rows   bool
+	At     int
+	Count  int
+}
+
+type ResizeMatrix struct {
+	Matrix     string
+	Rows, Cols int
+}
+
+type SetNumericMode struct {
+	Matrix    string
+	Decimal   bool
+	Precision int
+}
+
+type FormatCells struct {
+	Matrix string
+	Cells  []image.Point
+	Format string
+}
+
+type StyleCells struct {
+	Matrix string
+	Area   image.Rectangle
+	Style  string
+}
+
+type LabelHeader struct {
+	Matrix string
+	Row    bool
+	Index  int
+	Label  string
+}
+
+type SortRows struct {
+	Matrix   string
+	From, To int
+	By       string
+}
+
+type FilterRows struct {
+	Matrix    string
+	Condition string
+}
+
+type Find struct {
+	Query, Mode, Tolerance string
+	Step                   int
+}
+
+type ReplaceAll struct {
+	Query, Mode, Tolerance string
+	Replacement            string
+}
+
+type FillCells struct {
+	Matrix   string
+	From, To image.Rectangle
 }
@@ -0,0 +1,202 @@
+package decimal
+
+import (
+	"errors"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DivisionScale is the number of decimal places kept by Div.
+const DivisionScale = 16
+
+var (
+	ErrSyntax       = errors.New("decimal: invalid syntax")
+	ErrDivideByZero = errors.New("decimal: division by zero")
+)
+
+var ten = big.NewInt(10)
+
+// Decimal is an exact decimal number, an arbitrary precision integer
+// coefficient scaled by a power of ten. The zero value is 0.
+type Decimal struct {
+	coef  *big.Int
+	scale int
+}
+
+// New returns the decimal coef * 10^-scale.
+func New(coef int64, scale int) Decimal {
+	return Decimal{coef: big.NewInt(coef), scale: scale}
+}
+
+// Parse parses decimal notation such as "-12.50" or "1.5e3" exactly.
+func Parse(s string) (Decimal, error) {
+	s = strings.TrimSpace(s)
+	exp := 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e, err := strconv.Atoi(s[i+1:])
+		if err != nil {
+			return Decimal{}, ErrSyntax
+		}
+		s, exp = s[:i], e
+	}
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	digits := intPart + fracPart
+	if strings.TrimLeft(digits, "+-") == "" || strings.ContainsAny(strings.TrimLeft(digits, "+-"), "+-") {
+		return Decimal{}, ErrSyntax
+	}
+	coef, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		return Decimal{}, ErrSyntax
+	}
+	d := Decimal{coef: coef, scale: len(fracPart) - exp}
+	if d.scale < 0 {
+		d.coef.Mul(d.coef, pow10(-d.scale))
+		d.scale = 0
+	}
+	return d, nil
+}
+
+// FromFloat returns the shortest decimal which converts back to f, so
+// that FromFloat(0.1) is exactly 0.1.
+func FromFloat(f float64) Decimal {
+	d, err := Parse(strconv.FormatFloat(f, 'f', -1, 64))
+	if err != nil {
+		return Decimal{}
+	}
+	return d
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(ten, big.NewInt(int64(n)), nil)
+}
+
+func (d Decimal) int() *big.Int {
+	if d.coef == nil {
+		return new(big.Int)
+	}
+	return d.coef
+}
+
+// Scale returns the number of digits after the decimal point.
+func (d Decimal) Scale() int { return d.scale }
+
+// rescale returns d's coefficient expressed with scale digits, which
+// must not be less than d's own scale.
+func (d Decimal) rescale(scale int) *big.Int {
+	c := new(big.Int).Set(d.int())
+	if scale > d.scale {
+		c.Mul(c, pow10(scale-d.scale))
+	}
+	return c
+}
+
+func align(a, b Decimal) (*big.Int, *big.Int, int) {
+	scale := a.scale
+	if b.scale > scale {
+		scale = b.scale
+	}
+	return a.rescale(scale), b.rescale(scale), scale
+}
+
+// Add returns d + e.
+func (d Decimal) Add(e Decimal) Decimal {
+	a, b, scale := align(d, e)
+	return Decimal{coef: a.Add(a, b), scale: scale}
+}
+
+// Sub returns d - e.
+func (d Decimal) Sub(e Decimal) Decimal {
+	a, b, scale := align(d, e)
+	return Decimal{coef: a.Sub(a, b), scale: scale}
+}
+
+// Mul returns d * e.
+func (d Decimal) Mul(e Decimal) Decimal {
+	return Decimal{coef: new(big.Int).Mul(d.int(), e.int()), scale: d.scale + e.scale}
+}
+
+// Div returns d / e rounded to DivisionScale decimal places.
+func (d Decimal) Div(e Decimal) (Decimal, error) {
+	if e.int().Sign() == 0 {
+		return Decimal{}, ErrDivideByZero
+	}
+	// scale the dividend so that the integer quotient has one digit more
+	// than required, then round that digit away
+	num := d.rescale(d.scale + e.scale + DivisionScale + 1)
+	q := new(big.Int).Quo(num, e.int())
+	return Decimal{coef: q, scale: d.scale + DivisionScale + 1}.Round(DivisionScale), nil
+}
+
+// Neg returns -d.
+func (d Decimal) Neg() Decimal {
+	return Decimal{coef: new(big.Int).Neg(d.int()), scale: d.scale}
+}
+
+// Round returns d rounded half away from zero to scale decimal places,
+// or to a multiple of 10^-scale if scale is negative.
+func (d Decimal) Round(scale int) Decimal {
+	if scale >= d.scale {
+		return Decimal{coef: d.rescale(scale), scale: scale}
+	}
+	div := pow10(d.scale - scale)
+	q, r := new(big.Int).QuoRem(d.int(), div, new(big.Int))
+	r.Abs(r).Mul(r, big.NewInt(2))
+	if r.Cmp(div) >= 0 {
+		if d.int().Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	if scale < 0 {
+		return Decimal{coef: q.Mul(q, pow10(-scale))}
+	}
+	return Decimal{coef: q, scale: scale}
+}
+
+// Cmp compares d and e, returning -1, 0 or +1.
+func (d Decimal) Cmp(e Decimal) int {
+	a, b, _ := align(d, e)
+	return a.Cmp(b)
+}
+
+// Sign returns -1, 0 or +1 according to the sign of d.
+func (d Decimal) Sign() int { return d.int().Sign() }
+
+// Float64 returns the nearest float64 to d.
+func (d Decimal) Float64() float64 {
+	f, _ := new(big.Rat).SetFrac(d.int(), pow10(d.scale)).Float64()
+	return f
+}
+
+// String returns d in plain decimal notation with exactly Scale digits
+// after the decimal point.
+func (d Decimal) String() string {
+	digits := new(big.Int).Abs(d.int()).String()
+	sign := ""
+	if d.int().Sign() < 0 {
+		sign = "-"
+	}
+	if d.scale == 0 {
+		return sign + digits
+	}
+	if len(digits) <= d.scale {
+		digits = strings.Repeat("0", d.scale-len(digits)+1) + digits
+	}
+	i := len(digits) - d.scale
+	return sign + digits[:i] + "." + digits[i:]
+}
+
+// MarshalText encodes d as its exact decimal notation.
+func (d Decimal) MarshalText() ([]byte, error) { return []byte(d.String()), nil }
+
+// UnmarshalText decodes decimal notation into d.
+func (d *Decimal) UnmarshalText(b []byte) error {
+	v, err := Parse(string(b))
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
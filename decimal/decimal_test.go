@@ -0,0 +1,118 @@
+package decimal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+		err  error
+	}{
+		{s: "12.50", want: "12.50"},
+		{s: " -0.005 ", want: "-0.005"},
+		{s: "+7", want: "7"},
+		{s: "1.5e3", want: "1500"},
+		{s: "25E-4", want: "0.0025"},
+		{s: ".5", want: "0.5"},
+		{s: "123456789012345678901234567890.1", want: "123456789012345678901234567890.1"},
+		{s: "", err: ErrSyntax},
+		{s: "-", err: ErrSyntax},
+		{s: "1.2.3", err: ErrSyntax},
+		{s: "1-2", err: ErrSyntax},
+		{s: "1e", err: ErrSyntax},
+		{s: "x", err: ErrSyntax},
+	}
+	for _, tt := range tests {
+		d, err := Parse(tt.s)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Parse(%q) failed with %v, want %v", tt.s, err, tt.err)
+			continue
+		}
+		if err == nil && d.String() != tt.want {
+			t.Errorf("Parse(%q) = %s, want %s", tt.s, d, tt.want)
+		}
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	tests := []struct {
+		name string
+		got  func() (Decimal, error)
+		want string
+		err  error
+	}{
+		{name: "0.1+0.2", got: func() (Decimal, error) { return FromFloat(0.1).Add(FromFloat(0.2)), nil }, want: "0.3"},
+		{name: "1.10-0.1", got: func() (Decimal, error) { return New(110, 2).Sub(New(1, 1)), nil }, want: "1.00"},
+		{name: "1.5*-0.25", got: func() (Decimal, error) { return New(15, 1).Mul(New(-25, 2)), nil }, want: "-0.375"},
+		{name: "1/4", got: func() (Decimal, error) { return New(1, 0).Div(New(4, 0)) }, want: "0.2500000000000000"},
+		{name: "2/3", got: func() (Decimal, error) { return New(2, 0).Div(New(3, 0)) }, want: "0.6666666666666667"},
+		{name: "-2/3", got: func() (Decimal, error) { return New(-2, 0).Div(New(3, 0)) }, want: "-0.6666666666666667"},
+		{name: "1/0", got: func() (Decimal, error) { return New(1, 0).Div(Decimal{}) }, err: ErrDivideByZero},
+		{name: "neg", got: func() (Decimal, error) { return New(5, 1).Neg(), nil }, want: "-0.5"},
+		{name: "zero value", got: func() (Decimal, error) { return Decimal{}.Add(New(1, 2)), nil }, want: "0.01"},
+	}
+	for _, tt := range tests {
+		d, err := tt.got()
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s failed with %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if err == nil && d.String() != tt.want {
+			t.Errorf("%s = %s, want %s", tt.name, d, tt.want)
+		}
+	}
+}
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		d     Decimal
+		scale int
+		want  string
+	}{
+		{d: New(2345, 3), scale: 2, want: "2.35"},
+		{d: New(-25, 1), scale: 0, want: "-3"},
+		{d: New(2449, 3), scale: 1, want: "2.4"},
+		{d: New(125, 1), scale: -1, want: "10"},
+		{d: New(-1250, 0), scale: -2, want: "-1300"},
+		{d: New(15, 1), scale: 3, want: "1.500"},
+	}
+	for _, tt := range tests {
+		if got := tt.d.Round(tt.scale); got.String() != tt.want {
+			t.Errorf("%s rounded to %d places = %s, want %s", tt.d, tt.scale, got, tt.want)
+		}
+	}
+}
+
+func TestCmp(t *testing.T) {
+	tests := []struct {
+		a, b Decimal
+		want int
+	}{
+		{a: New(10, 1), b: New(1, 0), want: 0},
+		{a: New(-1, 0), b: New(1, 3), want: -1},
+		{a: New(2, 0), b: New(19999, 4), want: 1},
+		{a: Decimal{}, b: New(0, 5), want: 0},
+	}
+	for _, tt := range tests {
+		if got := tt.a.Cmp(tt.b); got != tt.want {
+			t.Errorf("%s compared to %s = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestText(t *testing.T) {
+	for _, s := range []string{"0", "-12.50", "0.001", "1000000000000000000000"} {
+		d, _ := Parse(s)
+		b, err := d.MarshalText()
+		if err != nil {
+			t.Fatalf("MarshalText of %s failed: %v", s, err)
+		}
+		var e Decimal
+		if err := e.UnmarshalText(b); err != nil || e.Cmp(d) != 0 || e.String() != s {
+			t.Errorf("%s round tripped to %s, %v", s, e, err)
+		}
+	}
+}
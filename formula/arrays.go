@@ -0,0 +1,196 @@
+package formula
+
+import (
+	"sort"
+	"strings"
+)
+
+// sortArray implements SORT(array, [index], [order]), the rows of array
+// ordered by their index'th column, 1 by default. order is 1 for
+// ascending, the default, or -1 for descending. Numbers sort before text,
+// text is compared without regard to case and rows which compare equal
+// keep their order.
+func sortArray(args []Value) (Value, error) {
+	if len(args) < 1 || len(args) > 3 {
+		return nil, arityError("SORT", "1 to 3")
+	}
+	arr := asArray(args[0])
+	index, order := 1.0, 1.0
+	if len(args) > 1 {
+		f, err := ToNumber(args[1])
+		if err != nil {
+			return nil, err
+		}
+		index = f
+	}
+	if len(args) > 2 {
+		f, err := ToNumber(args[2])
+		if err != nil {
+			return nil, err
+		}
+		order = f
+	}
+	col := int(index) - 1
+	if col < 0 || col >= arr.Cols || (order != 1 && order != -1) {
+		return nil, ErrInvalidArgument
+	}
+
+	rows := make([]int, arr.Rows)
+	for i := range rows {
+		rows[i] = i
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		c := compareValues(arr.At(rows[i], col), arr.At(rows[j], col))
+		return c*int(order) < 0
+	})
+	return pickRows(arr, rows), nil
+}
+
+// filter implements FILTER(array, include, [empty]), the rows of array
+// for which the matching value of the single column include is non-zero,
+// or the columns when include is a single row matching array's columns.
+// empty is returned when nothing is included, which is otherwise a
+// #VALUE! error.
+func filter(args []Value) (Value, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, arityError("FILTER", "2 or 3")
+	}
+	arr, include := asArray(args[0]), asArray(args[1])
+
+	byRow := include.Cols == 1 && include.Rows == arr.Rows
+	if !byRow && (include.Rows != 1 || include.Cols != arr.Cols) {
+		return nil, newError(CodeValue, "FILTER include must match the rows or columns of the array")
+	}
+	keep := []int{}
+	for i, v := range include.Data {
+		f, err := ToNumber(v)
+		if err != nil {
+			return nil, err
+		}
+		if f != 0 {
+			keep = append(keep, i)
+		}
+	}
+	if len(keep) == 0 {
+		if len(args) == 3 {
+			return args[2], nil
+		}
+		return nil, newError(CodeValue, "FILTER included nothing")
+	}
+	if byRow {
+		return pickRows(arr, keep), nil
+	}
+	res := &Array{Rows: arr.Rows, Cols: len(keep), Data: make([]Value, 0, arr.Rows*len(keep))}
+	for i := 0; i < arr.Rows; i++ {
+		for _, j := range keep {
+			res.Data = append(res.Data, arr.At(i, j))
+		}
+	}
+	return res, nil
+}
+
+// unique implements UNIQUE(array), the distinct rows of array in the
+// order they first appear.
+func unique(args []Value) (Value, error) {
+	if len(args) != 1 {
+		return nil, arityError("UNIQUE", "1")
+	}
+	arr := asArray(args[0])
+	seen := map[string]struct{}{}
+	rows := []int{}
+	for i := 0; i < arr.Rows; i++ {
+		key := make([]string, arr.Cols)
+		for j := range key {
+			key[j] = ToText(arr.At(i, j))
+		}
+		k := strings.Join(key, "\x00")
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+		rows = append(rows, i)
+	}
+	return pickRows(arr, rows), nil
+}
+
+// sequence implements SEQUENCE(rows, [cols], [start], [step]), an array
+// of rows by cols numbers counting from start, 1 by default, in steps of
+// step, 1 by default, along each row in turn.
+func sequence(args []Value) (Value, error) {
+	if len(args) < 1 || len(args) > 4 {
+		return nil, arityError("SEQUENCE", "1 to 4")
+	}
+	params := []float64{0, 1, 1, 1}
+	for i, a := range args {
+		f, err := ToNumber(a)
+		if err != nil {
+			return nil, err
+		}
+		params[i] = f
+	}
+	rows, cols, start, step := int(params[0]), int(params[1]), params[2], params[3]
+	if rows < 1 || cols < 1 || rows*cols > maxSequence {
+		return nil, ErrInvalidArgument
+	}
+	res := &Array{Rows: rows, Cols: cols, Data: make([]Value, rows*cols)}
+	for i := range res.Data {
+		res.Data[i] = start + float64(i)*step
+	}
+	return res, nil
+}
+
+// maxSequence bounds the size of SEQUENCE results.
+const maxSequence = 1 << 20
+
+// asArray returns v as an array, a single value becoming a 1x1 array.
+func asArray(v Value) *Array {
+	if arr, ok := v.(*Array); ok {
+		return arr
+	}
+	return &Array{Rows: 1, Cols: 1, Data: []Value{v}}
+}
+
+func pickRows(arr *Array, rows []int) *Array {
+	res := &Array{Rows: len(rows), Cols: arr.Cols, Data: make([]Value, 0, len(rows)*arr.Cols)}
+	for _, i := range rows {
+		res.Data = append(res.Data, arr.Data[i*arr.Cols:(i+1)*arr.Cols]...)
+	}
+	return res
+}
+
+// compareValues orders values for sorting: numbers before text before
+// anything else, with text compared without regard to case.
+func compareValues(a, b Value) int {
+	ra, rb := sortRank(a), sortRank(b)
+	if ra != rb {
+		return ra - rb
+	}
+	switch ra {
+	case 0:
+		x, _ := ToNumber(a)
+		y, _ := ToNumber(b)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	case 1:
+		return strings.Compare(strings.ToLower(a.(string)), strings.ToLower(b.(string)))
+	}
+	return 0
+}
+
+func sortRank(v Value) int {
+	switch v.(type) {
+	case string:
+		return 1
+	case *Array:
+		return 2
+	}
+	if _, err := ToNumber(v); err == nil {
+		return 0
+	}
+	return 2
+}
@@ -0,0 +1,247 @@
+package formula
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Node is a node of a parsed formula expression.
+type Node interface {
+	node()
+}
+
+// Number is a numeric literal.
+type Number struct{ Value float64 }
+
+// String is a quoted text literal.
+type String struct{ Value string }
+
+// Bool is a TRUE or FALSE literal.
+type Bool struct{ Value bool }
+
+// Ref is a reference to a single cell. An empty Matrix refers to the
+// matrix which owns the formula.
+type Ref struct {
+	Matrix string
+	Cell   CellRef
+}
+
+// Range is a reference to a rectangular block of cells.
+type Range struct {
+	Matrix   string
+	From, To CellRef
+}
+
+// RefErr is a reference to cells which no longer exist, written #REF!.
+type RefErr struct{}
+
+// Name is a bare identifier which is neither a function call nor a cell
+// reference.
+type Name struct{ Name string }
+
+// Label is a reference to the row or column of a matrix which has been
+// labelled Name, written matrix1!Name. Within a cell's formula a bare
+// Name refers to the labels of the cell's own matrix.
+type Label struct {
+	Matrix string
+	Name   string
+}
+
+// Unary is a prefix operator applied to X.
+type Unary struct {
+	Op string
+	X  Node
+}
+
+// Binary is an infix operator applied to X and Y.
+type Binary struct {
+	Op   string
+	X, Y Node
+}
+
+// Transpose is the postfix transpose operator applied to X.
+type Transpose struct{ X Node }
+
+// Call is a function call.
+type Call struct {
+	Fn   string
+	Args []Node
+}
+
+func (Number) node()    {}
+func (String) node()    {}
+func (Bool) node()      {}
+func (Ref) node()       {}
+func (Range) node()     {}
+func (RefErr) node()    {}
+func (Name) node()      {}
+func (Label) node()     {}
+func (Unary) node()     {}
+func (Binary) node()    {}
+func (Transpose) node() {}
+func (Call) node()      {}
+
+// Rewrite returns a copy of n with fn applied to every node, children
+// first. fn returns the node to use in place of the one it was given.
+func Rewrite(n Node, fn func(Node) Node) Node {
+	switch n := n.(type) {
+	case Unary:
+		n.X = Rewrite(n.X, fn)
+		return fn(n)
+	case Binary:
+		n.X = Rewrite(n.X, fn)
+		n.Y = Rewrite(n.Y, fn)
+		return fn(n)
+	case Transpose:
+		n.X = Rewrite(n.X, fn)
+		return fn(n)
+	case Call:
+		args := make([]Node, len(n.Args))
+		for i, a := range n.Args {
+			args[i] = Rewrite(a, fn)
+		}
+		n.Args = args
+		return fn(n)
+	}
+	return fn(n)
+}
+
+// RenameMatrix returns n with every reference to the matrix from replaced
+// with a reference to the matrix to.
+func RenameMatrix(n Node, from, to string) Node {
+	return Rewrite(n, func(n Node) Node {
+		switch n := n.(type) {
+		case Name:
+			if n.Name == from {
+				n.Name = to
+			}
+			return n
+		case Ref:
+			if n.Matrix == from {
+				n.Matrix = to
+			}
+			return n
+		case Range:
+			if n.Matrix == from {
+				n.Matrix = to
+			}
+			return n
+		case Label:
+			if n.Matrix == from {
+				n.Matrix = to
+			}
+			return n
+		}
+		return n
+	})
+}
+
+// ResolveLabels returns n with its labels, and the bare names within it,
+// replaced by the references resolve returns for them. An empty matrix
+// refers to the matrix which owns the formula. Labels which resolve to
+// nothing are left as they are.
+func ResolveLabels(n Node, resolve func(matrix, name string) (Node, bool)) Node {
+	return Rewrite(n, func(n Node) Node {
+		switch l := n.(type) {
+		case Name:
+			if ref, ok := resolve("", l.Name); ok {
+				return ref
+			}
+		case Label:
+			if ref, ok := resolve(l.Matrix, l.Name); ok {
+				return ref
+			}
+		}
+		return n
+	})
+}
+
+// Format returns the source text of n, adding only the parentheses which
+// are required to preserve its meaning.
+func Format(n Node) string {
+	var sb strings.Builder
+	format(&sb, n)
+	return sb.String()
+}
+
+func format(sb *strings.Builder, n Node) {
+	switch n := n.(type) {
+	case Number:
+		sb.WriteString(strconv.FormatFloat(n.Value, 'g', -1, 64))
+	case String:
+		sb.WriteByte('"')
+		sb.WriteString(strings.ReplaceAll(n.Value, `"`, `""`))
+		sb.WriteByte('"')
+	case Bool:
+		if n.Value {
+			sb.WriteString("TRUE")
+		} else {
+			sb.WriteString("FALSE")
+		}
+	case Ref:
+		if n.Matrix != "" {
+			sb.WriteString(n.Matrix)
+			sb.WriteByte('!')
+		}
+		sb.WriteString(n.Cell.String())
+	case Range:
+		if n.Matrix != "" {
+			sb.WriteString(n.Matrix)
+			sb.WriteByte('!')
+		}
+		sb.WriteString(n.From.String())
+		sb.WriteByte(':')
+		sb.WriteString(n.To.String())
+	case RefErr:
+		sb.WriteString(CodeRef)
+	case Name:
+		sb.WriteString(n.Name)
+	case Label:
+		sb.WriteString(n.Matrix)
+		sb.WriteByte('!')
+		sb.WriteString(n.Name)
+	case Unary:
+		sb.WriteString(n.Op)
+		formatOperand(sb, n.X, unaryPrec, false)
+	case Binary:
+		prec := binaryPrec[n.Op]
+		rightAssoc := n.Op == "^"
+		formatOperand(sb, n.X, prec, rightAssoc)
+		sb.WriteString(n.Op)
+		formatOperand(sb, n.Y, prec, !rightAssoc)
+	case Transpose:
+		formatOperand(sb, n.X, maxPrec, false)
+		sb.WriteByte('\'')
+	case Call:
+		sb.WriteString(n.Fn)
+		sb.WriteByte('(')
+		for i, a := range n.Args {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			format(sb, a)
+		}
+		sb.WriteByte(')')
+	}
+}
+
+func formatOperand(sb *strings.Builder, n Node, prec int, strict bool) {
+	p := precOf(n)
+	if p < prec || (strict && p == prec) {
+		sb.WriteByte('(')
+		format(sb, n)
+		sb.WriteByte(')')
+		return
+	}
+	format(sb, n)
+}
+
+func precOf(n Node) int {
+	switch n := n.(type) {
+	case Binary:
+		return binaryPrec[n.Op]
+	case Unary:
+		return unaryPrec
+	}
+	return maxPrec
+}
@@ -0,0 +1,132 @@
+package formula
+
+import (
+	"math"
+
+	"github.com/tauraamui/nebula/decimal"
+)
+
+func isDecimal(v Value) bool {
+	_, ok := v.(decimal.Decimal)
+	return ok
+}
+
+// ToDecimal converts v to an exact decimal. Numbers are converted through
+// their shortest representation, so that 0.1 becomes exactly 0.1.
+func ToDecimal(v Value) (decimal.Decimal, error) {
+	switch v := v.(type) {
+	case decimal.Decimal:
+		return v, nil
+	case string:
+		d, err := decimal.Parse(v)
+		if err != nil {
+			return decimal.Decimal{}, ErrNotNumber
+		}
+		return d, nil
+	case *Array:
+		if v.Rows == 1 && v.Cols == 1 {
+			return ToDecimal(v.Data[0])
+		}
+	}
+	f, err := ToNumber(v)
+	if err != nil {
+		return decimal.Decimal{}, err
+	}
+	return decimal.FromFloat(f), nil
+}
+
+// decimalBinary applies op exactly where either operand is a decimal.
+// Only raising to a fractional or negative power leaves exact arithmetic,
+// yielding a float64.
+func decimalBinary(op string, x, y Value) (Value, error) {
+	a, err := ToDecimal(x)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ToDecimal(y)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case "+":
+		return a.Add(b), nil
+	case "-":
+		return a.Sub(b), nil
+	case "*":
+		return a.Mul(b), nil
+	case "/":
+		q, err := a.Div(b)
+		if err != nil {
+			return nil, ErrDivideByZero
+		}
+		return q, nil
+	case "^":
+		n := b.Float64()
+		if n != math.Trunc(n) || n < 0 || n > 1024 {
+			return evalBinary(Binary{Op: op, X: Number{Value: a.Float64()}, Y: Number{Value: n}}, nil)
+		}
+		r := decimal.New(1, 0)
+		for i := 0; i < int(n); i++ {
+			r = r.Mul(a)
+		}
+		return r, nil
+	}
+
+	c := a.Cmp(b)
+	switch op {
+	case "=":
+		return c == 0, nil
+	case "<>":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case ">":
+		return c > 0, nil
+	case "<=":
+		return c <= 0, nil
+	}
+	return c >= 0, nil
+}
+
+// hasDecimal reports whether any of args, or any value within an array
+// argument, is a decimal.
+func hasDecimal(args []Value) bool {
+	for _, a := range args {
+		if arr, ok := a.(*Array); ok {
+			for _, v := range arr.Data {
+				if isDecimal(v) {
+					return true
+				}
+			}
+			continue
+		}
+		if isDecimal(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// decimalSum totals args exactly, following the same rules as SUM.
+func decimalSum(args []Value) (Value, error) {
+	var total decimal.Decimal
+	for _, a := range args {
+		if arr, ok := a.(*Array); ok {
+			for _, v := range arr.Data {
+				if d, ok := v.(decimal.Decimal); ok {
+					total = total.Add(d)
+				} else if f, ok := number(v); ok {
+					total = total.Add(decimal.FromFloat(f))
+				}
+			}
+			continue
+		}
+		d, err := ToDecimal(a)
+		if err != nil {
+			return nil, err
+		}
+		total = total.Add(d)
+	}
+	return total, nil
+}
@@ -0,0 +1,72 @@
+package formula
+
+import (
+	"errors"
+	"fmt"
+
+	nmat "github.com/tauraamui/nebula/mat"
+)
+
+// Codes of the error values a formula can produce.
+const (
+	CodeDivideByZero = "#DIV/0!"
+	CodeRef          = "#REF!"
+	CodeValue        = "#VALUE!"
+	CodeCycle        = "#CYCLE!"
+	CodeShape        = "#SHAPE!"
+	CodeName         = "#NAME?"
+	CodeNum          = "#NUM!"
+	CodeSpill        = "#SPILL!"
+)
+
+// Error is an error value such as #DIV/0!. Evaluating a formula which
+// reads an error value yields that same error, so errors propagate to
+// every formula downstream of their cause.
+type Error struct {
+	Code  string
+	Cause error
+}
+
+func (e Error) Error() string {
+	if e.Cause == nil {
+		return e.Code
+	}
+	return e.Code + " " + e.Cause.Error()
+}
+
+func (e Error) Unwrap() error { return e.Cause }
+
+func newError(code, format string, args ...any) Error {
+	return Error{Code: code, Cause: fmt.Errorf(format, args...)}
+}
+
+// RefError returns a #REF! error describing an invalid reference.
+func RefError(format string, args ...any) Error {
+	return newError(CodeRef, format, args...)
+}
+
+var (
+	ErrDivideByZero    = newError(CodeDivideByZero, "division by zero")
+	ErrNotNumber       = newError(CodeValue, "value is not a number")
+	ErrInvalidArgument = newError(CodeNum, "invalid argument")
+	ErrCycle           = newError(CodeCycle, "circular reference")
+	ErrSpill           = newError(CodeSpill, "result would overwrite non-empty cells")
+)
+
+// AsError returns err as an error value. Matrix dimension errors become
+// #SHAPE!, a singular matrix becomes #NUM! and any other error without a
+// code of its own becomes #VALUE!.
+func AsError(err error) Error {
+	var e Error
+	if errors.As(err, &e) {
+		return e
+	}
+	var me nmat.Error
+	if errors.As(err, &me) {
+		if me == nmat.ErrSingular {
+			return Error{Code: CodeNum, Cause: err}
+		}
+		return Error{Code: CodeShape, Cause: err}
+	}
+	return Error{Code: CodeValue, Cause: err}
+}
@@ -0,0 +1,362 @@
+package formula
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/tauraamui/nebula/decimal"
+)
+
+// Value is the result of evaluating a formula. It is one of float64,
+// decimal.Decimal, string, bool, Quantity or *Array.
+type Value any
+
+// Array is a rectangular block of values in row-major order, such as the
+// cells of a range.
+type Array struct {
+	Rows, Cols int
+	Data       []Value
+}
+
+// At returns the value at row i, column j.
+func (a *Array) At(i, j int) Value { return a.Data[i*a.Cols+j] }
+
+// Env resolves the cell references made by a formula.
+type Env interface {
+	// Cell returns the value of the cell at row, col in the named matrix.
+	// An empty matrix name refers to the matrix which owns the formula.
+	Cell(matrix string, row, col int) (Value, error)
+}
+
+// FuncEnv is an Env which also provides functions beyond the built-in
+// ones, such as those defined by a document's script. Built-in functions
+// take precedence.
+type FuncEnv interface {
+	Env
+	Func(name string) (Func, bool)
+}
+
+// Canceller is an Env or MatrixEnv whose evaluation can be abandoned
+// part way through. Evaluation stops with the error Err returns once it
+// returns one, checking between function calls and rows of ranges.
+type Canceller interface {
+	Err() error
+}
+
+func cancelled(env any) error {
+	if c, ok := env.(Canceller); ok {
+		return c.Err()
+	}
+	return nil
+}
+
+// Eval evaluates n, resolving references through env.
+func Eval(n Node, env Env) (Value, error) {
+	switch n := n.(type) {
+	case Number:
+		return n.Value, nil
+	case String:
+		return n.Value, nil
+	case Bool:
+		return n.Value, nil
+	case Ref:
+		return env.Cell(n.Matrix, n.Cell.Row, n.Cell.Col)
+	case Range:
+		return evalRange(n, env)
+	case RefErr:
+		return nil, RefError("reference to deleted cells")
+	case Name:
+		return nil, newError(CodeName, "unknown name %q", n.Name)
+	case Label:
+		return nil, newError(CodeName, "unknown label %s!%s", n.Matrix, n.Name)
+	case Unary:
+		x, err := Eval(n.X, env)
+		if err != nil {
+			return nil, err
+		}
+		if q, ok := x.(Quantity); ok {
+			if n.Op == "-" {
+				q.Value = -q.Value
+			}
+			return q, nil
+		}
+		if d, ok := x.(decimal.Decimal); ok {
+			if n.Op == "-" {
+				return d.Neg(), nil
+			}
+			return d, nil
+		}
+		v, err := ToNumber(x)
+		if err != nil {
+			return nil, err
+		}
+		if n.Op == "-" {
+			return -v, nil
+		}
+		return v, nil
+	case Binary:
+		return evalBinary(n, env)
+	case Transpose:
+		x, err := Eval(n.X, env)
+		if err != nil {
+			return nil, err
+		}
+		arr, ok := x.(*Array)
+		if !ok {
+			return x, nil
+		}
+		t := &Array{Rows: arr.Cols, Cols: arr.Rows, Data: make([]Value, len(arr.Data))}
+		for i := 0; i < arr.Rows; i++ {
+			for j := 0; j < arr.Cols; j++ {
+				t.Data[j*t.Cols+i] = arr.At(i, j)
+			}
+		}
+		return t, nil
+	case Call:
+		if err := cancelled(env); err != nil {
+			return nil, err
+		}
+		if n.Fn == "IF" {
+			return evalIf(n, env)
+		}
+		fn, ok := funcs[n.Fn]
+		if fe, isFuncEnv := env.(FuncEnv); !ok && isFuncEnv {
+			fn, ok = fe.Func(n.Fn)
+		}
+		if !ok {
+			return nil, newError(CodeName, "unknown function %s", n.Fn)
+		}
+		args := make([]Value, len(n.Args))
+		for i, a := range n.Args {
+			v, err := Eval(a, env)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = v
+		}
+		if _, ok := unitFuncs[n.Fn]; ok {
+			converted, unit, err := commonUnit(args)
+			if err != nil {
+				return nil, err
+			}
+			v, err := fn(converted)
+			if f, ok := v.(float64); ok && err == nil && unit != nil {
+				return Quantity{Value: f, Unit: *unit}, nil
+			}
+			return v, err
+		}
+		return fn(args)
+	}
+	return nil, fmt.Errorf("formula: cannot evaluate %T", n)
+}
+
+func evalRange(n Range, env Env) (Value, error) {
+	r0, r1 := n.From.Row, n.To.Row
+	if r1 < r0 {
+		r0, r1 = r1, r0
+	}
+	c0, c1 := n.From.Col, n.To.Col
+	if c1 < c0 {
+		c0, c1 = c1, c0
+	}
+	arr := &Array{Rows: r1 - r0 + 1, Cols: c1 - c0 + 1}
+	arr.Data = make([]Value, 0, arr.Rows*arr.Cols)
+	for i := r0; i <= r1; i++ {
+		if err := cancelled(env); err != nil {
+			return nil, err
+		}
+		for j := c0; j <= c1; j++ {
+			v, err := env.Cell(n.Matrix, i, j)
+			if err != nil {
+				return nil, err
+			}
+			arr.Data = append(arr.Data, v)
+		}
+	}
+	return arr, nil
+}
+
+func evalBinary(n Binary, env Env) (Value, error) {
+	x, err := Eval(n.X, env)
+	if err != nil {
+		return nil, err
+	}
+	y, err := Eval(n.Y, env)
+	if err != nil {
+		return nil, err
+	}
+	return binary(n.Op, x, y)
+}
+
+// binary applies op to x and y. Arrays are operated on element by
+// element, with a single value applying to every element of the other
+// operand.
+func binary(op string, x, y Value) (Value, error) {
+	xa, xok := x.(*Array)
+	ya, yok := y.(*Array)
+	if (xok && len(xa.Data) > 1) || (yok && len(ya.Data) > 1) {
+		return broadcast(op, asArray(x), asArray(y))
+	}
+
+	if op == "&" {
+		return ToText(x) + ToText(y), nil
+	}
+	_, xq := x.(Quantity)
+	_, yq := y.(Quantity)
+	if xq || yq {
+		return quantityBinary(op, x, y)
+	}
+	if isDecimal(x) || isDecimal(y) {
+		return decimalBinary(op, x, y)
+	}
+	if _, ok := comparisons[op]; ok {
+		return compare(op, x, y)
+	}
+
+	a, err := ToNumber(x)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ToNumber(y)
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/":
+		if b == 0 {
+			return nil, ErrDivideByZero
+		}
+		return a / b, nil
+	case "^":
+		v := math.Pow(a, b)
+		if math.IsNaN(v) {
+			return nil, ErrInvalidArgument
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("formula: unknown operator %s", op)
+}
+
+func broadcast(op string, x, y *Array) (Value, error) {
+	rows, cols := x.Rows, x.Cols
+	if len(x.Data) == 1 {
+		rows, cols = y.Rows, y.Cols
+	} else if len(y.Data) > 1 && (y.Rows != rows || y.Cols != cols) {
+		return nil, newError(CodeValue, "arrays of %dx%d and %dx%d cannot be combined with %s", x.Rows, x.Cols, y.Rows, y.Cols, op)
+	}
+	res := &Array{Rows: rows, Cols: cols, Data: make([]Value, rows*cols)}
+	for i := range res.Data {
+		a, b := x.Data[0], y.Data[0]
+		if len(x.Data) > 1 {
+			a = x.Data[i]
+		}
+		if len(y.Data) > 1 {
+			b = y.Data[i]
+		}
+		v, err := binary(op, a, b)
+		if err != nil {
+			return nil, err
+		}
+		res.Data[i] = v
+	}
+	return res, nil
+}
+
+func compare(op string, x, y Value) (Value, error) {
+	var c int
+	xs, xok := x.(string)
+	ys, yok := y.(string)
+	if xok && yok {
+		c = strings.Compare(strings.ToLower(xs), strings.ToLower(ys))
+	} else {
+		a, err := ToNumber(x)
+		if err != nil {
+			return nil, err
+		}
+		b, err := ToNumber(y)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case a < b:
+			c = -1
+		case a > b:
+			c = 1
+		}
+	}
+	switch op {
+	case "=":
+		return c == 0, nil
+	case "<>":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case ">":
+		return c > 0, nil
+	case "<=":
+		return c <= 0, nil
+	}
+	return c >= 0, nil
+}
+
+// ToNumber converts v to a number. Text is parsed, booleans become 1 or 0,
+// quantities lose their unit and a single cell array yields its only
+// value.
+func ToNumber(v Value) (float64, error) {
+	switch v := v.(type) {
+	case float64:
+		return v, nil
+	case Quantity:
+		return v.Value, nil
+	case decimal.Decimal:
+		return v.Float64(), nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, ErrNotNumber
+		}
+		return f, nil
+	case *Array:
+		if v.Rows == 1 && v.Cols == 1 {
+			return ToNumber(v.Data[0])
+		}
+	}
+	return 0, ErrNotNumber
+}
+
+// ToText converts v to its textual representation.
+func ToText(v Value) string {
+	switch v := v.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	case Quantity:
+		return v.String()
+	case decimal.Decimal:
+		return v.String()
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case *Array:
+		if len(v.Data) > 0 {
+			return ToText(v.Data[0])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,366 @@
+package formula
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/tauraamui/nebula/decimal"
+	"gonum.org/v1/gonum/stat"
+)
+
+// Func is a built-in function callable from a formula. Arguments are
+// evaluated before the function is called.
+type Func func(args []Value) (Value, error)
+
+var funcs = map[string]Func{
+	"SUM":        sum,
+	"AVERAGE":    average,
+	"MIN":        minimum,
+	"MAX":        maximum,
+	"COUNT":      count,
+	"ROUND":      round,
+	"ABS":        abs,
+	"SQRT":       sqrt,
+	"POWER":      power,
+	"MEDIAN":     median,
+	"STDEV":      stdev,
+	"VAR":        variance,
+	"CORREL":     correl,
+	"PERCENTILE": percentile,
+	"SORT":       sortArray,
+	"FILTER":     filter,
+	"UNIQUE":     unique,
+	"SEQUENCE":   sequence,
+}
+
+// Builtin reports whether name is a built-in function.
+func Builtin(name string) bool {
+	_, ok := funcs[name]
+	return ok || name == "IF"
+}
+
+// evalIf implements IF(condition, then, [else]). condition is converted
+// with ToNumber and is true when non-zero. Only the chosen branch is
+// evaluated, which is why Eval handles IF itself rather than looking it
+// up in funcs. When else is omitted and condition is false the result
+// is FALSE.
+func evalIf(n Call, env Env) (Value, error) {
+	if len(n.Args) < 2 || len(n.Args) > 3 {
+		return nil, arityError("IF", "2 or 3")
+	}
+	cond, err := Eval(n.Args[0], env)
+	if err != nil {
+		return nil, err
+	}
+	c, err := ToNumber(cond)
+	if err != nil {
+		return nil, err
+	}
+	if c != 0 {
+		return Eval(n.Args[1], env)
+	}
+	if len(n.Args) == 3 {
+		return Eval(n.Args[2], env)
+	}
+	return false, nil
+}
+
+func arityError(fn, want string) error {
+	return newError(CodeValue, "%s expects %s arguments", fn, want)
+}
+
+// numbers flattens args into the numbers they contain. Numbers and
+// quantities within arrays are included while text and booleans within
+// arrays are skipped, scalar arguments are converted with ToNumber.
+func numbers(args []Value) ([]float64, error) {
+	nums := []float64{}
+	for _, a := range args {
+		if arr, ok := a.(*Array); ok {
+			for _, v := range arr.Data {
+				if f, ok := number(v); ok {
+					nums = append(nums, f)
+				}
+			}
+			continue
+		}
+		f, err := ToNumber(a)
+		if err != nil {
+			return nil, err
+		}
+		nums = append(nums, f)
+	}
+	return nums, nil
+}
+
+// number returns v as a number if it is one: a number, a quantity or a
+// decimal. Unlike ToNumber it does not convert text or booleans.
+func number(v Value) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case Quantity:
+		return v.Value, true
+	case decimal.Decimal:
+		return v.Float64(), true
+	}
+	return 0, false
+}
+
+func scalars(fn string, args []Value, n int) ([]float64, error) {
+	if len(args) != n {
+		return nil, arityError(fn, fmt.Sprint(n))
+	}
+	nums := make([]float64, n)
+	for i, a := range args {
+		f, err := ToNumber(a)
+		if err != nil {
+			return nil, err
+		}
+		nums[i] = f
+	}
+	return nums, nil
+}
+
+// sum implements SUM(values...), the total of every number given. The
+// total is exact if any of the numbers is a decimal.
+func sum(args []Value) (Value, error) {
+	if hasDecimal(args) {
+		return decimalSum(args)
+	}
+	nums, err := numbers(args)
+	if err != nil {
+		return nil, err
+	}
+	var total float64
+	for _, f := range nums {
+		total += f
+	}
+	return total, nil
+}
+
+// average implements AVERAGE(values...), the arithmetic mean of every
+// number given. At least one number is required.
+func average(args []Value) (Value, error) {
+	nums, err := numbers(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(nums) == 0 {
+		return nil, ErrDivideByZero
+	}
+	return stat.Mean(nums, nil), nil
+}
+
+// minimum implements MIN(values...), the smallest number given or 0 if
+// there are none.
+func minimum(args []Value) (Value, error) {
+	return extreme(args, func(a, b float64) bool { return a < b })
+}
+
+// maximum implements MAX(values...), the largest number given or 0 if
+// there are none.
+func maximum(args []Value) (Value, error) {
+	return extreme(args, func(a, b float64) bool { return a > b })
+}
+
+func extreme(args []Value, better func(a, b float64) bool) (Value, error) {
+	nums, err := numbers(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(nums) == 0 {
+		return 0.0, nil
+	}
+	m := nums[0]
+	for _, f := range nums[1:] {
+		if better(f, m) {
+			m = f
+		}
+	}
+	return m, nil
+}
+
+// count implements COUNT(values...), the number of numeric values given.
+// Within arrays only numbers, quantities and decimals are counted, scalar arguments are counted
+// if they can be converted to a number.
+func count(args []Value) (Value, error) {
+	n := 0
+	for _, a := range args {
+		if arr, ok := a.(*Array); ok {
+			for _, v := range arr.Data {
+				if _, ok := number(v); ok {
+					n++
+				}
+			}
+			continue
+		}
+		if _, err := ToNumber(a); err == nil {
+			n++
+		}
+	}
+	return float64(n), nil
+}
+
+// round implements ROUND(number, digits), rounding half away from zero
+// to digits decimal places. Negative digits round to the left of the
+// decimal point. Decimals are rounded exactly.
+func round(args []Value) (Value, error) {
+	nums, err := scalars("ROUND", args, 2)
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := args[0].(decimal.Decimal); ok {
+		return d.Round(int(nums[1])), nil
+	}
+	p := math.Pow(10, math.Trunc(nums[1]))
+	return math.Round(nums[0]*p) / p, nil
+}
+
+// abs implements ABS(number).
+func abs(args []Value) (Value, error) {
+	nums, err := scalars("ABS", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return math.Abs(nums[0]), nil
+}
+
+// sqrt implements SQRT(number), number must not be negative.
+func sqrt(args []Value) (Value, error) {
+	nums, err := scalars("SQRT", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	if nums[0] < 0 {
+		return nil, ErrInvalidArgument
+	}
+	return math.Sqrt(nums[0]), nil
+}
+
+// power implements POWER(base, exponent). A result which is not a real
+// number, such as a fractional power of a negative base, is an error.
+func power(args []Value) (Value, error) {
+	nums, err := scalars("POWER", args, 2)
+	if err != nil {
+		return nil, err
+	}
+	v := math.Pow(nums[0], nums[1])
+	if math.IsNaN(v) {
+		return nil, ErrInvalidArgument
+	}
+	if math.IsInf(v, 0) {
+		return nil, ErrDivideByZero
+	}
+	return v, nil
+}
+
+// median implements MEDIAN(values...), the middle number given, or the
+// mean of the two middle numbers when there is an even count. At least
+// one number is required.
+func median(args []Value) (Value, error) {
+	nums, err := numbers(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(nums) == 0 {
+		return nil, ErrInvalidArgument
+	}
+	sort.Float64s(nums)
+	return interpolate(nums, 0.5), nil
+}
+
+// stdev implements STDEV(values...), the sample standard deviation of the
+// numbers given. At least two numbers are required.
+func stdev(args []Value) (Value, error) {
+	nums, err := numbers(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(nums) < 2 {
+		return nil, ErrDivideByZero
+	}
+	return stat.StdDev(nums, nil), nil
+}
+
+// variance implements VAR(values...), the sample variance of the numbers
+// given. At least two numbers are required.
+func variance(args []Value) (Value, error) {
+	nums, err := numbers(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(nums) < 2 {
+		return nil, ErrDivideByZero
+	}
+	return stat.Variance(nums, nil), nil
+}
+
+// correl implements CORREL(array1, array2), the Pearson correlation
+// coefficient of two arrays of equal size. Pairs where either value is
+// not a number are ignored, at least two pairs are required and neither
+// array may be constant.
+func correl(args []Value) (Value, error) {
+	if len(args) != 2 {
+		return nil, arityError("CORREL", "2")
+	}
+	a, aok := args[0].(*Array)
+	b, bok := args[1].(*Array)
+	if !aok || !bok {
+		return nil, ErrNotNumber
+	}
+	if len(a.Data) != len(b.Data) {
+		return nil, ErrInvalidArgument
+	}
+	var xs, ys []float64
+	for i := range a.Data {
+		x, xok := number(a.Data[i])
+		y, yok := number(b.Data[i])
+		if xok && yok {
+			xs = append(xs, x)
+			ys = append(ys, y)
+		}
+	}
+	if len(xs) < 2 {
+		return nil, ErrDivideByZero
+	}
+	v := stat.Correlation(xs, ys, nil)
+	if math.IsNaN(v) {
+		return nil, ErrDivideByZero
+	}
+	return v, nil
+}
+
+// percentile implements PERCENTILE(array, k), the k-th percentile of the
+// numbers in array where k is between 0 and 1 inclusive. Values between
+// ranks are linearly interpolated.
+func percentile(args []Value) (Value, error) {
+	if len(args) != 2 {
+		return nil, arityError("PERCENTILE", "2")
+	}
+	nums, err := numbers(args[:1])
+	if err != nil {
+		return nil, err
+	}
+	k, err := ToNumber(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if len(nums) == 0 || k < 0 || k > 1 {
+		return nil, ErrInvalidArgument
+	}
+	sort.Float64s(nums)
+	return interpolate(nums, k), nil
+}
+
+// interpolate returns the value at fraction p of the way through the
+// sorted values nums, linearly interpolating between neighbours.
+func interpolate(nums []float64, p float64) float64 {
+	rank := p * float64(len(nums)-1)
+	lo := math.Floor(rank)
+	i := int(lo)
+	if i+1 >= len(nums) {
+		return nums[len(nums)-1]
+	}
+	return nums[i] + (rank-lo)*(nums[i+1]-nums[i])
+}
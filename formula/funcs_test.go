@@ -0,0 +1,129 @@
+package formula
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/tauraamui/nebula/decimal"
+	"github.com/tauraamui/nebula/units"
+)
+
+// arr returns a rows by cols array holding values row by row.
+func arr(rows, cols int, values ...Value) *Array {
+	return &Array{Rows: rows, Cols: cols, Data: values}
+}
+
+func TestFuncs(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   string
+		args []Value
+		want Value
+		code string
+	}{
+		{name: "sum", fn: "SUM", args: []Value{1.0, arr(1, 3, 2.0, "x", 3.0)}, want: 6.0},
+		{name: "sum of nothing", fn: "SUM", want: 0.0},
+		{name: "sum of text", fn: "SUM", args: []Value{"x"}, code: CodeValue},
+		{name: "sum of decimals and quantities", fn: "SUM", args: []Value{arr(1, 4, decimal.New(15, 1), Quantity{Value: 12, Unit: units.Unit{}}, 2.0, "x")}, want: decimal.New(155, 1)},
+		{name: "average", fn: "AVERAGE", args: []Value{arr(1, 4, 1.0, 2.0, 3.0, true)}, want: 2.0},
+		{name: "average of nothing", fn: "AVERAGE", args: []Value{arr(1, 1, "x")}, code: CodeDivideByZero},
+		{name: "min", fn: "MIN", args: []Value{arr(1, 3, 4.0, -2.0, 9.0), 1.0}, want: -2.0},
+		{name: "min of nothing", fn: "MIN", want: 0.0},
+		{name: "max", fn: "MAX", args: []Value{arr(1, 3, 4.0, -2.0, 9.0), 1.0}, want: 9.0},
+		{name: "max of nothing", fn: "MAX", args: []Value{arr(1, 1, "x")}, want: 0.0},
+		{name: "count", fn: "COUNT", args: []Value{arr(1, 4, 1.0, "x", true, 2.0), "3", "y"}, want: 3.0},
+		{name: "count of nothing", fn: "COUNT", want: 0.0},
+		{name: "count of decimals and quantities", fn: "COUNT", args: []Value{arr(1, 3, decimal.New(15, 1), Quantity{Value: 2, Unit: units.Unit{}}, "x")}, want: 2.0},
+		{name: "round", fn: "ROUND", args: []Value{2.345, 2.0}, want: 2.35},
+		{name: "round half away from zero", fn: "ROUND", args: []Value{-2.5, 0.0}, want: -3.0},
+		{name: "round left of the point", fn: "ROUND", args: []Value{1250.0, -2.0}, want: 1300.0},
+		{name: "round decimal left of the point", fn: "ROUND", args: []Value{decimal.New(1250, 0), -2.0}, want: decimal.New(1300, 0)},
+		{name: "round arity", fn: "ROUND", args: []Value{1.0}, code: CodeValue},
+		{name: "abs", fn: "ABS", args: []Value{-3.5}, want: 3.5},
+		{name: "abs arity", fn: "ABS", args: []Value{1.0, 2.0}, code: CodeValue},
+		{name: "sqrt", fn: "SQRT", args: []Value{16.0}, want: 4.0},
+		{name: "sqrt of negative", fn: "SQRT", args: []Value{-1.0}, code: CodeNum},
+		{name: "sqrt arity", fn: "SQRT", code: CodeValue},
+		{name: "power", fn: "POWER", args: []Value{2.0, 10.0}, want: 1024.0},
+		{name: "power not real", fn: "POWER", args: []Value{-8.0, 0.5}, code: CodeNum},
+		{name: "power overflow", fn: "POWER", args: []Value{10.0, 400.0}, code: CodeDivideByZero},
+		{name: "power arity", fn: "POWER", args: []Value{2.0}, code: CodeValue},
+		{name: "median odd", fn: "MEDIAN", args: []Value{arr(1, 3, 3.0, 1.0, 2.0)}, want: 2.0},
+		{name: "median even", fn: "MEDIAN", args: []Value{arr(1, 4, 4.0, 1.0, 3.0, 2.0)}, want: 2.5},
+		{name: "median of nothing", fn: "MEDIAN", code: CodeNum},
+		{name: "stdev", fn: "STDEV", args: []Value{arr(1, 4, 2.0, 4.0, 4.0, 6.0)}, want: math.Sqrt(8.0 / 3)},
+		{name: "stdev of one", fn: "STDEV", args: []Value{1.0}, code: CodeDivideByZero},
+		{name: "var", fn: "VAR", args: []Value{arr(1, 4, 2.0, 4.0, 4.0, 6.0)}, want: 8.0 / 3},
+		{name: "var of one", fn: "VAR", args: []Value{1.0}, code: CodeDivideByZero},
+		{name: "correl", fn: "CORREL", args: []Value{arr(3, 1, 1.0, 2.0, 3.0), arr(3, 1, 2.0, 4.0, 6.0)}, want: 1.0},
+		{name: "correl skips text", fn: "CORREL", args: []Value{arr(3, 1, 1.0, "x", 3.0), arr(3, 1, 3.0, 2.0, 1.0)}, want: -1.0},
+		{name: "correl of decimals", fn: "CORREL", args: []Value{arr(3, 1, decimal.New(1, 0), decimal.New(2, 0), decimal.New(3, 0)), arr(3, 1, 2.0, 4.0, 6.0)}, want: 1.0},
+		{name: "correl of constant", fn: "CORREL", args: []Value{arr(3, 1, 1.0, 1.0, 1.0), arr(3, 1, 1.0, 2.0, 3.0)}, code: CodeDivideByZero},
+		{name: "correl sizes", fn: "CORREL", args: []Value{arr(2, 1, 1.0, 2.0), arr(3, 1, 1.0, 2.0, 3.0)}, code: CodeNum},
+		{name: "correl of scalars", fn: "CORREL", args: []Value{1.0, 2.0}, code: CodeValue},
+		{name: "correl arity", fn: "CORREL", args: []Value{arr(1, 1, 1.0)}, code: CodeValue},
+		{name: "percentile", fn: "PERCENTILE", args: []Value{arr(1, 5, 5.0, 1.0, 4.0, 2.0, 3.0), 0.25}, want: 2.0},
+		{name: "percentile interpolates", fn: "PERCENTILE", args: []Value{arr(1, 2, 1.0, 2.0), 0.5}, want: 1.5},
+		{name: "percentile of 1", fn: "PERCENTILE", args: []Value{arr(1, 3, 1.0, 2.0, 3.0), 1.0}, want: 3.0},
+		{name: "percentile below 0", fn: "PERCENTILE", args: []Value{arr(1, 1, 1.0), -0.1}, code: CodeNum},
+		{name: "percentile above 1", fn: "PERCENTILE", args: []Value{arr(1, 1, 1.0), 1.1}, code: CodeNum},
+		{name: "percentile of nothing", fn: "PERCENTILE", args: []Value{arr(1, 1, "x"), 0.5}, code: CodeNum},
+		{name: "sort", fn: "SORT", args: []Value{arr(3, 1, 3.0, "b", 1.0)}, want: arr(3, 1, 1.0, 3.0, "b")},
+		{name: "sort descending by column", fn: "SORT", args: []Value{arr(2, 2, 1.0, 5.0, 2.0, 7.0), 2.0, -1.0}, want: arr(2, 2, 2.0, 7.0, 1.0, 5.0)},
+		{name: "sort column outside", fn: "SORT", args: []Value{arr(1, 1, 1.0), 2.0}, code: CodeNum},
+		{name: "sort order", fn: "SORT", args: []Value{arr(1, 1, 1.0), 1.0, 0.0}, code: CodeNum},
+		{name: "sort arity", fn: "SORT", code: CodeValue},
+		{name: "filter rows", fn: "FILTER", args: []Value{arr(3, 1, 1.0, 2.0, 3.0), arr(3, 1, true, false, 1.0)}, want: arr(2, 1, 1.0, 3.0)},
+		{name: "filter columns", fn: "FILTER", args: []Value{arr(1, 3, 1.0, 2.0, 3.0), arr(1, 3, 0.0, 1.0, 0.0)}, want: arr(1, 1, 2.0)},
+		{name: "filter nothing", fn: "FILTER", args: []Value{arr(1, 1, 1.0), arr(1, 1, false)}, code: CodeValue},
+		{name: "filter nothing with empty", fn: "FILTER", args: []Value{arr(1, 1, 1.0), arr(1, 1, false), "none"}, want: "none"},
+		{name: "filter shape", fn: "FILTER", args: []Value{arr(2, 1, 1.0, 2.0), arr(3, 1, 1.0, 1.0, 1.0)}, code: CodeValue},
+		{name: "unique", fn: "UNIQUE", args: []Value{arr(4, 1, 1.0, "a", 1.0, "a")}, want: arr(2, 1, 1.0, "a")},
+		{name: "unique arity", fn: "UNIQUE", code: CodeValue},
+		{name: "sequence", fn: "SEQUENCE", args: []Value{2.0, 2.0, 10.0, 5.0}, want: arr(2, 2, 10.0, 15.0, 20.0, 25.0)},
+		{name: "sequence of nothing", fn: "SEQUENCE", args: []Value{0.0}, code: CodeNum},
+		{name: "sequence too big", fn: "SEQUENCE", args: []Value{float64(maxSequence), 2.0}, code: CodeNum},
+		{name: "sequence arity", fn: "SEQUENCE", code: CodeValue},
+	}
+
+	covered := map[string]bool{}
+	for _, tt := range tests {
+		covered[tt.fn] = true
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := funcs[tt.fn](tt.args)
+			if tt.code != "" {
+				if err == nil {
+					t.Fatalf("%s = %v, want %s", tt.fn, got, tt.code)
+				}
+				if code := AsError(err).Code; code != tt.code {
+					t.Fatalf("%s failed with %s, want %s", tt.fn, code, tt.code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%s failed: %v", tt.fn, err)
+			}
+			if want, ok := tt.want.(decimal.Decimal); ok {
+				if d, ok := got.(decimal.Decimal); !ok || d.Cmp(want) != 0 {
+					t.Fatalf("%s = %v, want %v", tt.fn, got, want)
+				}
+				return
+			}
+			if want, ok := tt.want.(float64); ok {
+				if f, ok := got.(float64); !ok || math.Abs(f-want) > 1e-9 {
+					t.Fatalf("%s = %v, want %v", tt.fn, got, want)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("%s = %v, want %v", tt.fn, got, tt.want)
+			}
+		})
+	}
+	for fn := range funcs {
+		if !covered[fn] {
+			t.Errorf("%s is not tested", fn)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package formula
+
+// CellID identifies a cell anywhere on the canvas.
+type CellID struct {
+	Matrix   string
+	Row, Col int
+}
+
+// CellRange is a rectangle of cells read as a whole, from its top left
+// cell to its bottom right cell.
+type CellRange struct {
+	Matrix           string
+	FromRow, FromCol int
+	ToRow, ToCol     int
+}
+
+// Contains reports whether id lies within r.
+func (r CellRange) Contains(id CellID) bool {
+	return id.Matrix == r.Matrix && id.Row >= r.FromRow && id.Row <= r.ToRow && id.Col >= r.FromCol && id.Col <= r.ToCol
+}
+
+// References returns the cells and the ranges of cells read by n. Ranges
+// are kept whole rather than expanded, as they may cover whole columns.
+// Unqualified references are attributed to owner.
+func References(n Node, owner string) ([]CellID, []CellRange) {
+	ids := []CellID{}
+	var ranges []CellRange
+	Rewrite(n, func(n Node) Node {
+		switch n := n.(type) {
+		case Ref:
+			ids = append(ids, CellID{Matrix: qualify(n.Matrix, owner), Row: n.Cell.Row, Col: n.Cell.Col})
+		case Range:
+			r0, r1 := minmax(n.From.Row, n.To.Row)
+			c0, c1 := minmax(n.From.Col, n.To.Col)
+			ranges = append(ranges, CellRange{Matrix: qualify(n.Matrix, owner), FromRow: r0, FromCol: c0, ToRow: r1, ToCol: c1})
+		}
+		return n
+	})
+	return ids, ranges
+}
+
+func qualify(matrix, owner string) string {
+	if matrix == "" {
+		return owner
+	}
+	return matrix
+}
+
+func minmax(a, b int) (int, int) {
+	if b < a {
+		return b, a
+	}
+	return a, b
+}
+
+// Graph tracks which formula cells depend on which other cells, so that
+// a change only recalculates the formulas it can affect. Ranges are
+// tracked by the matrix they cover, and searched for the cells changed.
+type Graph struct {
+	precedents map[CellID][]CellID
+	dependents map[CellID]map[CellID]struct{}
+	ranges     map[CellID][]CellRange
+	readers    map[string]map[CellID]struct{}
+}
+
+func NewGraph() *Graph {
+	return &Graph{
+		precedents: map[CellID][]CellID{},
+		dependents: map[CellID]map[CellID]struct{}{},
+		ranges:     map[CellID][]CellRange{},
+		readers:    map[string]map[CellID]struct{}{},
+	}
+}
+
+// Set records id as a formula cell which reads refs and ranges, replacing
+// any previously recorded references.
+func (g *Graph) Set(id CellID, refs []CellID, ranges []CellRange) {
+	g.Remove(id)
+	if len(ranges) > 0 {
+		g.ranges[id] = ranges
+	}
+	for _, r := range ranges {
+		readers, ok := g.readers[r.Matrix]
+		if !ok {
+			readers = map[CellID]struct{}{}
+			g.readers[r.Matrix] = readers
+		}
+		readers[id] = struct{}{}
+	}
+	unique := make([]CellID, 0, len(refs))
+	seen := map[CellID]struct{}{}
+	for _, ref := range refs {
+		if _, ok := seen[ref]; !ok {
+			seen[ref] = struct{}{}
+			unique = append(unique, ref)
+		}
+	}
+	g.precedents[id] = unique
+	for _, ref := range unique {
+		deps, ok := g.dependents[ref]
+		if !ok {
+			deps = map[CellID]struct{}{}
+			g.dependents[ref] = deps
+		}
+		deps[id] = struct{}{}
+	}
+}
+
+// Remove forgets the formula at id.
+func (g *Graph) Remove(id CellID) {
+	for _, ref := range g.precedents[id] {
+		if deps, ok := g.dependents[ref]; ok {
+			delete(deps, id)
+			if len(deps) == 0 {
+				delete(g.dependents, ref)
+			}
+		}
+	}
+	for _, r := range g.ranges[id] {
+		if readers, ok := g.readers[r.Matrix]; ok {
+			delete(readers, id)
+			if len(readers) == 0 {
+				delete(g.readers, r.Matrix)
+			}
+		}
+	}
+	delete(g.precedents, id)
+	delete(g.ranges, id)
+}
+
+// dependentsOf is the set of Dependents of id.
+func (g *Graph) dependentsOf(id CellID) map[CellID]struct{} {
+	deps := map[CellID]struct{}{}
+	for dep := range g.dependents[id] {
+		deps[dep] = struct{}{}
+	}
+	for reader := range g.readers[id.Matrix] {
+		for _, r := range g.ranges[reader] {
+			if r.Contains(id) {
+				deps[reader] = struct{}{}
+				break
+			}
+		}
+	}
+	return deps
+}
+
+// Formulas returns every formula cell in the graph.
+func (g *Graph) Formulas() []CellID {
+	ids := make([]CellID, 0, len(g.precedents))
+	for id := range g.precedents {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Affected returns the formula cells which need recalculating after the
+// cells in changed have changed, in an order where every formula comes
+// after the formulas it reads. Formulas which cannot be ordered because
+// they lie on, or downstream of, a circular reference are returned in
+// cyclic instead, and should be given the value ErrCycle.
+func (g *Graph) Affected(changed ...CellID) (order, cyclic []CellID) {
+	affected := map[CellID]struct{}{}
+	stack := append([]CellID{}, changed...)
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if _, isFormula := g.precedents[id]; isFormula {
+			if _, seen := affected[id]; seen {
+				continue
+			}
+			affected[id] = struct{}{}
+		}
+		for dep := range g.dependentsOf(id) {
+			if _, seen := affected[dep]; !seen {
+				stack = append(stack, dep)
+			}
+		}
+	}
+
+	indegree := map[CellID]int{}
+	dependents := map[CellID][]CellID{}
+	for id := range affected {
+		indegree[id] += 0
+		for dep := range g.dependentsOf(id) {
+			if _, ok := affected[dep]; ok {
+				dependents[id] = append(dependents[id], dep)
+				indegree[dep]++
+			}
+		}
+	}
+
+	ready := []CellID{}
+	for id, n := range indegree {
+		if n == 0 {
+			ready = append(ready, id)
+		}
+	}
+	for len(ready) > 0 {
+		id := ready[0]
+		ready = ready[1:]
+		order = append(order, id)
+		for _, dep := range dependents[id] {
+			indegree[dep]--
+			if indegree[dep] == 0 {
+				ready = append(ready, dep)
+			}
+		}
+	}
+
+	for id, n := range indegree {
+		if n > 0 {
+			cyclic = append(cyclic, id)
+		}
+	}
+	return order, cyclic
+}
+
+// WholeMatrix returns the ID which stands for the entire contents of a
+// matrix, used to track derived matrices which are read and written as
+// a whole.
+func WholeMatrix(matrix string) CellID {
+	return CellID{Matrix: matrix, Row: -1, Col: -1}
+}
+
+// Dependents returns the formula cells which read id, either directly or
+// through a range.
+func (g *Graph) Dependents(id CellID) []CellID {
+	deps := make([]CellID, 0)
+	for dep := range g.dependentsOf(id) {
+		deps = append(deps, dep)
+	}
+	return deps
+}
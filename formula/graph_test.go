@@ -0,0 +1,93 @@
+package formula
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// graphOf returns a graph of the formulas in cells, keyed by A1 names of
+// cells in matrix M.
+func graphOf(t *testing.T, cells map[string]string) *Graph {
+	g := NewGraph()
+	for cell, src := range cells {
+		n, err := Parse(src)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", src, err)
+		}
+		refs, ranges := References(n, "M")
+		g.Set(id(t, cell), refs, ranges)
+	}
+	return g
+}
+
+func id(t *testing.T, cell string) CellID {
+	n, err := Parse(cell)
+	if err != nil {
+		t.Fatalf("Parse(%q) failed: %v", cell, err)
+	}
+	ref := n.(Ref)
+	return CellID{Matrix: "M", Row: ref.Cell.Row, Col: ref.Cell.Col}
+}
+
+func names(ids []CellID) []string {
+	var s []string
+	for _, id := range ids {
+		s = append(s, CellRef{Row: id.Row, Col: id.Col}.String())
+	}
+	return s
+}
+
+func TestReferencesKeepRanges(t *testing.T) {
+	n, err := Parse("SUM(A1:C1048576, Other!B2:A1) + D4")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	refs, ranges := References(n, "M")
+	if want := []CellID{{Matrix: "M", Row: 3, Col: 3}}; !reflect.DeepEqual(refs, want) {
+		t.Errorf("cells = %v, want %v", refs, want)
+	}
+	want := []CellRange{
+		{Matrix: "M", FromRow: 0, FromCol: 0, ToRow: 1048575, ToCol: 2},
+		{Matrix: "Other", FromRow: 0, FromCol: 0, ToRow: 1, ToCol: 1},
+	}
+	if !reflect.DeepEqual(ranges, want) {
+		t.Errorf("ranges = %v, want %v", ranges, want)
+	}
+}
+
+func TestAffected(t *testing.T) {
+	g := graphOf(t, map[string]string{
+		"B1": "SUM(A1:A1048576)",
+		"C1": "B1 * 2",
+		"D1": "SUM(B1:C1)",
+		"E1": "SUM(E2:E5)",
+		"E3": "E1",
+	})
+	tests := []struct {
+		name    string
+		changed string
+		order   []string
+		cyclic  []string
+	}{
+		{name: "within a range", changed: "A500000", order: []string{"B1", "C1", "D1"}},
+		{name: "through a range", changed: "C1", order: []string{"C1", "D1"}},
+		{name: "outside every range", changed: "A1048577"},
+		{name: "cycle through a range", changed: "E4", cyclic: []string{"E1", "E3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, cyclic := g.Affected(id(t, tt.changed))
+			got := names(cyclic)
+			sort.Strings(got)
+			if !reflect.DeepEqual(names(order), tt.order) || !reflect.DeepEqual(got, tt.cyclic) {
+				t.Fatalf("Affected(%s) = %v, %v, want %v, %v", tt.changed, names(order), got, tt.order, tt.cyclic)
+			}
+		})
+	}
+
+	g.Remove(id(t, "B1"))
+	if order, _ := g.Affected(id(t, "A1")); len(order) != 0 {
+		t.Fatalf("Affected(A1) = %v after removing B1, want nothing", names(order))
+	}
+}
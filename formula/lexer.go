@@ -0,0 +1,116 @@
+package formula
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+	tokColon
+	tokBang
+	tokRefErr
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+var operators = []string{"<>", "<=", ">=", "+", "-", "*", "/", "^", "&", "=", "<", ">", "'"}
+
+func lex(src string) ([]token, error) {
+	toks := []token{}
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isDigit(c) || (c == '.' && i+1 < len(src) && isDigit(src[i+1])):
+			start := i
+			for i < len(src) && (isDigit(src[i]) || src[i] == '.') {
+				i++
+			}
+			if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+				j := i + 1
+				if j < len(src) && (src[j] == '+' || src[j] == '-') {
+					j++
+				}
+				if j < len(src) && isDigit(src[j]) {
+					for i = j; i < len(src) && isDigit(src[i]); i++ {
+					}
+				}
+			}
+			toks = append(toks, token{tokNumber, src[start:i], start})
+		case isLetter(c) || c == '_' || c == '$':
+			start := i
+			for i < len(src) && (isLetter(src[i]) || isDigit(src[i]) || src[i] == '_' || src[i] == '$' || src[i] == '.') {
+				i++
+			}
+			toks = append(toks, token{tokIdent, src[start:i], start})
+		case c == '"':
+			start := i
+			var sb strings.Builder
+			closed := false
+			for i++; i < len(src); i++ {
+				if src[i] == '"' {
+					if i+1 < len(src) && src[i+1] == '"' {
+						sb.WriteByte('"')
+						i++
+						continue
+					}
+					closed = true
+					i++
+					break
+				}
+				sb.WriteByte(src[i])
+			}
+			if !closed {
+				return nil, fmt.Errorf("formula: unterminated string at %d", start)
+			}
+			toks = append(toks, token{tokString, sb.String(), start})
+		case c == '(':
+			toks = append(toks, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			toks = append(toks, token{tokRParen, ")", i})
+			i++
+		case c == ',':
+			toks = append(toks, token{tokComma, ",", i})
+			i++
+		case c == ':':
+			toks = append(toks, token{tokColon, ":", i})
+			i++
+		case c == '!':
+			toks = append(toks, token{tokBang, "!", i})
+			i++
+		case c == '#' && len(src)-i >= len(CodeRef) && strings.EqualFold(src[i:i+len(CodeRef)], CodeRef):
+			toks = append(toks, token{tokRefErr, CodeRef, i})
+			i += len(CodeRef)
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(src[i:], op) {
+					toks = append(toks, token{tokOp, op, i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("formula: unexpected character %q at %d", c, i)
+			}
+		}
+	}
+	return append(toks, token{tokEOF, "", len(src)}), nil
+}
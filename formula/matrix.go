@@ -0,0 +1,239 @@
+package formula
+
+import (
+	"github.com/tauraamui/nebula/decimal"
+	nmat "github.com/tauraamui/nebula/mat"
+	"gonum.org/v1/gonum/mat"
+)
+
+// MatrixEnv resolves the matrices named by a matrix expression.
+type MatrixEnv interface {
+	Matrix(name string) (nmat.Matrix[float64], error)
+}
+
+// Dense adapts a gonum dense matrix to the nmat.Matrix interface.
+type Dense struct{ *mat.Dense }
+
+func (d Dense) T() nmat.Matrix[float64] { return nmat.Transpose[float64]{Matrix: d} }
+
+// MatrixNames returns the names of the matrices read by the matrix
+// expression n.
+func MatrixNames(n Node) []string {
+	names := []string{}
+	Rewrite(n, func(n Node) Node {
+		if n, ok := n.(Name); ok {
+			names = append(names, n.Name)
+		}
+		return n
+	})
+	return names
+}
+
+// EvalMatrix evaluates a whole-matrix expression such as A*B' or
+// INV(A)*b. Operands are named matrices or numbers, supported operators
+// are +, - and * along with the postfix transpose ', and the functions
+// INV and DET. Operands of mismatched dimensions yield nmat.ErrShape.
+// A scalar result is returned as a 1x1 matrix.
+func EvalMatrix(n Node, env MatrixEnv) (nmat.Matrix[float64], error) {
+	v, err := evalMatrix(n, env)
+	if err != nil {
+		return nil, err
+	}
+	switch v := v.(type) {
+	case nmat.Matrix[float64]:
+		return v, nil
+	case float64:
+		return nmat.New(1, 1, []float64{v}), nil
+	}
+	return nil, newError(CodeValue, "%v is not a number or matrix", v)
+}
+
+// matrixOperand returns v, the value of a scalar operation, as a number,
+// failing if it is not one.
+func matrixOperand(v any) (any, error) {
+	switch v := v.(type) {
+	case float64, nmat.Matrix[float64]:
+		return v, nil
+	case decimal.Decimal:
+		return v.Float64(), nil
+	case Quantity:
+		return v.Value, nil
+	}
+	return nil, newError(CodeValue, "%v is not a number or matrix", v)
+}
+
+func evalMatrix(n Node, env MatrixEnv) (any, error) {
+	switch n := n.(type) {
+	case Number:
+		return n.Value, nil
+	case Name:
+		return env.Matrix(n.Name)
+	case Transpose:
+		x, err := evalMatrix(n.X, env)
+		if err != nil {
+			return nil, err
+		}
+		if m, ok := x.(nmat.Matrix[float64]); ok {
+			return m.T(), nil
+		}
+		return x, nil
+	case Unary:
+		x, err := evalMatrix(n.X, env)
+		if err != nil {
+			return nil, err
+		}
+		if n.Op == "-" {
+			return scale(x, -1), nil
+		}
+		return x, nil
+	case Binary:
+		x, err := evalMatrix(n.X, env)
+		if err != nil {
+			return nil, err
+		}
+		y, err := evalMatrix(n.Y, env)
+		if err != nil {
+			return nil, err
+		}
+		return matrixBinary(n.Op, x, y)
+	case Call:
+		return matrixCall(n, env)
+	}
+	return nil, newError(CodeValue, "%s is not valid in a matrix expression", Format(n))
+}
+
+func scale(x any, f float64) any {
+	if s, ok := x.(float64); ok {
+		return s * f
+	}
+	return elementwise(x.(nmat.Matrix[float64]), func(v float64) float64 { return v * f })
+}
+
+func elementwise(m nmat.Matrix[float64], fn func(float64) float64) nmat.Matrix[float64] {
+	r, c := m.Dims()
+	data := make([]float64, 0, r*c)
+	for i := 0; i < r; i++ {
+		for j := 0; j < c; j++ {
+			data = append(data, fn(m.At(i, j)))
+		}
+	}
+	return nmat.New(r, c, data)
+}
+
+func matrixBinary(op string, x, y any) (any, error) {
+	xs, xScalar := x.(float64)
+	ys, yScalar := y.(float64)
+	switch {
+	case xScalar && yScalar:
+		v, err := Eval(Binary{Op: op, X: Number{Value: xs}, Y: Number{Value: ys}}, nil)
+		if err != nil {
+			return nil, err
+		}
+		return matrixOperand(v)
+	case op == "*" && xScalar:
+		return scale(y, xs), nil
+	case op == "*" && yScalar:
+		return scale(x, ys), nil
+	case op == "/" && yScalar:
+		if ys == 0 {
+			return nil, ErrDivideByZero
+		}
+		return scale(x, 1/ys), nil
+	case op == "*":
+		return multiply(x.(nmat.Matrix[float64]), y.(nmat.Matrix[float64]))
+	case op == "+" || op == "-":
+		sign := 1.0
+		if op == "-" {
+			sign = -1
+		}
+		if xScalar {
+			return elementwise(y.(nmat.Matrix[float64]), func(v float64) float64 { return xs + sign*v }), nil
+		}
+		if yScalar {
+			return elementwise(x.(nmat.Matrix[float64]), func(v float64) float64 { return v + sign*ys }), nil
+		}
+		return add(x.(nmat.Matrix[float64]), y.(nmat.Matrix[float64]), sign)
+	}
+	return nil, newError(CodeValue, "operator %s is not valid between matrices", op)
+}
+
+func add(a, b nmat.Matrix[float64], sign float64) (nmat.Matrix[float64], error) {
+	ar, ac := a.Dims()
+	br, bc := b.Dims()
+	if ar != br || ac != bc {
+		return nil, nmat.ErrShape
+	}
+	data := make([]float64, 0, ar*ac)
+	for i := 0; i < ar; i++ {
+		for j := 0; j < ac; j++ {
+			data = append(data, a.At(i, j)+sign*b.At(i, j))
+		}
+	}
+	return nmat.New(ar, ac, data), nil
+}
+
+func multiply(a, b nmat.Matrix[float64]) (nmat.Matrix[float64], error) {
+	ar, ac := a.Dims()
+	br, bc := b.Dims()
+	if ac != br {
+		return nil, nmat.ErrShape
+	}
+	data := make([]float64, ar*bc)
+	for i := 0; i < ar; i++ {
+		for j := 0; j < bc; j++ {
+			var v float64
+			for k := 0; k < ac; k++ {
+				v += a.At(i, k) * b.At(k, j)
+			}
+			data[i*bc+j] = v
+		}
+	}
+	return nmat.New(ar, bc, data), nil
+}
+
+func toDense(m nmat.Matrix[float64]) *mat.Dense {
+	r, c := m.Dims()
+	d := mat.NewDense(r, c, nil)
+	for i := 0; i < r; i++ {
+		for j := 0; j < c; j++ {
+			d.Set(i, j, m.At(i, j))
+		}
+	}
+	return d
+}
+
+func matrixCall(n Call, env MatrixEnv) (any, error) {
+	if err := cancelled(env); err != nil {
+		return nil, err
+	}
+	if len(n.Args) != 1 {
+		return nil, arityError(n.Fn, "1")
+	}
+	x, err := evalMatrix(n.Args[0], env)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := x.(nmat.Matrix[float64])
+	if !ok {
+		m = nmat.New(1, 1, []float64{x.(float64)})
+	}
+	r, c := m.Dims()
+
+	switch n.Fn {
+	case "INV":
+		if r != c {
+			return nil, nmat.ErrSquare
+		}
+		var inv mat.Dense
+		if err := inv.Inverse(toDense(m)); err != nil {
+			return nil, nmat.ErrSingular
+		}
+		return Dense{&inv}, nil
+	case "DET":
+		if r != c {
+			return nil, nmat.ErrSquare
+		}
+		return mat.Det(toDense(m)), nil
+	}
+	return nil, newError(CodeName, "unknown matrix function %s", n.Fn)
+}
@@ -0,0 +1,217 @@
+package formula
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var binaryPrec = map[string]int{
+	"=": 1, "<>": 1, "<": 1, ">": 1, "<=": 1, ">=": 1,
+	"&": 2,
+	"+": 3, "-": 3,
+	"*": 4, "/": 4,
+	"^": 5,
+}
+
+const (
+	unaryPrec = 6
+	maxPrec   = 7
+)
+
+// Parse parses the formula src, which may optionally begin with '='.
+func Parse(src string) (Node, error) {
+	src = strings.TrimPrefix(strings.TrimSpace(src), "=")
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := parser{toks: toks}
+	n, err := p.expr(1)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.unexpected(t)
+	}
+	return n, nil
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) unexpected(t token) error {
+	if t.kind == tokEOF {
+		return fmt.Errorf("formula: unexpected end of formula")
+	}
+	return fmt.Errorf("formula: unexpected %q at %d", t.text, t.pos)
+}
+
+func (p *parser) expect(kind tokenKind) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, p.unexpected(t)
+	}
+	return t, nil
+}
+
+func (p *parser) expr(minPrec int) (Node, error) {
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokOp {
+			return x, nil
+		}
+		prec := binaryPrec[t.text]
+		if prec < minPrec {
+			return x, nil
+		}
+		p.next()
+		next := prec + 1
+		if t.text == "^" {
+			next = prec
+		}
+		y, err := p.expr(next)
+		if err != nil {
+			return nil, err
+		}
+		x = Binary{Op: t.text, X: x, Y: y}
+	}
+}
+
+func (p *parser) unary() (Node, error) {
+	if t := p.peek(); t.kind == tokOp && (t.text == "-" || t.text == "+") {
+		p.next()
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return Unary{Op: t.text, X: x}, nil
+	}
+	x, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t.kind == tokOp && t.text == "'"; t = p.peek() {
+		p.next()
+		x = Transpose{X: x}
+	}
+	return x, nil
+}
+
+func (p *parser) primary() (Node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("formula: invalid number %q at %d", t.text, t.pos)
+		}
+		return Number{Value: v}, nil
+	case tokString:
+		return String{Value: t.text}, nil
+	case tokLParen:
+		x, err := p.expr(1)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokRParen); err != nil {
+			return nil, err
+		}
+		return x, nil
+	case tokIdent:
+		return p.ident(t)
+	case tokRefErr:
+		return RefErr{}, nil
+	}
+	return nil, p.unexpected(t)
+}
+
+func (p *parser) ident(t token) (Node, error) {
+	switch p.peek().kind {
+	case tokLParen:
+		p.next()
+		return p.call(t)
+	case tokBang:
+		p.next()
+		if !ValidName(t.text) {
+			return nil, fmt.Errorf("formula: invalid matrix name %q at %d", t.text, t.pos)
+		}
+		ref, err := p.expect(tokIdent)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := ParseCellRef(ref.text); !ok && ValidName(ref.text) {
+			return Label{Matrix: t.text, Name: ref.text}, nil
+		}
+		return p.reference(t.text, ref)
+	}
+
+	switch strings.ToUpper(t.text) {
+	case "TRUE":
+		return Bool{Value: true}, nil
+	case "FALSE":
+		return Bool{Value: false}, nil
+	}
+	if _, ok := ParseCellRef(t.text); ok {
+		return p.reference("", t)
+	}
+	return Name{Name: t.text}, nil
+}
+
+func (p *parser) reference(matrix string, t token) (Node, error) {
+	from, ok := ParseCellRef(t.text)
+	if !ok {
+		return nil, fmt.Errorf("formula: invalid cell reference %q at %d", t.text, t.pos)
+	}
+	if p.peek().kind != tokColon {
+		return Ref{Matrix: matrix, Cell: from}, nil
+	}
+	p.next()
+	t, err := p.expect(tokIdent)
+	if err != nil {
+		return nil, err
+	}
+	to, ok := ParseCellRef(t.text)
+	if !ok {
+		return nil, fmt.Errorf("formula: invalid cell reference %q at %d", t.text, t.pos)
+	}
+	return Range{Matrix: matrix, From: from, To: to}, nil
+}
+
+func (p *parser) call(fn token) (Node, error) {
+	c := Call{Fn: strings.ToUpper(fn.text)}
+	if p.peek().kind == tokRParen {
+		p.next()
+		return c, nil
+	}
+	for {
+		arg, err := p.expr(1)
+		if err != nil {
+			return nil, err
+		}
+		c.Args = append(c.Args, arg)
+		t := p.next()
+		if t.kind == tokRParen {
+			return c, nil
+		}
+		if t.kind != tokComma {
+			return nil, p.unexpected(t)
+		}
+	}
+}
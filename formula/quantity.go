@@ -0,0 +1,175 @@
+package formula
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/tauraamui/nebula/units"
+)
+
+// CodeUnit is the error code for calculations mixing incompatible units.
+const CodeUnit = "#UNIT!"
+
+// Quantity is a number carrying a unit of measure, such as 12 kg.
+type Quantity struct {
+	Value float64
+	Unit  units.Unit
+}
+
+func (q Quantity) String() string {
+	return strconv.FormatFloat(q.Value, 'f', -1, 64) + " " + q.Unit.String()
+}
+
+func unitError(a, b units.Unit) Error {
+	return newError(CodeUnit, "incompatible units %s and %s", a, b)
+}
+
+// quantityBinary applies the operator op where at least one of x or y is
+// a Quantity. Addition, subtraction and comparison convert y into the
+// unit of x and require compatible units, multiplication and division
+// combine units and produce a result in coherent SI units.
+func quantityBinary(op string, x, y Value) (Value, error) {
+	qx, xok := x.(Quantity)
+	qy, yok := y.(Quantity)
+	if !xok {
+		v, err := ToNumber(x)
+		if err != nil {
+			return nil, err
+		}
+		qx = Quantity{Value: v}
+	}
+	if !yok {
+		v, err := ToNumber(y)
+		if err != nil {
+			return nil, err
+		}
+		qy = Quantity{Value: v}
+	}
+
+	switch op {
+	case "*", "/":
+		if !xok {
+			if op == "/" {
+				return quantityQuotient(qx, qy, xok)
+			}
+			return Quantity{Value: qx.Value * qy.Value, Unit: qy.Unit}, nil
+		}
+		if !yok {
+			if op == "/" && qy.Value == 0 {
+				return nil, ErrDivideByZero
+			}
+			if op == "/" {
+				return Quantity{Value: qx.Value / qy.Value, Unit: qx.Unit}, nil
+			}
+			return Quantity{Value: qx.Value * qy.Value, Unit: qx.Unit}, nil
+		}
+		if op == "/" {
+			return quantityQuotient(qx, qy, true)
+		}
+		u := qx.Unit.Mul(qy.Unit)
+		return simplify(qx.Value*qy.Value*u.Scale, u), nil
+	case "^":
+		if yok {
+			return nil, unitError(qx.Unit, qy.Unit)
+		}
+		n := qy.Value
+		if n != math.Trunc(n) {
+			return nil, newError(CodeUnit, "%s raised to a fractional power", qx.Unit)
+		}
+		return Quantity{Value: math.Pow(qx.Value, n), Unit: qx.Unit.Pow(int(n))}, nil
+	}
+
+	if !xok || !yok {
+		if _, ok := comparisons[op]; ok {
+			return compare(op, qx.Value, qy.Value)
+		}
+		if !xok {
+			return nil, newError(CodeUnit, "cannot combine a plain number with %s", qy.Unit)
+		}
+		return nil, newError(CodeUnit, "cannot combine %s with a plain number", qx.Unit)
+	}
+	vy, err := qy.Unit.Convert(qy.Value, qx.Unit)
+	if err != nil {
+		return nil, unitError(qx.Unit, qy.Unit)
+	}
+	switch op {
+	case "+":
+		return Quantity{Value: qx.Value + vy, Unit: qx.Unit}, nil
+	case "-":
+		return Quantity{Value: qx.Value - vy, Unit: qx.Unit}, nil
+	}
+	return compare(op, qx.Value, vy)
+}
+
+func quantityQuotient(qx, qy Quantity, xok bool) (Value, error) {
+	if qy.Value == 0 {
+		return nil, ErrDivideByZero
+	}
+	u := qx.Unit.Div(qy.Unit)
+	if !xok {
+		u = units.Unit{Scale: 1}.Div(qy.Unit)
+	}
+	return simplify(qx.Value/qy.Value*u.Scale, u), nil
+}
+
+// simplify expresses the SI value v in the coherent SI unit of u, or as
+// a plain number if u is dimensionless.
+func simplify(v float64, u units.Unit) Value {
+	if u.Dimensionless() {
+		return v
+	}
+	return Quantity{Value: v, Unit: u.SI()}
+}
+
+var comparisons = map[string]struct{}{"=": {}, "<>": {}, "<": {}, ">": {}, "<=": {}, ">=": {}}
+
+// unitFuncs are the functions whose result is in the unit of their
+// arguments.
+var unitFuncs = map[string]struct{}{
+	"SUM": {}, "AVERAGE": {}, "MIN": {}, "MAX": {}, "MEDIAN": {}, "ABS": {}, "ROUND": {},
+}
+
+// commonUnit converts every quantity within args to the unit of the first
+// quantity found, returning the converted arguments as plain numbers and
+// that unit. Plain numbers are taken to already be in the common unit.
+func commonUnit(args []Value) ([]Value, *units.Unit, error) {
+	var common *units.Unit
+	convert := func(v Value) (Value, error) {
+		q, ok := v.(Quantity)
+		if !ok {
+			return v, nil
+		}
+		if common == nil {
+			common = &q.Unit
+			return q.Value, nil
+		}
+		f, err := q.Unit.Convert(q.Value, *common)
+		if err != nil {
+			return nil, unitError(*common, q.Unit)
+		}
+		return f, nil
+	}
+
+	out := make([]Value, len(args))
+	for i, a := range args {
+		arr, ok := a.(*Array)
+		if !ok {
+			v, err := convert(a)
+			if err != nil {
+				return nil, nil, err
+			}
+			out[i] = v
+			continue
+		}
+		converted := &Array{Rows: arr.Rows, Cols: arr.Cols, Data: make([]Value, len(arr.Data))}
+		for j, v := range arr.Data {
+			c, err := convert(v)
+			if err != nil {
+				return nil, nil, err
+			}
+			converted.Data[j] = c
+		}
+		out[i] = converted
+	}
+	return out, common, nil
+}
@@ -0,0 +1,112 @@
+package formula
+
+import (
+	"strconv"
+	"strings"
+)
+
+// maxColumnLetters bounds the column part of a reference, so that names
+// such as matrix1 are not mistaken for cell references.
+const maxColumnLetters = 3
+
+// CellRef addresses a single cell within a matrix. Row and Col are zero
+// indexed, whereas the A1 notation used in formulas is one indexed.
+type CellRef struct {
+	Row, Col       int
+	AbsRow, AbsCol bool
+}
+
+// String returns the reference in A1 notation, e.g. B2 or $B$2.
+func (r CellRef) String() string {
+	var sb strings.Builder
+	if r.AbsCol {
+		sb.WriteByte('$')
+	}
+	sb.WriteString(ColumnName(r.Col))
+	if r.AbsRow {
+		sb.WriteByte('$')
+	}
+	sb.WriteString(strconv.Itoa(r.Row + 1))
+	return sb.String()
+}
+
+// ColumnName returns the letter name of the zero indexed column col,
+// A through Z followed by AA, AB and so on.
+func ColumnName(col int) string {
+	name := []byte{}
+	for col >= 0 {
+		name = append([]byte{byte('A' + col%26)}, name...)
+		col = col/26 - 1
+	}
+	return string(name)
+}
+
+// ParseCellRef parses a reference in A1 notation, reporting false if s is
+// not a valid cell reference.
+func ParseCellRef(s string) (CellRef, bool) {
+	var ref CellRef
+	i := 0
+	if i < len(s) && s[i] == '$' {
+		ref.AbsCol = true
+		i++
+	}
+	col := 0
+	start := i
+	for ; i < len(s) && isLetter(s[i]); i++ {
+		col = col*26 + int(upper(s[i])-'A') + 1
+	}
+	if i == start || i-start > maxColumnLetters {
+		return CellRef{}, false
+	}
+	if i < len(s) && s[i] == '$' {
+		ref.AbsRow = true
+		i++
+	}
+	start = i
+	for ; i < len(s) && isDigit(s[i]); i++ {
+	}
+	if i == start || i != len(s) {
+		return CellRef{}, false
+	}
+	row, err := strconv.Atoi(s[start:])
+	if err != nil || row < 1 {
+		return CellRef{}, false
+	}
+	ref.Row, ref.Col = row-1, col-1
+	return ref, true
+}
+
+// ValidName reports whether name can be used to name a matrix. Names must
+// start with a letter or underscore, contain only letters, digits and
+// underscores, and must not be mistakable for a cell reference or a
+// boolean literal.
+func ValidName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !(isLetter(c) || c == '_' || (i > 0 && isDigit(c))) {
+			return false
+		}
+	}
+	if _, ok := ParseCellRef(name); ok {
+		return false
+	}
+	switch strings.ToUpper(name) {
+	case "TRUE", "FALSE":
+		return false
+	}
+	return true
+}
+
+func isLetter(c byte) bool { return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') }
+
+func isDigit(c byte) bool { return '0' <= c && c <= '9' }
+
+func upper(c byte) byte {
+	if 'a' <= c && c <= 'z' {
+		return c - 'a' + 'A'
+	}
+	return c
+}
@@ -0,0 +1,149 @@
+package formula
+
+// Shift describes rows or columns inserted into or deleted from a matrix.
+// A positive Count inserts that many before At, a negative Count deletes
+// -Count starting at At.
+type Shift struct {
+	Matrix string
+	Rows   bool
+	At     int
+	Count  int
+}
+
+// ShiftRefs returns n, the formula of a cell in the matrix owner, with
+// its references to the shifted matrix adjusted so that they still
+// address the same cells. References to deleted cells become #REF!, and
+// ranges partly deleted shrink to the cells which remain.
+func ShiftRefs(n Node, owner string, s Shift) Node {
+	refers := func(matrix string) bool {
+		if matrix == "" {
+			matrix = owner
+		}
+		return matrix == s.Matrix
+	}
+	return Rewrite(n, func(n Node) Node {
+		switch n := n.(type) {
+		case Ref:
+			if !refers(n.Matrix) {
+				return n
+			}
+			i, ok := s.Index(s.axis(n.Cell))
+			if !ok {
+				return RefErr{}
+			}
+			n.Cell = s.set(n.Cell, i)
+			return n
+		case Range:
+			if !refers(n.Matrix) {
+				return n
+			}
+			from, to := s.axis(n.From), s.axis(n.To)
+			lo, hi := from, to
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			lo, hi, ok := s.span(lo, hi)
+			if !ok {
+				return RefErr{}
+			}
+			if from > to {
+				lo, hi = hi, lo
+			}
+			n.From, n.To = s.set(n.From, lo), s.set(n.To, hi)
+			return n
+		}
+		return n
+	})
+}
+
+// axis returns the row or column of ref, whichever s shifts.
+func (s Shift) axis(ref CellRef) int {
+	if s.Rows {
+		return ref.Row
+	}
+	return ref.Col
+}
+
+func (s Shift) set(ref CellRef, i int) CellRef {
+	if s.Rows {
+		ref.Row = i
+	} else {
+		ref.Col = i
+	}
+	return ref
+}
+
+// Index returns where the row or column i ends up, reporting false if it
+// was deleted.
+func (s Shift) Index(i int) (int, bool) {
+	switch {
+	case i < s.At:
+		return i, true
+	case s.Count > 0:
+		return i + s.Count, true
+	case i < s.At-s.Count:
+		return 0, false
+	}
+	return i + s.Count, true
+}
+
+// span returns where the rows or columns lo through hi end up, reporting
+// false if every one of them was deleted.
+func (s Shift) span(lo, hi int) (int, int, bool) {
+	if s.Count > 0 {
+		lo, _ = s.Index(lo)
+		hi, _ = s.Index(hi)
+		return lo, hi, true
+	}
+	end := s.At - s.Count
+	if lo >= s.At && hi < end {
+		return 0, 0, false
+	}
+	if lo >= end {
+		lo += s.Count
+	} else if lo >= s.At {
+		lo = s.At
+	}
+	if hi >= end {
+		hi += s.Count
+	} else if hi >= s.At {
+		hi = s.At - 1
+	}
+	return lo, hi, true
+}
+
+// MoveRefs returns n with its relative references moved by rows and cols,
+// as when the formula is copied to a cell that far away. Absolute rows
+// and columns stay as they are, and references moved before the first
+// row or column become #REF!.
+func MoveRefs(n Node, rows, cols int) Node {
+	move := func(ref CellRef) (CellRef, bool) {
+		if !ref.AbsRow {
+			ref.Row += rows
+		}
+		if !ref.AbsCol {
+			ref.Col += cols
+		}
+		return ref, ref.Row >= 0 && ref.Col >= 0
+	}
+	return Rewrite(n, func(n Node) Node {
+		switch n := n.(type) {
+		case Ref:
+			cell, ok := move(n.Cell)
+			if !ok {
+				return RefErr{}
+			}
+			n.Cell = cell
+			return n
+		case Range:
+			from, fromOK := move(n.From)
+			to, toOK := move(n.To)
+			if !fromOK || !toOK {
+				return RefErr{}
+			}
+			n.From, n.To = from, to
+			return n
+		}
+		return n
+	})
+}
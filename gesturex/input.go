@@ -15,7 +15,8 @@ type InputEvents struct {
 	pid pointer.ID
 	ptr pointer.Cursor
 	pressed,
-	dragging bool
+	dragging,
+	hovering bool
 	pressedButtons pointer.Buttons
 	start          f32.Point
 }
@@ -24,7 +25,7 @@ type InputEvents struct {
 func (d *InputEvents) Add(ops *op.Ops) {
 	d.io = pointer.InputOp{
 		Tag:   d.Tag,
-		Types: pointer.Press | pointer.Drag | pointer.Move | pointer.Release,
+		Types: pointer.Press | pointer.Drag | pointer.Move | pointer.Release | pointer.Enter | pointer.Leave,
 	}
 	d.io.Add(ops)
 }
@@ -65,8 +66,11 @@ func (d *InputEvents) handlePointerEvent(
 
 		d.pressed = true
 		d.start = e.Position
-	case pointer.Move:
+	case pointer.Enter, pointer.Move:
 		d.start = e.Position
+		d.hovering = true
+	case pointer.Leave:
+		d.hovering = false
 	case pointer.Drag:
 		d.dragging = d.pressed
 		if d.dragging {
@@ -103,3 +107,7 @@ func (d *InputEvents) Dragging() bool { return d.dragging }
 
 // Pressed returns whether a pointer is pressing.
 func (d *InputEvents) Pressed() bool { return d.pressed }
+
+// Hovered returns the last known pointer position and whether the pointer
+// is currently over the handler's area.
+func (d *InputEvents) Hovered() (f32.Point, bool) { return d.start, d.hovering }
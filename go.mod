@@ -6,6 +6,7 @@ require (
 	gioui.org v0.3.0
 	github.com/inkeliz/giosvg v0.0.0-20230419135231-464df5851c6a
 	github.com/pkg/profile v1.7.0
+	go.starlark.net v0.0.0-20231121155337-90ade8b19d09
 	gonum.org/v1/gonum v0.14.0
 )
 
@@ -18,7 +19,8 @@ require (
 	golang.org/x/exp v0.0.0-20230817173708-d852ddb80c63 // indirect
 	golang.org/x/exp/shiny v0.0.0-20230425010034-47ecfdc1ba53 // indirect
 	golang.org/x/image v0.11.0 // indirect
-	golang.org/x/net v0.6.0 // indirect
+	golang.org/x/net v0.14.0 // indirect
 	golang.org/x/sys v0.11.0 // indirect
 	golang.org/x/text v0.12.0 // indirect
+	golang.org/x/tools v0.12.1-0.20230815132531-74c255bcf846 // indirect
 )
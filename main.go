@@ -10,6 +10,11 @@ import (
 
 func main() {
 	appx := nebula.New()
+	if len(os.Args) > 1 {
+		if err := appx.Open(os.Args[1]); err != nil {
+			log.Fatal(err)
+		}
+	}
 	go func() {
 		if err := appx.Run(); err != nil {
 			log.Fatal(err)
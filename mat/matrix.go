@@ -23,6 +23,15 @@ type Matrix[T any] interface {
 	T() Matrix[T]
 }
 
+// Mutable is a matrix interface type that allows elements to be altered.
+type Mutable[T any] interface {
+	Matrix[T]
+
+	// Set alters the matrix element at row i, column j to v.
+	// It will panic if i or j are out of bounds for the matrix.
+	Set(i, j int, v T)
+}
+
 // Transpose is a type for performing an implicit matrix transpose. It implements
 // the Matrix interface, returning values from the transpose of the matrix within.
 type Transpose[T any] struct {
@@ -61,7 +70,8 @@ type matrix[T any] struct {
 	capRows, capCols int
 }
 
-// New creates a new matrix with r rows and c columns. If data == nil,
+// New creates a new matrix with r rows and c columns. The returned matrix
+// also implements Mutable. If data == nil,
 // a new slice is allocated for the backing slice. If len(data) == r*c, data is
 // used as the backing slice, and changes to the elements of the returned Dense
 // will be reflected in data. If neither of these is true, NewMatrix will panic.
@@ -98,8 +108,26 @@ func (m *matrix[T]) Dims() (r, c int) { return m.Rows, m.Cols }
 // Caps returns the number of rows and columns in the backing matrix.
 func (m *matrix[T]) Caps() (r, c int) { return m.capRows, m.capCols }
 
+// At returns the element at row i, column j.
 func (m *matrix[T]) At(i, j int) T {
-	return *new(T)
+	if uint(i) >= uint(m.Rows) {
+		panic(ErrRowAccess)
+	}
+	if uint(j) >= uint(m.Cols) {
+		panic(ErrColAccess)
+	}
+	return m.Data[i*m.Stride+j]
+}
+
+// Set alters the element at row i, column j to v.
+func (m *matrix[T]) Set(i, j int, v T) {
+	if uint(i) >= uint(m.Rows) {
+		panic(ErrRowAccess)
+	}
+	if uint(j) >= uint(m.Cols) {
+		panic(ErrColAccess)
+	}
+	m.Data[i*m.Stride+j] = v
 }
 
 // T performs an implicit transpose by returning the receiver inside a Transpose.
@@ -13,14 +13,20 @@ type App struct {
 }
 
 func New() App {
+	w := app.NewWindow(
+		app.Title("github.com/tauraamui/nebula"),
+	)
 	return App{
-		w: app.NewWindow(
-			app.Title("github.com/tauraamui/nebula"),
-		),
-		c: widgets.NewCanvas(),
+		w: w,
+		c: widgets.NewCanvas(w.Invalidate),
 	}
 }
 
+// Open loads the document at path, which is also where it will be saved.
+func (a *App) Open(path string) error {
+	return a.c.Open(path)
+}
+
 func (a *App) Run() error {
 	var ops op.Ops
 	var err error
@@ -0,0 +1,494 @@
+package numfmt
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tauraamui/nebula/decimal"
+)
+
+var ErrSyntax = errors.New("numfmt: invalid pattern")
+
+// Format displays numbers following a pattern in the style of other
+// spreadsheets, such as #,##0.00, 0.0%, 0.00E+00 or $#,##0.00. Within the
+// number, 0 is a digit always shown, # a digit shown only if needed and a
+// comma separates thousands. Text before and after the number, quoted if
+// it holds pattern characters, is shown as it is, and a % after it shows
+// the number as a percentage. The zero value shows numbers as they are.
+//
+// A pattern without digits, such as yyyy-mm-dd or d mmm yy, shows numbers
+// as dates, counting days from 30 December 1899 as other spreadsheets do.
+// Within it yyyy and yy are the year, mmmm, mmm, mm and m the month, as a
+// name or a number, dd and d the day and dddd and ddd the day of the
+// week.
+type Format struct {
+	pattern        string
+	date           bool
+	prefix, suffix string
+	// minInt is the number of integer digits always shown, and minFrac
+	// and maxFrac bound the number of decimal places.
+	minInt           int
+	minFrac, maxFrac int
+	thousands        bool
+	percent          bool
+	scientific       bool
+	expDigits        int
+	expSign          bool
+}
+
+// Parse parses a pattern, or one of the named formats followed by an
+// optional number of decimal places:
+//
+//	general
+//	fixed 2      0.00
+//	thousands 0  #,##0
+//	percent 1    0.0%
+//	scientific 2 0.00E+00
+//	currency € 2 €#,##0.00
+//	date         yyyy-mm-dd
+//
+// currency takes an optional symbol, $ by default, before its places.
+func Parse(s string) (Format, error) {
+	s = strings.TrimSpace(s)
+	fields := strings.Fields(strings.ToLower(s))
+	if len(fields) == 0 || fields[0] == "general" {
+		if len(fields) > 1 {
+			return Format{}, ErrSyntax
+		}
+		return Format{}, nil
+	}
+	name, args := fields[0], strings.Fields(s)[1:]
+	places := func(def int) (int, error) {
+		if len(args) == 0 {
+			return def, nil
+		}
+		n, err := strconv.Atoi(args[len(args)-1])
+		if err != nil || n < 0 || n > 15 || len(args) > 1 {
+			return 0, ErrSyntax
+		}
+		return n, nil
+	}
+	decimals := func(n int) string {
+		if n == 0 {
+			return ""
+		}
+		return "." + strings.Repeat("0", n)
+	}
+	var pattern string
+	switch name {
+	case "fixed":
+		n, err := places(2)
+		if err != nil {
+			return Format{}, err
+		}
+		pattern = "0" + decimals(n)
+	case "thousands":
+		n, err := places(0)
+		if err != nil {
+			return Format{}, err
+		}
+		pattern = "#,##0" + decimals(n)
+	case "percent":
+		n, err := places(0)
+		if err != nil {
+			return Format{}, err
+		}
+		pattern = "0" + decimals(n) + "%"
+	case "scientific":
+		n, err := places(2)
+		if err != nil {
+			return Format{}, err
+		}
+		pattern = "0" + decimals(n) + "E+00"
+	case "currency":
+		symbol := "$"
+		if len(args) > 0 {
+			if _, err := strconv.Atoi(args[0]); err != nil {
+				symbol, args = args[0], args[1:]
+			}
+		}
+		n, err := places(2)
+		if err != nil {
+			return Format{}, err
+		}
+		pattern = quote(symbol) + "#,##0" + decimals(n)
+	case "date":
+		if len(args) > 0 {
+			return Format{}, ErrSyntax
+		}
+		pattern = "yyyy-mm-dd"
+	default:
+		pattern = s
+	}
+	return parsePattern(pattern)
+}
+
+// quote returns text quoted if it holds characters with a meaning in
+// patterns.
+func quote(text string) string {
+	if strings.ContainsAny(text, `#0.,%E"\`) {
+		return `"` + strings.ReplaceAll(text, `"`, ``) + `"`
+	}
+	return text
+}
+
+func parsePattern(pattern string) (Format, error) {
+	if isDatePattern(pattern) {
+		return Format{pattern: pattern, date: true}, nil
+	}
+	f := Format{pattern: pattern}
+	var prefix, number, suffix strings.Builder
+	inNumber, done := false, false
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '"':
+			end := strings.IndexByte(pattern[i+1:], '"')
+			if end < 0 {
+				return Format{}, fmt.Errorf("%w: unterminated quote", ErrSyntax)
+			}
+			text := pattern[i+1 : i+1+end]
+			i += end + 1
+			if inNumber {
+				inNumber, done = false, true
+			}
+			if done {
+				suffix.WriteString(text)
+			} else {
+				prefix.WriteString(text)
+			}
+			continue
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			c = pattern[i]
+		case !done && (c == '#' || c == '0' || (c == '.' || c == ',') && inNumber ||
+			c == '.' && i+1 < len(pattern) && (pattern[i+1] == '0' || pattern[i+1] == '#')):
+			inNumber = true
+			number.WriteByte(c)
+			continue
+		case inNumber && (c == 'E' || c == 'e') && i+1 < len(pattern) && strings.ContainsRune("+-0", rune(pattern[i+1])):
+			j := i + 1
+			if pattern[j] == '+' || pattern[j] == '-' {
+				f.expSign = pattern[j] == '+'
+				j++
+			}
+			for ; j < len(pattern) && pattern[j] == '0'; j++ {
+				f.expDigits++
+			}
+			if f.expDigits == 0 {
+				return Format{}, fmt.Errorf("%w: exponent needs digits", ErrSyntax)
+			}
+			f.scientific = true
+			i = j - 1
+			inNumber, done = false, true
+			continue
+		case c == '%':
+			f.percent = true
+		}
+		if inNumber {
+			inNumber, done = false, true
+		}
+		if done {
+			suffix.WriteByte(c)
+		} else {
+			prefix.WriteByte(c)
+		}
+	}
+	if number.Len() == 0 {
+		return Format{}, fmt.Errorf("%w: %q has no digits", ErrSyntax, pattern)
+	}
+	f.prefix, f.suffix = prefix.String(), suffix.String()
+
+	whole, frac, _ := strings.Cut(number.String(), ".")
+	if strings.Contains(frac, ".") || strings.Contains(frac, ",") {
+		return Format{}, fmt.Errorf("%w: misplaced separator in %q", ErrSyntax, pattern)
+	}
+	f.thousands = strings.Contains(whole, ",")
+	f.minInt = strings.Count(whole, "0")
+	f.minFrac = strings.Count(frac, "0")
+	f.maxFrac = len(frac)
+	return f, nil
+}
+
+// isDatePattern reports whether pattern has date fields and no digits
+// outside quotes.
+func isDatePattern(pattern string) bool {
+	fields := false
+	for _, tok := range dateTokens(pattern) {
+		switch tok[0] {
+		case '0', '#':
+			return false
+		case 'y', 'm', 'd':
+			fields = true
+		}
+	}
+	return fields
+}
+
+// dateTokens splits a date pattern into runs of the same field letter,
+// quoted text, without its quotes, and single other characters.
+func dateTokens(pattern string) []string {
+	var toks []string
+	for i := 0; i < len(pattern); {
+		c := pattern[i]
+		switch {
+		case c == '"':
+			end := strings.IndexByte(pattern[i+1:], '"')
+			if end < 0 {
+				end = len(pattern) - i - 1
+			}
+			if end > 0 {
+				toks = append(toks, "\""+pattern[i+1:i+1+end])
+			}
+			i += end + 2
+			continue
+		case c == 'y' || c == 'm' || c == 'd':
+			j := i
+			for j < len(pattern) && pattern[j] == c {
+				j++
+			}
+			toks = append(toks, pattern[i:j])
+			i = j
+			continue
+		}
+		toks = append(toks, pattern[i:i+1])
+		i++
+	}
+	return toks
+}
+
+// epoch is the day before serial day 1.
+var epoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// maxSerial is the serial day of 31 December 9999, the last date shown.
+const maxSerial = 2958465
+
+// Date returns the date of the serial day v, ignoring any time of day.
+func Date(v float64) time.Time {
+	return epoch.AddDate(0, 0, int(math.Floor(v)))
+}
+
+// Serial returns the serial day of the date t.
+func Serial(t time.Time) float64 {
+	t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return float64((t.Unix() - epoch.Unix()) / (24 * 60 * 60))
+}
+
+// ISODate shows serial days as dates such as 2024-01-31, the form read by
+// ParseDate.
+var ISODate = Format{pattern: "yyyy-mm-dd", date: true}
+
+// ParseDate returns the serial day of s, a date such as 2024-01-31.
+func ParseDate(s string) (float64, bool) {
+	t, err := time.Parse("2006-01-02", strings.TrimSpace(s))
+	if err != nil {
+		return 0, false
+	}
+	return Serial(t), true
+}
+
+// IsDate reports whether f shows numbers as dates.
+func (f Format) IsDate() bool {
+	return f.date
+}
+
+// formatDate returns the serial day v as f's date pattern shows it.
+func (f Format) formatDate(v float64) string {
+	if v < 1 || v > maxSerial {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	t := Date(v)
+	var b strings.Builder
+	for _, tok := range dateTokens(f.pattern) {
+		switch tok {
+		case "yy":
+			fmt.Fprintf(&b, "%02d", t.Year()%100)
+		case "m":
+			fmt.Fprintf(&b, "%d", t.Month())
+		case "mm":
+			fmt.Fprintf(&b, "%02d", t.Month())
+		case "mmm":
+			b.WriteString(t.Month().String()[:3])
+		case "d":
+			fmt.Fprintf(&b, "%d", t.Day())
+		case "dd":
+			fmt.Fprintf(&b, "%02d", t.Day())
+		case "ddd":
+			b.WriteString(t.Weekday().String()[:3])
+		default:
+			switch {
+			case tok[0] == 'y':
+				fmt.Fprintf(&b, "%04d", t.Year())
+			case tok[0] == 'm':
+				b.WriteString(t.Month().String())
+			case tok[0] == 'd':
+				b.WriteString(t.Weekday().String())
+			default:
+				b.WriteString(strings.TrimPrefix(tok, "\""))
+			}
+		}
+	}
+	return b.String()
+}
+
+// IsGeneral reports whether f shows numbers as they are.
+func (f Format) IsGeneral() bool {
+	return f.pattern == ""
+}
+
+// String returns the pattern f was parsed from, or general.
+func (f Format) String() string {
+	if f.IsGeneral() {
+		return "general"
+	}
+	return f.pattern
+}
+
+// Format returns v as f displays it.
+func (f Format) Format(v float64) string {
+	if f.IsGeneral() || math.IsNaN(v) || math.IsInf(v, 0) {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	if f.date {
+		return f.formatDate(v)
+	}
+	if f.percent {
+		v *= 100
+	}
+	sign := ""
+	if v < 0 {
+		sign, v = "-", -v
+	}
+	var number string
+	if f.scientific {
+		exp := 0
+		if v != 0 {
+			exp = int(math.Floor(math.Log10(v)))
+		}
+		mant := f.fixed(v / math.Pow(10, float64(exp)))
+		if strings.HasPrefix(mant, "10") {
+			// rounding carried into another digit
+			exp++
+			mant = f.fixed(v / math.Pow(10, float64(exp)))
+		}
+		expSign := ""
+		if exp < 0 {
+			expSign, exp = "-", -exp
+		} else if f.expSign {
+			expSign = "+"
+		}
+		digits := strconv.Itoa(exp)
+		if n := f.expDigits - len(digits); n > 0 {
+			digits = strings.Repeat("0", n) + digits
+		}
+		number = mant + "E" + expSign + digits
+	} else {
+		number = f.fixed(v)
+	}
+	if sign != "" && strings.Trim(number, "0.,E+-") == "" {
+		// a negative number rounded to zero
+		sign = ""
+	}
+	return sign + f.prefix + number + f.suffix
+}
+
+// fixed returns v, which is not negative, with f's decimal places and
+// integer digits.
+func (f Format) fixed(v float64) string {
+	// halves round up, as people expect, rather than to even
+	if scale := math.Pow(10, float64(f.maxFrac)); v*scale < 1e15 {
+		v = math.Round(v*scale) / scale
+	}
+	s := strconv.FormatFloat(v, 'f', f.maxFrac, 64)
+	whole, frac, _ := strings.Cut(s, ".")
+	for len(frac) > f.minFrac && strings.HasSuffix(frac, "0") {
+		frac = frac[:len(frac)-1]
+	}
+	whole = strings.TrimLeft(whole, "0")
+	if n := f.minInt - len(whole); n > 0 {
+		whole = strings.Repeat("0", n) + whole
+	}
+	if f.thousands {
+		whole = group(whole)
+	}
+	if frac == "" {
+		return whole
+	}
+	return whole + "." + frac
+}
+
+// Unformat returns the number s shows in plain decimal notation, undoing
+// what Format does: thousands separators are dropped, a percentage is
+// divided by 100 and text before and after the number, such as a
+// currency symbol, is ignored. It reports false if s shows no number,
+// as for error codes such as #DIV/0!.
+func Unformat(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "#") {
+		return "", false
+	}
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	start := strings.IndexAny(s, "0123456789.")
+	if start < 0 {
+		return "", false
+	}
+	end := start
+	for end < len(s) && strings.IndexByte("0123456789.,", s[end]) >= 0 {
+		end++
+	}
+	if end < len(s) && (s[end] == 'E' || s[end] == 'e') {
+		exp := end + 1
+		if exp < len(s) && (s[exp] == '+' || s[exp] == '-') {
+			exp++
+		}
+		digits := exp
+		for digits < len(s) && s[digits] >= '0' && s[digits] <= '9' {
+			digits++
+		}
+		if digits > exp {
+			end = digits
+		}
+	}
+	prefix, number, suffix := s[:start], s[start:end], s[end:]
+	if strings.ContainsAny(prefix+suffix, "0123456789") {
+		return "", false
+	}
+	whole, _, _ := strings.Cut(number, ".")
+	if strings.Contains(strings.TrimPrefix(number, whole), ",") {
+		return "", false
+	}
+	d, err := decimal.Parse(sign + strings.ReplaceAll(number, ",", ""))
+	if err != nil {
+		return "", false
+	}
+	if strings.Contains(suffix, "%") {
+		d = d.Mul(decimal.New(1, 2))
+	}
+	return d.String(), true
+}
+
+// group separates the thousands of the digits whole with commas.
+func group(whole string) string {
+	if len(whole) <= 3 {
+		return whole
+	}
+	var b strings.Builder
+	first := len(whole) % 3
+	if first > 0 {
+		b.WriteString(whole[:first])
+	}
+	for i := first; i < len(whole); i += 3 {
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(whole[i : i+3])
+	}
+	return b.String()
+}
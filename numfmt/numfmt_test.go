@@ -0,0 +1,157 @@
+package numfmt
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		pattern string
+		v       float64
+		want    string
+	}{
+		{pattern: "general", v: 1234.5, want: "1234.5"},
+		{pattern: "fixed 2", v: 2.345, want: "2.35"},
+		{pattern: "fixed 0", v: -0.4, want: "0"},
+		{pattern: "0.00", v: 3, want: "3.00"},
+		{pattern: "#.##", v: 0.5, want: ".5"},
+		{pattern: "000", v: 7, want: "007"},
+		{pattern: "thousands 0", v: 1234567, want: "1,234,567"},
+		{pattern: "#,##0.00", v: -1234.5, want: "-1,234.50"},
+		{pattern: "percent 1", v: 0.1234, want: "12.3%"},
+		{pattern: "scientific 2", v: 12345, want: "1.23E+04"},
+		{pattern: "0.00E+00", v: 0.00099999, want: "1.00E-03"},
+		{pattern: "currency 2", v: 1234.5, want: "$1,234.50"},
+		{pattern: "currency € 0", v: -1000, want: "-€1,000"},
+		{pattern: `0.0 "kg"`, v: 2.25, want: "2.3 kg"},
+		{pattern: "date", v: 45322, want: "2024-01-31"},
+		{pattern: "d mmm yy", v: 45322, want: "31 Jan 24"},
+		{pattern: "dddd, mmmm d, yyyy", v: 45322, want: "Wednesday, January 31, 2024"},
+		{pattern: "m/d/yyyy", v: 1, want: "12/31/1899"},
+		{pattern: "yyyy-mm-dd", v: 0, want: "0"},
+		{pattern: "yyyy-mm-dd", v: 45322.75, want: "2024-01-31"},
+	}
+	for _, tt := range tests {
+		f, err := Parse(tt.pattern)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", tt.pattern, err)
+			continue
+		}
+		if got := f.Format(tt.v); got != tt.want {
+			t.Errorf("%v as %s = %q, want %q", tt.v, tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, s := range []string{"general 2", "fixed x", "fixed 16", "percent -1", "thousands 1 2", "date 2"} {
+		if f, err := Parse(s); !errors.Is(err, ErrSyntax) {
+			t.Errorf("Parse(%q) = %v, %v, want %v", s, f, err, ErrSyntax)
+		}
+	}
+}
+
+func TestIsDate(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    bool
+	}{
+		{pattern: "general", want: false},
+		{pattern: "#,##0.00", want: false},
+		{pattern: "date", want: true},
+		{pattern: "d mmm yy", want: true},
+	}
+	for _, tt := range tests {
+		f, err := Parse(tt.pattern)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", tt.pattern, err)
+		}
+		if got := f.IsDate(); got != tt.want {
+			t.Errorf("%s shows dates = %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+	if !ISODate.IsDate() || ISODate.String() != "yyyy-mm-dd" {
+		t.Errorf("ISODate = %s, want yyyy-mm-dd dates", ISODate)
+	}
+}
+
+func TestDates(t *testing.T) {
+	tests := []struct {
+		s      string
+		serial float64
+		ok     bool
+	}{
+		{s: "1899-12-31", serial: 1, ok: true},
+		{s: "1900-03-01", serial: 61, ok: true},
+		{s: "2024-01-31", serial: 45322, ok: true},
+		{s: " 2024-02-29 ", serial: 45351, ok: true},
+		{s: "9999-12-31", serial: maxSerial, ok: true},
+		{s: "2023-02-29"},
+		{s: "31/01/2024"},
+		{s: "2024-01-31T00:00"},
+	}
+	for _, tt := range tests {
+		serial, ok := ParseDate(tt.s)
+		if ok != tt.ok || serial != tt.serial {
+			t.Errorf("ParseDate(%q) = %v, %v, want %v, %v", tt.s, serial, ok, tt.serial, tt.ok)
+			continue
+		}
+		if got := ISODate.Format(serial); ok && got != strings.TrimSpace(tt.s) {
+			t.Errorf("%v as a date = %s, want %s", serial, got, tt.s)
+		}
+	}
+	d := time.Date(2024, time.January, 31, 18, 30, 0, 0, time.FixedZone("", -8*60*60))
+	if got := Date(Serial(d)); !got.Equal(time.Date(2024, time.January, 31, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("date of the serial of %v = %v, want 2024-01-31", d, got)
+	}
+}
+
+func TestUnformat(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+		ok   bool
+	}{
+		{s: "1,234.50", want: "1234.50", ok: true},
+		{s: "12.5%", want: "0.125", ok: true},
+		{s: "$3.00", want: "3.00", ok: true},
+		{s: "-€1,000", want: "-1000", ok: true},
+		{s: "1.5E+03", want: "1500", ok: true},
+		{s: "2.3 kg", want: "2.3", ok: true},
+		{s: " 42 ", want: "42", ok: true},
+		{s: "#DIV/0!"},
+		{s: "Name"},
+		{s: "1.234,5"},
+		{s: "12 of 13"},
+		{s: ""},
+	}
+	for _, tt := range tests {
+		got, ok := Unformat(tt.s)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Unformat(%q) = %q, %v, want %q, %v", tt.s, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// TestUnformatFormatted checks that numbers shown in a format read back
+// as the numbers shown.
+func TestUnformatFormatted(t *testing.T) {
+	for _, pattern := range []string{"fixed 3", "thousands 2", "percent 2", "scientific 3", "currency £ 2"} {
+		f, err := Parse(pattern)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", pattern, err)
+		}
+		for _, v := range []float64{0, 0.125, -98765.4321} {
+			shown := f.Format(v)
+			got, ok := Unformat(shown)
+			n, err := strconv.ParseFloat(got, 64)
+			if !ok || err != nil || f.Format(n) != shown {
+				t.Errorf("Unformat(%q) = %q, %v, want a number shown as %q", shown, got, ok, shown)
+			}
+		}
+	}
+}
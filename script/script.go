@@ -0,0 +1,202 @@
+// Package script runs functions written by users in Starlark, a small
+// Python-like language, so that they can be called from cell formulas.
+// Scripts cannot reach the file system, network or clock, and every run
+// is bounded in steps, time and memory.
+package script
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/metrics"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tauraamui/nebula/formula"
+	"go.starlark.net/lib/math"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// Limits bound a single run of a script, either its top level when it is
+// compiled or one call of one of its functions.
+type Limits struct {
+	// Steps is the most computation steps a run may take.
+	Steps uint64
+	// Timeout is the longest a run may take.
+	Timeout time.Duration
+	// Memory is how far the heap may grow in bytes during a run. The heap
+	// is shared by the whole process, so this is a coarse bound which is
+	// checked periodically rather than on every allocation.
+	Memory uint64
+}
+
+// DefaultLimits are the limits used for the scripts attached to documents.
+var DefaultLimits = Limits{
+	Steps:   10_000_000,
+	Timeout: time.Second,
+	Memory:  64 << 20,
+}
+
+var (
+	ErrTimeout = errors.New("script: time limit exceeded")
+	ErrMemory  = errors.New("script: memory limit exceeded")
+)
+
+// memoryCheckInterval is how often the heap is measured during a run.
+const memoryCheckInterval = 5 * time.Millisecond
+
+const heapMetric = "/memory/classes/heap/objects:bytes"
+
+// options allow while loops and recursion, which the limits keep in check.
+var options = &syntax.FileOptions{While: true, Recursion: true, TopLevelControl: true}
+
+// Program is a compiled script. Its functions may be called concurrently.
+type Program struct {
+	src    string
+	limits Limits
+	funcs  map[string]*starlark.Function
+}
+
+// Compile runs src and collects the functions it defines, except those
+// whose names begin with an underscore. Functions are called from
+// formulas by their names in upper case, which must not clash with each
+// other or with built-in functions.
+func Compile(src string, limits Limits) (*Program, error) {
+	p := &Program{src: src, limits: limits, funcs: map[string]*starlark.Function{}}
+	predeclared := starlark.StringDict{"math": math.Module}
+	var globals starlark.StringDict
+	err := p.run(context.Background(), "<script>", func(thread *starlark.Thread) (err error) {
+		globals, err = starlark.ExecFileOptions(options, thread, "script", src, predeclared)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	for name, v := range globals {
+		fn, ok := v.(*starlark.Function)
+		if !ok || strings.HasPrefix(name, "_") {
+			continue
+		}
+		upper := strings.ToUpper(name)
+		if formula.Builtin(upper) {
+			return nil, fmt.Errorf("script: %s is a built-in function", upper)
+		}
+		if _, ok := p.funcs[upper]; ok {
+			return nil, fmt.Errorf("script: %s is defined more than once", upper)
+		}
+		p.funcs[upper] = fn
+	}
+	return p, nil
+}
+
+// Source returns the script p was compiled from.
+func (p *Program) Source() string { return p.src }
+
+// Names returns the names of p's functions in order.
+func (p *Program) Names() []string {
+	names := make([]string, 0, len(p.funcs))
+	for name := range p.funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Func returns the function of p called name as a formula function.
+// Failures of the script become #VALUE! errors.
+func (p *Program) Func(name string) (formula.Func, bool) {
+	return p.FuncContext(context.Background(), name)
+}
+
+// FuncContext is like Func, but calls of the function are cancelled once
+// ctx is done.
+func (p *Program) FuncContext(ctx context.Context, name string) (formula.Func, bool) {
+	fn, ok := p.funcs[name]
+	if !ok {
+		return nil, false
+	}
+	return func(args []formula.Value) (formula.Value, error) {
+		v, err := p.call(ctx, fn, args)
+		if err != nil {
+			var e formula.Error
+			if errors.As(err, &e) {
+				return nil, e
+			}
+			return nil, formula.Error{Code: formula.CodeValue, Cause: fmt.Errorf("%s: %w", name, err)}
+		}
+		return v, nil
+	}, true
+}
+
+func (p *Program) call(ctx context.Context, fn *starlark.Function, args []formula.Value) (formula.Value, error) {
+	sargs := make(starlark.Tuple, len(args))
+	for i, a := range args {
+		sargs[i] = toStarlark(a)
+	}
+	var res starlark.Value
+	err := p.run(ctx, fn.Name(), func(thread *starlark.Thread) (err error) {
+		res, err = starlark.Call(thread, fn, sargs, nil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fromStarlark(res)
+}
+
+// run calls fn with a thread which is cancelled once it exceeds p's
+// limits or ctx is done.
+func (p *Program) run(ctx context.Context, name string, fn func(*starlark.Thread) error) error {
+	thread := &starlark.Thread{Name: name, Print: func(*starlark.Thread, string) {}}
+	thread.SetMaxExecutionSteps(p.limits.Steps)
+
+	done := make(chan struct{})
+	exceeded := make(chan error, 1)
+	go func() {
+		timeout := time.NewTimer(p.limits.Timeout)
+		defer timeout.Stop()
+		tick := time.NewTicker(memoryCheckInterval)
+		defer tick.Stop()
+		base := heapSize()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				exceeded <- ctx.Err()
+				thread.Cancel(ctx.Err().Error())
+				return
+			case <-timeout.C:
+				exceeded <- ErrTimeout
+				thread.Cancel(ErrTimeout.Error())
+				return
+			case <-tick.C:
+				if heapSize() > base+p.limits.Memory {
+					exceeded <- ErrMemory
+					thread.Cancel(ErrMemory.Error())
+					return
+				}
+			}
+		}
+	}()
+
+	err := fn(thread)
+	close(done)
+	select {
+	case limit := <-exceeded:
+		return limit
+	default:
+		return err
+	}
+}
+
+func heapSize() uint64 {
+	sample := []metrics.Sample{{Name: heapMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
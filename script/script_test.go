@@ -0,0 +1,100 @@
+package script
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tauraamui/nebula/formula"
+)
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		limits Limits
+		want   error
+	}{
+		{
+			name:   "infinite loop",
+			src:    "def f():\n    while True:\n        pass\n",
+			limits: Limits{Steps: 1 << 62, Timeout: 50 * time.Millisecond, Memory: 1 << 40},
+			want:   ErrTimeout,
+		},
+		{
+			name:   "big allocation",
+			src:    "def f():\n    xs = []\n    while True:\n        xs.append([0] * 4096)\n",
+			limits: Limits{Steps: 1 << 62, Timeout: 10 * time.Second, Memory: 8 << 20},
+			want:   ErrMemory,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Compile(tt.src, tt.limits)
+			if err != nil {
+				t.Fatalf("compile failed: %v", err)
+			}
+			f, _ := p.Func("F")
+			got, err := f(nil)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("F = %v, %v, want %v", got, err, tt.want)
+			}
+			if code := formula.AsError(err).Code; code != formula.CodeValue {
+				t.Fatalf("F failed with %s, want %s", code, formula.CodeValue)
+			}
+		})
+	}
+}
+
+func TestSteps(t *testing.T) {
+	p, err := Compile("def f():\n    while True:\n        pass\n", Limits{Steps: 1000, Timeout: 10 * time.Second, Memory: 1 << 40})
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	f, _ := p.Func("F")
+	if got, err := f(nil); err == nil {
+		t.Fatalf("F = %v, want the step limit exceeded", got)
+	}
+}
+
+func TestFuncContext(t *testing.T) {
+	src := "def add(a, b):\n    return a + b\n\ndef spin():\n    while True:\n        pass\n"
+	p, err := Compile(src, Limits{Steps: 1 << 62, Timeout: 10 * time.Second, Memory: 1 << 40})
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	spin, _ := p.FuncContext(ctx, "SPIN")
+	spun := make(chan error, 1)
+	go func() {
+		_, err := spin(nil)
+		spun <- err
+	}()
+
+	add, _ := p.FuncContext(context.Background(), "ADD")
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			got, err := add([]formula.Value{float64(i), 0.5})
+			if err != nil || got != float64(i)+0.5 {
+				t.Errorf("ADD(%d, 0.5) = %v, %v, want %v", i, got, err, float64(i)+0.5)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	cancel()
+	select {
+	case err := <-spun:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("SPIN failed with %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("SPIN was not cancelled")
+	}
+}
@@ -0,0 +1,118 @@
+package script
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/tauraamui/nebula/formula"
+	"go.starlark.net/starlark"
+)
+
+// toStarlark converts a formula value for a script. Numbers of every kind
+// lose any unit and become ints when they are whole, floats otherwise. Arrays with a single row or column
+// become lists, other arrays become lists of rows.
+func toStarlark(v formula.Value) starlark.Value {
+	switch v := v.(type) {
+	case string:
+		return starlark.String(v)
+	case bool:
+		return starlark.Bool(v)
+	case *formula.Array:
+		if v.Rows == 1 || v.Cols == 1 {
+			list := make([]starlark.Value, len(v.Data))
+			for i, e := range v.Data {
+				list[i] = toStarlark(e)
+			}
+			return starlark.NewList(list)
+		}
+		rows := make([]starlark.Value, v.Rows)
+		for i := range rows {
+			row := make([]starlark.Value, v.Cols)
+			for j := range row {
+				row[j] = toStarlark(v.At(i, j))
+			}
+			rows[i] = starlark.NewList(row)
+		}
+		return starlark.NewList(rows)
+	}
+	f, err := formula.ToNumber(v)
+	if err != nil {
+		return starlark.None
+	}
+	if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		return starlark.MakeInt64(int64(f))
+	}
+	return starlark.Float(f)
+}
+
+// fromStarlark converts the result of a script to a formula value. A list
+// of numbers becomes a single column array, a list of equally long lists
+// becomes an array of those rows.
+func fromStarlark(v starlark.Value) (formula.Value, error) {
+	switch v := v.(type) {
+	case starlark.Float:
+		return float64(v), nil
+	case starlark.Int:
+		f, _ := starlark.AsFloat(v)
+		return f, nil
+	case starlark.String:
+		return string(v), nil
+	case starlark.Bool:
+		return bool(v), nil
+	case starlark.Indexable:
+		return arrayFromStarlark(v)
+	}
+	return nil, fmt.Errorf("cannot use %s result", v.Type())
+}
+
+func arrayFromStarlark(v starlark.Indexable) (formula.Value, error) {
+	n := v.Len()
+	if n == 0 {
+		return nil, fmt.Errorf("cannot use empty %s result", v.Type())
+	}
+	if _, nested := asRow(v.Index(0)); !nested {
+		arr := &formula.Array{Rows: n, Cols: 1, Data: make([]formula.Value, n)}
+		for i := range arr.Data {
+			e, err := scalarFromStarlark(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			arr.Data[i] = e
+		}
+		return arr, nil
+	}
+
+	first, _ := asRow(v.Index(0))
+	arr := &formula.Array{Rows: n, Cols: first.Len()}
+	for i := 0; i < n; i++ {
+		row, ok := asRow(v.Index(i))
+		if !ok || row.Len() != arr.Cols || arr.Cols == 0 {
+			return nil, fmt.Errorf("rows of %s result differ in length", v.Type())
+		}
+		for j := 0; j < row.Len(); j++ {
+			e, err := scalarFromStarlark(row.Index(j))
+			if err != nil {
+				return nil, err
+			}
+			arr.Data = append(arr.Data, e)
+		}
+	}
+	return arr, nil
+}
+
+// asRow returns v if it is a list or tuple of values rather than a
+// single value.
+func asRow(v starlark.Value) (starlark.Indexable, bool) {
+	if _, ok := v.(starlark.String); ok {
+		return nil, false
+	}
+	row, ok := v.(starlark.Indexable)
+	return row, ok
+}
+
+func scalarFromStarlark(v starlark.Value) (formula.Value, error) {
+	if _, nested := asRow(v); nested {
+		return nil, fmt.Errorf("cannot nest %s in result", v.Type())
+	}
+	return fromStarlark(v)
+}
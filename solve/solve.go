@@ -0,0 +1,180 @@
+// Package solve finds the inputs which make a function produce a wanted
+// result, for answering what-if questions about a sheet.
+package solve
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"gonum.org/v1/gonum/optimize"
+)
+
+var (
+	ErrNoSolution = errors.New("solve: no solution found")
+	ErrInfeasible = errors.New("solve: constraints cannot be satisfied")
+)
+
+// maxIterations bounds the steps goal seeking takes.
+const maxIterations = 100
+
+// tolerance is how close to the target goal seeking needs to get,
+// relative to the size of the target.
+const tolerance = 1e-9
+
+// GoalSeek returns an x for which f(x) equals target, starting from x0.
+// It takes secant steps, falling back to bisection once a sign change
+// has bracketed the solution. It stops with ctx's error once ctx is done.
+func GoalSeek(ctx context.Context, f func(x float64) (float64, error), target, x0 float64) (float64, error) {
+	g := func(x float64) (float64, error) {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		y, err := f(x)
+		return y - target, err
+	}
+	tol := tolerance * math.Max(1, math.Abs(target))
+
+	x1 := x0 + math.Max(math.Abs(x0)*0.01, 0.01)
+	y0, err := g(x0)
+	if err != nil {
+		return 0, err
+	}
+	if math.Abs(y0) <= tol {
+		return x0, nil
+	}
+	y1, err := g(x1)
+	if err != nil {
+		return 0, err
+	}
+
+	var lo, hi float64
+	bracketed := false
+	for i := 0; i < maxIterations; i++ {
+		if math.Abs(y1) <= tol {
+			return x1, nil
+		}
+		if y0*y1 < 0 {
+			lo, hi, bracketed = x0, x1, true
+			if y0 > 0 {
+				lo, hi = x1, x0
+			}
+		}
+
+		var x2 float64
+		switch {
+		case y1 != y0:
+			x2 = x1 - y1*(x1-x0)/(y1-y0)
+		case bracketed:
+			x2 = (lo + hi) / 2
+		default:
+			return 0, ErrNoSolution
+		}
+		if bracketed && (x2 <= math.Min(lo, hi) || x2 >= math.Max(lo, hi)) {
+			x2 = (lo + hi) / 2
+		}
+		if math.IsNaN(x2) || math.IsInf(x2, 0) {
+			return 0, ErrNoSolution
+		}
+		y2, err := g(x2)
+		if err != nil {
+			return 0, err
+		}
+		if bracketed {
+			if y2 < 0 {
+				lo = x2
+			} else {
+				hi = x2
+			}
+		}
+		x0, y0, x1, y1 = x1, y1, x2, y2
+	}
+	if math.Abs(y1) <= tol {
+		return x1, nil
+	}
+	return 0, ErrNoSolution
+}
+
+// Constraint restricts the inputs of a Problem. The constraint holds
+// where F is at most zero, or exactly zero if Equality is set.
+type Constraint struct {
+	F        func(x []float64) float64
+	Equality bool
+}
+
+// Problem is a function to minimise subject to constraints.
+type Problem struct {
+	Objective   func(x []float64) float64
+	Constraints []Constraint
+}
+
+// penalties are the successive weights given to broken constraints. Each
+// round starts from where the previous one finished.
+var penalties = []float64{1, 1e2, 1e4, 1e6, 1e8}
+
+// feasibility is how far a constraint may be broken in the result.
+const feasibility = 1e-6
+
+// maxEvaluations bounds the evaluations of each round of Minimize.
+const maxEvaluations = 20000
+
+// Minimize returns the x nearest x0 that minimises p's objective subject
+// to its constraints, using Nelder-Mead with a quadratic penalty for
+// broken constraints. The objective is treated as a black box, so the
+// result is a local minimum. It stops with ctx's error once ctx is done.
+func Minimize(ctx context.Context, p Problem, x0 []float64) ([]float64, error) {
+	x := append([]float64{}, x0...)
+	for _, mu := range penalties {
+		mu := mu
+		problem := optimize.Problem{Func: func(x []float64) float64 {
+			v := p.Objective(x) + mu*violation(p.Constraints, x)
+			if math.IsNaN(v) {
+				return math.Inf(1)
+			}
+			return v
+		}}
+		settings := &optimize.Settings{
+			FuncEvaluations: maxEvaluations,
+			Converger:       &optimize.FunctionConverge{Absolute: 1e-10, Relative: 1e-10, Iterations: 200},
+			Recorder:        canceller{ctx},
+		}
+		res, err := optimize.Minimize(problem, x, settings, &optimize.NelderMead{})
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if res == nil {
+			return nil, err
+		}
+		x = res.X
+		if violation(p.Constraints, x) <= feasibility*feasibility {
+			if math.IsInf(p.Objective(x), 0) {
+				return nil, ErrNoSolution
+			}
+			return x, nil
+		}
+	}
+	return nil, ErrInfeasible
+}
+
+// canceller stops a minimisation once its context is done.
+type canceller struct {
+	ctx context.Context
+}
+
+func (c canceller) Init() error { return nil }
+
+func (c canceller) Record(*optimize.Location, optimize.Operation, *optimize.Stats) error {
+	return c.ctx.Err()
+}
+
+func violation(constraints []Constraint, x []float64) float64 {
+	var total float64
+	for _, c := range constraints {
+		v := c.F(x)
+		if !c.Equality && v < 0 {
+			v = 0
+		}
+		total += v * v
+	}
+	return total
+}
@@ -0,0 +1,139 @@
+package solve
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestGoalSeek(t *testing.T) {
+	fail := errors.New("no value")
+	tests := []struct {
+		name   string
+		f      func(x float64) (float64, error)
+		target float64
+		x0     float64
+		want   float64
+		err    error
+	}{
+		{name: "linear", f: func(x float64) (float64, error) { return 3*x + 1, nil }, target: 10, x0: 0, want: 3},
+		{name: "square root", f: func(x float64) (float64, error) { return x * x, nil }, target: 2, x0: 1, want: math.Sqrt2},
+		{name: "already there", f: func(x float64) (float64, error) { return x, nil }, target: 5, x0: 5, want: 5},
+		{name: "large target", f: func(x float64) (float64, error) { return x * x * x, nil }, target: 1e6, x0: 50, want: 100},
+		{name: "step", f: func(x float64) (float64, error) {
+			if x < 2 {
+				return -1, nil
+			}
+			return 1, nil
+		}, target: 0, x0: 0, err: ErrNoSolution},
+		{name: "unreachable", f: func(x float64) (float64, error) { return x*x + 1, nil }, target: 0, x0: 3, err: ErrNoSolution},
+		{name: "failing", f: func(x float64) (float64, error) { return 0, fail }, target: 1, x0: 0, err: fail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GoalSeek(context.Background(), tt.f, tt.target, tt.x0)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("GoalSeek = %v, %v, want %v", got, err, tt.err)
+			}
+			if err == nil && math.Abs(got-tt.want) > 1e-6 {
+				t.Fatalf("GoalSeek = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGoalSeekCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	f := func(x float64) (float64, error) {
+		if calls++; calls == 3 {
+			cancel()
+		}
+		return x*x + 1, nil
+	}
+	if got, err := GoalSeek(ctx, f, 0, 3); !errors.Is(err, context.Canceled) {
+		t.Fatalf("GoalSeek = %v, %v, want %v", got, err, context.Canceled)
+	}
+	if calls != 3 {
+		t.Fatalf("GoalSeek called f %d times after being cancelled", calls-3)
+	}
+}
+
+func TestMinimize(t *testing.T) {
+	sq := func(v float64) float64 { return v * v }
+	tests := []struct {
+		name string
+		p    Problem
+		x0   []float64
+		want []float64
+		err  error
+	}{
+		{
+			name: "unconstrained",
+			p:    Problem{Objective: func(x []float64) float64 { return sq(x[0]-1) + sq(x[1]+2) }},
+			x0:   []float64{0, 0},
+			want: []float64{1, -2},
+		},
+		{
+			name: "bounded",
+			p: Problem{
+				Objective:   func(x []float64) float64 { return sq(x[0] - 3) },
+				Constraints: []Constraint{{F: func(x []float64) float64 { return x[0] - 1 }}},
+			},
+			x0:   []float64{0},
+			want: []float64{1},
+		},
+		{
+			name: "equality",
+			p: Problem{
+				Objective:   func(x []float64) float64 { return sq(x[0]) + sq(x[1]) },
+				Constraints: []Constraint{{F: func(x []float64) float64 { return x[0] + x[1] - 2 }, Equality: true}},
+			},
+			x0:   []float64{0, 0},
+			want: []float64{1, 1},
+		},
+		{
+			name: "infeasible",
+			p: Problem{
+				Objective: func(x []float64) float64 { return x[0] },
+				Constraints: []Constraint{
+					{F: func(x []float64) float64 { return x[0] - 1 }},
+					{F: func(x []float64) float64 { return 2 - x[0] }},
+				},
+			},
+			x0:  []float64{0},
+			err: ErrInfeasible,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Minimize(context.Background(), tt.p, tt.x0)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Minimize = %v, %v, want %v", got, err, tt.err)
+			}
+			for i := range tt.want {
+				if math.Abs(got[i]-tt.want[i]) > 1e-3 {
+					t.Fatalf("Minimize = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestMinimizeCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	p := Problem{Objective: func(x []float64) float64 {
+		if calls++; calls == 10 {
+			cancel()
+		}
+		return math.Sin(x[0]) + math.Cos(x[1])
+	}}
+	if got, err := Minimize(ctx, p, []float64{0, 0}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Minimize = %v, %v, want %v", got, err, context.Canceled)
+	}
+	if calls > 20 {
+		t.Fatalf("Minimize evaluated the objective %d times after being cancelled", calls-10)
+	}
+}
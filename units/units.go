@@ -0,0 +1,331 @@
+package units
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Dimension holds the exponent of each SI base dimension, in the order
+// length, mass, time, current, temperature, amount and luminosity.
+type Dimension [7]int8
+
+var baseSymbols = [7]string{"m", "kg", "s", "A", "K", "mol", "cd"}
+
+// Unit is a unit of measure, a scale relative to the SI base units of
+// its dimension.
+type Unit struct {
+	Symbol string
+	Scale  float64
+	Dim    Dimension
+}
+
+var (
+	ErrUnknownUnit  = errors.New("units: unknown unit")
+	ErrIncompatible = errors.New("units: incompatible units")
+)
+
+var (
+	length      = Dimension{1}
+	mass        = Dimension{0, 1}
+	duration    = Dimension{0, 0, 1}
+	current     = Dimension{0, 0, 0, 1}
+	temperature = Dimension{0, 0, 0, 0, 1}
+	amount      = Dimension{0, 0, 0, 0, 0, 1}
+	luminosity  = Dimension{0, 0, 0, 0, 0, 0, 1}
+	force       = Dimension{1, 1, -2}
+	energy      = Dimension{2, 1, -2}
+	power       = Dimension{2, 1, -3}
+	pressure    = Dimension{-1, 1, -2}
+	frequency   = Dimension{0, 0, -1}
+	charge      = Dimension{0, 0, 1, 1}
+	voltage     = Dimension{2, 1, -3, -1}
+	volume      = Dimension{3}
+)
+
+var symbols = map[string]Unit{
+	"m":   {Scale: 1, Dim: length},
+	"g":   {Scale: 1e-3, Dim: mass},
+	"t":   {Scale: 1e3, Dim: mass},
+	"s":   {Scale: 1, Dim: duration},
+	"min": {Scale: 60, Dim: duration},
+	"h":   {Scale: 3600, Dim: duration},
+	"day": {Scale: 86400, Dim: duration},
+	"A":   {Scale: 1, Dim: current},
+	"K":   {Scale: 1, Dim: temperature},
+	"mol": {Scale: 1, Dim: amount},
+	"cd":  {Scale: 1, Dim: luminosity},
+	"N":   {Scale: 1, Dim: force},
+	"J":   {Scale: 1, Dim: energy},
+	"W":   {Scale: 1, Dim: power},
+	"Pa":  {Scale: 1, Dim: pressure},
+	"bar": {Scale: 1e5, Dim: pressure},
+	"Hz":  {Scale: 1, Dim: frequency},
+	"C":   {Scale: 1, Dim: charge},
+	"V":   {Scale: 1, Dim: voltage},
+	"L":   {Scale: 1e-3, Dim: volume},
+	"in":  {Scale: 0.0254, Dim: length},
+	"ft":  {Scale: 0.3048, Dim: length},
+	"mi":  {Scale: 1609.344, Dim: length},
+	"lb":  {Scale: 0.45359237, Dim: mass},
+}
+
+var prefixes = map[string]float64{
+	"G": 1e9, "M": 1e6, "k": 1e3, "c": 1e-2, "m": 1e-3, "u": 1e-6, "µ": 1e-6, "n": 1e-9,
+}
+
+// named are the SI units which are preferred when formatting the result
+// of combining units.
+var named = []string{"N", "J", "W", "Pa", "Hz", "V", "C"}
+
+func lookup(symbol string) (Unit, bool) {
+	if u, ok := symbols[symbol]; ok {
+		u.Symbol = symbol
+		return u, true
+	}
+	for p, scale := range prefixes {
+		if !strings.HasPrefix(symbol, p) {
+			continue
+		}
+		u, ok := symbols[strings.TrimPrefix(symbol, p)]
+		if !ok {
+			continue
+		}
+		u.Symbol = symbol
+		u.Scale *= scale
+		return u, true
+	}
+	return Unit{}, false
+}
+
+// Parse parses a unit expression such as kg, m/s, kg*m/s^2, m/(s*kg),
+// (m/s)^2 or 1/s. Terms are unit symbols, optionally SI prefixed, or
+// parenthesised expressions, either raised to an integer power and
+// joined by * or /. A 1 may stand in for the units divided, as the
+// symbols of units combined are written.
+func Parse(s string) (Unit, error) {
+	p := &parser{s: s}
+	u, err := p.expr()
+	if err != nil {
+		return Unit{}, err
+	}
+	if p.skipSpace(); p.i < len(p.s) {
+		return Unit{}, fmt.Errorf("%w %q", ErrUnknownUnit, s)
+	}
+	if u.Symbol == "" {
+		return Unit{}, ErrUnknownUnit
+	}
+	return u, nil
+}
+
+// parser reads a unit expression from s, from the byte at i.
+type parser struct {
+	s string
+	i int
+}
+
+func (p *parser) skipSpace() {
+	for p.i < len(p.s) && p.s[p.i] == ' ' {
+		p.i++
+	}
+}
+
+// expr reads factors joined by * or /.
+func (p *parser) expr() (Unit, error) {
+	u, err := p.factor()
+	if err != nil {
+		return Unit{}, err
+	}
+	for {
+		p.skipSpace()
+		if p.i >= len(p.s) || (p.s[p.i] != '*' && p.s[p.i] != '/') {
+			return u, nil
+		}
+		op := p.s[p.i]
+		p.i++
+		v, err := p.factor()
+		if err != nil {
+			return Unit{}, err
+		}
+		if op == '*' {
+			u = u.Mul(v)
+		} else {
+			u = u.Div(v)
+		}
+	}
+}
+
+// factor reads a unit symbol, a 1 or a parenthesised expression, with an
+// optional power.
+func (p *parser) factor() (Unit, error) {
+	p.skipSpace()
+	var u Unit
+	switch {
+	case p.i < len(p.s) && p.s[p.i] == '(':
+		p.i++
+		var err error
+		if u, err = p.expr(); err != nil {
+			return Unit{}, err
+		}
+		if p.skipSpace(); p.i >= len(p.s) || p.s[p.i] != ')' {
+			return Unit{}, fmt.Errorf("%w %q: missing )", ErrUnknownUnit, p.s)
+		}
+		p.i++
+	default:
+		start := p.i
+		for p.i < len(p.s) && !strings.ContainsRune("*/()^ ", rune(p.s[p.i])) {
+			p.i++
+		}
+		symbol := p.s[start:p.i]
+		if symbol == "1" {
+			u = Unit{Scale: 1}
+			break
+		}
+		var ok bool
+		if u, ok = lookup(symbol); !ok {
+			return Unit{}, fmt.Errorf("%w %q", ErrUnknownUnit, symbol)
+		}
+	}
+	if p.skipSpace(); p.i < len(p.s) && p.s[p.i] == '^' {
+		p.i++
+		start := p.i
+		if p.i < len(p.s) && (p.s[p.i] == '-' || p.s[p.i] == '+') {
+			p.i++
+		}
+		for p.i < len(p.s) && p.s[p.i] >= '0' && p.s[p.i] <= '9' {
+			p.i++
+		}
+		n, err := strconv.Atoi(p.s[start:p.i])
+		if err != nil {
+			return Unit{}, fmt.Errorf("%w %q", ErrUnknownUnit, p.s)
+		}
+		u = u.Pow(n)
+	}
+	return u, nil
+}
+
+// ParseQuantity splits text such as "12 kg" or "3.5 m/s" into its value
+// and unit. ok is false if s is not a number followed by a unit.
+func ParseQuantity(s string) (v float64, u Unit, ok bool) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= '0' && r <= '9') && r != '.' && r != '-' && r != '+' && r != 'e' && r != 'E'
+	})
+	for i > 0 && (s[i-1] == 'e' || s[i-1] == 'E') {
+		i--
+	}
+	if i <= 0 {
+		return 0, Unit{}, false
+	}
+	v, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, Unit{}, false
+	}
+	u, err = Parse(s[i:])
+	if err != nil {
+		return 0, Unit{}, false
+	}
+	return v, u, true
+}
+
+// String returns the unit's symbol.
+func (u Unit) String() string { return u.Symbol }
+
+// Dimensionless reports whether u has no dimension, such as m/m.
+func (u Unit) Dimensionless() bool { return u.Dim == Dimension{} }
+
+// Compatible reports whether values in u can be converted to v.
+func (u Unit) Compatible(v Unit) bool { return u.Dim == v.Dim }
+
+// Mul returns the product of u and v.
+func (u Unit) Mul(v Unit) Unit {
+	w := Unit{Scale: u.Scale * v.Scale, Symbol: join(u.Symbol, "*", v.Symbol)}
+	for i := range w.Dim {
+		w.Dim[i] = u.Dim[i] + v.Dim[i]
+	}
+	return w
+}
+
+// Div returns the quotient of u and v.
+func (u Unit) Div(v Unit) Unit {
+	w := Unit{Scale: u.Scale / v.Scale, Symbol: join(u.Symbol, "/", v.Symbol)}
+	for i := range w.Dim {
+		w.Dim[i] = u.Dim[i] - v.Dim[i]
+	}
+	return w
+}
+
+func join(a, op, b string) string {
+	if a == "" {
+		if op == "/" {
+			return "1/" + b
+		}
+		return b
+	}
+	if op == "/" && strings.ContainsAny(b, "*/") {
+		b = "(" + b + ")"
+	}
+	return a + op + b
+}
+
+// Pow returns u raised to the integer power n.
+func (u Unit) Pow(n int) Unit {
+	if n == 1 {
+		return u
+	}
+	symbol := u.Symbol
+	if strings.ContainsAny(symbol, "*/^") {
+		symbol = "(" + symbol + ")"
+	}
+	w := Unit{Scale: math.Pow(u.Scale, float64(n)), Symbol: symbol + "^" + strconv.Itoa(n)}
+	for i := range w.Dim {
+		w.Dim[i] = u.Dim[i] * int8(n)
+	}
+	return w
+}
+
+// Convert converts v from unit u to unit to.
+func (u Unit) Convert(v float64, to Unit) (float64, error) {
+	if !u.Compatible(to) {
+		return 0, fmt.Errorf("%w: %s and %s", ErrIncompatible, u, to)
+	}
+	return v * u.Scale / to.Scale, nil
+}
+
+// SI returns the coherent SI unit of u's dimension, named after a derived
+// unit such as N where one exists.
+func (u Unit) SI() Unit {
+	for _, symbol := range named {
+		if n := symbols[symbol]; n.Dim == u.Dim {
+			n.Symbol = symbol
+			return n
+		}
+	}
+	var num, den []string
+	for i, e := range u.Dim {
+		switch {
+		case e == 1:
+			num = append(num, baseSymbols[i])
+		case e > 1:
+			num = append(num, baseSymbols[i]+"^"+strconv.Itoa(int(e)))
+		case e == -1:
+			den = append(den, baseSymbols[i])
+		case e < -1:
+			den = append(den, baseSymbols[i]+"^"+strconv.Itoa(int(-e)))
+		}
+	}
+	symbol := strings.Join(num, "*")
+	if len(den) > 0 {
+		d := strings.Join(den, "*")
+		if len(den) > 1 {
+			d = "(" + d + ")"
+		}
+		if symbol == "" {
+			symbol = "1"
+		}
+		symbol += "/" + d
+	}
+	return Unit{Symbol: symbol, Scale: 1, Dim: u.Dim}
+}
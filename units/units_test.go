@@ -0,0 +1,140 @@
+package units
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		s      string
+		symbol string
+		scale  float64
+		dim    Dimension
+	}{
+		{s: "kg", symbol: "kg", scale: 1, dim: mass},
+		{s: "min", symbol: "min", scale: 60, dim: duration},
+		{s: "mm", symbol: "mm", scale: 1e-3, dim: length},
+		{s: "km / h", symbol: "km/h", scale: 1000.0 / 3600, dim: Dimension{1, 0, -1}},
+		{s: "kg*m/s^2", symbol: "kg*m/s^2", scale: 1, dim: force},
+		{s: "m/(s*kg)", symbol: "m/(s*kg)", scale: 1, dim: Dimension{1, -1, -1}},
+		{s: "(m/s)^2", symbol: "(m/s)^2", scale: 1, dim: Dimension{2, 0, -2}},
+		{s: "1/s", symbol: "1/s", scale: 1, dim: frequency},
+		{s: "s^-2", symbol: "s^-2", scale: 1, dim: Dimension{0, 0, -2}},
+		{s: "cm^3", symbol: "cm^3", scale: 1e-6, dim: volume},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			u, err := Parse(tt.s)
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %v", tt.s, err)
+			}
+			if u.Symbol != tt.symbol || math.Abs(u.Scale-tt.scale) > 1e-12 || u.Dim != tt.dim {
+				t.Fatalf("Parse(%q) = %+v, want %s scaled %v of %v", tt.s, u, tt.symbol, tt.scale, tt.dim)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, s := range []string{"", "1", "furlong", "kg m", "m/(s", "m)", "m^", "m^x", "*m"} {
+		if u, err := Parse(s); !errors.Is(err, ErrUnknownUnit) {
+			t.Errorf("Parse(%q) = %+v, %v, want %v", s, u, err, ErrUnknownUnit)
+		}
+	}
+}
+
+// TestSymbolsParse checks that the symbols written for units combined
+// and for SI units read back as the same unit.
+func TestSymbolsParse(t *testing.T) {
+	m, _ := Parse("m")
+	s, _ := Parse("s")
+	kg, _ := Parse("kg")
+	units := []Unit{
+		Unit{Scale: 1}.Div(s),
+		m.Div(s.Mul(kg)),
+		m.Div(s).Pow(2),
+		m.Mul(m).Div(s.Pow(2)),
+		m.Div(s).SI(),
+		m.Div(s.Mul(kg)).SI(),
+		Unit{Scale: 1}.Div(s.Pow(2)).SI(),
+		kg.Mul(m).Div(s.Pow(2)).SI(),
+	}
+	for _, u := range units {
+		v, err := Parse(u.Symbol)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", u.Symbol, err)
+			continue
+		}
+		if v.Dim != u.Dim || math.Abs(v.Scale-u.Scale) > 1e-12 {
+			t.Errorf("Parse(%q) = %+v, want %+v", u.Symbol, v, u)
+		}
+	}
+}
+
+func TestParseQuantity(t *testing.T) {
+	tests := []struct {
+		s      string
+		v      float64
+		symbol string
+		ok     bool
+	}{
+		{s: "12 kg", v: 12, symbol: "kg", ok: true},
+		{s: "3.5m/s", v: 3.5, symbol: "m/s", ok: true},
+		{s: "-1.5e3 m/(s*kg)", v: -1500, symbol: "m/(s*kg)", ok: true},
+		{s: "2 s^-1", v: 2, symbol: "s^-1", ok: true},
+		{s: "12"},
+		{s: "kg"},
+		{s: "12 furlongs"},
+	}
+	for _, tt := range tests {
+		v, u, ok := ParseQuantity(tt.s)
+		if ok != tt.ok || v != tt.v || u.Symbol != tt.symbol {
+			t.Errorf("ParseQuantity(%q) = %v, %q, %v, want %v, %q, %v", tt.s, v, u.Symbol, ok, tt.v, tt.symbol, tt.ok)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		v        float64
+		from, to string
+		want     float64
+		err      error
+	}{
+		{v: 1, from: "km", to: "m", want: 1000},
+		{v: 36, from: "km/h", to: "m/s", want: 10},
+		{v: 1, from: "mi", to: "ft", want: 5280},
+		{v: 2, from: "bar", to: "kPa", want: 200},
+		{v: 1, from: "kg", to: "m", err: ErrIncompatible},
+	}
+	for _, tt := range tests {
+		from, _ := Parse(tt.from)
+		to, _ := Parse(tt.to)
+		got, err := from.Convert(tt.v, to)
+		if !errors.Is(err, tt.err) || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%v %s in %s = %v, %v, want %v, %v", tt.v, tt.from, tt.to, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestSI(t *testing.T) {
+	tests := []struct{ s, want string }{
+		{s: "kg*m/s^2", want: "N"},
+		{s: "1/min", want: "Hz"},
+		{s: "km/h", want: "m/s"},
+		{s: "m/(s*kg)", want: "m/(kg*s)"},
+		{s: "L", want: "m^3"},
+		{s: "s^-2", want: "1/s^2"},
+	}
+	for _, tt := range tests {
+		u, err := Parse(tt.s)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", tt.s, err)
+		}
+		if got := u.SI().Symbol; got != tt.want {
+			t.Errorf("SI of %s = %s, want %s", tt.s, got, tt.want)
+		}
+	}
+}
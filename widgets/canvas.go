@@ -5,10 +5,12 @@ import (
 	"image"
 	"image/color"
 	"log"
+	"runtime"
 	"strings"
 
 	"gioui.org/f32"
 	"gioui.org/font/gofont"
+	"gioui.org/io/clipboard"
 	"gioui.org/io/key"
 	"gioui.org/io/pointer"
 	"gioui.org/io/profile"
@@ -21,7 +23,10 @@ import (
 	"gioui.org/widget/material"
 	"github.com/tauraamui/nebula/context"
 	"github.com/tauraamui/nebula/f32x"
+	"github.com/tauraamui/nebula/formula"
 	"github.com/tauraamui/nebula/gesturex"
+	"github.com/tauraamui/nebula/script"
+	"github.com/tauraamui/nebula/worker"
 	"gonum.org/v1/gonum/mat"
 )
 
@@ -33,9 +38,31 @@ type Canvas struct {
 	input                  *gesturex.InputEvents
 	offset                 f32.Point
 	pendingSelectionBounds f32x.Rectangle
+	graph                  *formula.Graph
+	path                   string
+	pool                   *worker.Pool
+	inflight               *recalculation
+	finished               chan *recalculation
+	invalidate             func()
+	script                 *script.Program
+	scriptPanel            ScriptPanel
+	solverPanel            SolverPanel
+	whatIfPanel            WhatIfPanel
+	findBar                FindBar
+	finding                finding
+	scenarios              []Scenario
+	activeScenario         string
+	solving                *solveRun
+	jobs                   chan func()
+	history                history
+	tracked                map[*Matrix[float64]]tracked
+	blur                   bool
 }
 
-func NewCanvas() *Canvas {
+// NewCanvas creates a canvas holding a single matrix. invalidate is called
+// from other goroutines when the canvas needs to be redrawn, such as when
+// formulas finish evaluating in the background.
+func NewCanvas(invalidate func()) *Canvas {
 	th := material.NewTheme()
 	th.Shaper = text.NewShaper(text.WithCollection(gofont.Collection()))
 
@@ -44,28 +71,32 @@ func NewCanvas() *Canvas {
 		log.Fatalf("unable to load toolbar: %v\n", err)
 	}
 
+	m := newMatrix("matrix1", f32.Pt(200, 200), mat.NewDense(4, 3, []float64{
+		12, 353, 11,
+		87, 258, 93,
+		29, 679, 224,
+		229, 6945, 685,
+	}))
+	m.SelectedCells = []image.Point{image.Pt(0, 0)}
+
 	return &Canvas{
-		theme:   th,
-		toolbar: tlbar,
-		matrices: []*Matrix[float64]{
-			{
-				Pos:           f32.Pt(200, 200),
-				SelectedCells: []image.Point{image.Pt(0, 0)},
-				Color:         color.NRGBA{R: 245, G: 245, B: 245, A: 255},
-				Data: mat.NewDense(4, 3, []float64{
-					12, 353, 11,
-					87, 258, 93,
-					29, 679, 224,
-					229, 6945, 685,
-				}),
-			},
-		},
+		theme:      th,
+		toolbar:    tlbar,
+		graph:      formula.NewGraph(),
+		matrices:   []*Matrix[float64]{m},
+		pool:       worker.NewPool(runtime.NumCPU()),
+		finished:   make(chan *recalculation, 1),
+		jobs:       make(chan func(), 8),
+		invalidate: invalidate,
 	}
 }
 
 func (c *Canvas) Update(ops *op.Ops, e system.FrameEvent) {
 	gtx := context.NewContext(ops, e)
 
+	c.applyFinished()
+	c.runJobs()
+
 	prof := profile.Op{Tag: "root"}
 	prof.Add(gtx.Ops)
 
@@ -76,9 +107,50 @@ func (c *Canvas) Update(ops *op.Ops, e system.FrameEvent) {
 		if pe, ok := e.(profile.Event); ok {
 			fmt.Printf("%v\n", pe)
 		}
+		if ce, ok := e.(clipboard.Event); ok && c.input != nil {
+			pos, _ := c.input.Hovered()
+			rows, cols := tsvSize(parseTSV(ce.Text))
+			gtx.PushEvent(context.CreateMatrix{Pos: pos.Div(float32(gtx.Dp(1))), Rows: rows, Cols: cols, Paste: ce.Text})
+		}
 		if ke, ok := e.(key.Event); ok {
 			if ke.State == key.Press {
-				if strings.EqualFold(ke.Name, "x") {
+				if ke.Modifiers.Contain(key.ModShortcut) && strings.EqualFold(ke.Name, "s") {
+					if err := c.Save(); err != nil {
+						log.Printf("unable to save document: %v\n", err)
+					}
+					continue
+				}
+				if ke.Modifiers.Contain(key.ModShortcut) && strings.EqualFold(ke.Name, "z") {
+					if ke.Modifiers.Contain(key.ModShift) {
+						c.history.redo(c)
+					} else {
+						c.history.undo(c)
+					}
+					c.track(false)
+					continue
+				}
+				if ke.Modifiers.Contain(key.ModShortcut) && strings.EqualFold(ke.Name, "v") {
+					// nothing has the focus to paste into, so paste a new matrix
+					clipboard.ReadOp{Tag: "root"}.Add(gtx.Ops)
+					continue
+				}
+				if ke.Modifiers.Contain(key.ModShortcut) && strings.EqualFold(ke.Name, "g") {
+					c.solverPanel.Toggle()
+					continue
+				}
+				if ke.Modifiers.Contain(key.ModShortcut) && strings.EqualFold(ke.Name, "k") {
+					c.whatIfPanel.Toggle()
+					continue
+				}
+				if ke.Modifiers.Contain(key.ModShortcut) && strings.EqualFold(ke.Name, "f") {
+					c.findBar.Toggle()
+					continue
+				}
+				if ke.Modifiers.Contain(key.ModShortcut) && strings.EqualFold(ke.Name, "e") {
+					c.scriptPanel.Toggle(c.scriptSource())
+					continue
+				}
+				if strings.EqualFold(ke.Name, "x") && !c.typing() {
 					c.debug = !c.debug
 				}
 			}
@@ -100,7 +172,12 @@ func (c *Canvas) Update(ops *op.Ops, e system.FrameEvent) {
 
 	stack := clip.Rect(image.Rect(0, 0, e.Size.X, e.Size.Y)).Push(gtx.Ops)
 	c.input.Add(gtx.Ops)
-	c.input.Events(gtx.Metric, gtx.Ops, gtx.Queue, nil, nil, nil, c.secondaryButtonDragEvents(gtx.Dp))
+	c.input.Events(gtx.Metric, gtx.Ops, gtx.Queue, c.blurEvents(), nil, nil, c.secondaryButtonDragEvents(gtx.Dp))
+	if c.blur {
+		// clicking the empty canvas takes the keyboard focus from matrices
+		key.FocusOp{}.Add(gtx.Ops)
+		c.blur = false
+	}
 	activeTool := c.toolbar.GetActiveTool()
 	activeTool.Update(gtx)
 	stack.Pop()
@@ -108,12 +185,14 @@ func (c *Canvas) Update(ops *op.Ops, e system.FrameEvent) {
 	scale := op.Affine(f32.Affine2D{}.Scale(f32.Point{}, f32.Point{X: float32(zoomLevelPx), Y: float32(zoomLevelPx)})).Push(gtx.Ops)
 
 	th := c.theme
+	c.highlightMatches()
 	canvasOff := op.Offset(image.Pt(gtx.Dp(unit.Dp(c.offset.Round().X)), gtx.Dp(unit.Dp(c.offset.Round().Y)))).Push(gtx.Ops)
 	for _, m := range c.matrices {
 		m.Layout(gtx, th, c.debug)
 		m.Update(gtx.Context, c.debug)
 	}
 	canvasOff.Pop()
+	c.track(true)
 
 	selectionBounds := c.pendingSelectionBounds.SwappedBounds()
 	if !selectionBounds.Empty() {
@@ -126,19 +205,131 @@ func (c *Canvas) Update(ops *op.Ops, e system.FrameEvent) {
 	c.toolbar.Layout(gtx.Context, th, c.debug)
 	off.Pop()
 
+	c.scriptPanel.Layout(gtx, th, e.Size)
+	panelsWidth := c.solverPanel.Layout(gtx, th, e.Size)
+	panelsWidth += c.whatIfPanel.Layout(gtx, th, panelsWidth, e.Size, c.scenarios, c.activeScenario)
+	c.findBar.Layout(gtx, th, panelsWidth, e.Size, len(c.finding.matches), c.finding.current)
+
 	for _, e := range gtx.Events() {
 		switch evt := e.(type) {
 		case context.CreateMatrix:
 			if evt.Rows == 0 || evt.Cols == 0 {
 				continue
 			}
-			c.matrices = append(c.matrices, &Matrix[float64]{
-				Pos:   evt.Pos.Div(float32(zoomLevelPx)).Sub(c.offset),
-				Color: color.NRGBA{R: 245, G: 245, B: 245, A: 255},
-				Data:  mat.NewDense(evt.Rows, evt.Cols, make([]float64, evt.Rows*evt.Cols)),
+			m := newMatrix(c.nextMatrixName(), evt.Pos.Div(float32(zoomLevelPx)).Sub(c.offset), mat.NewDense(evt.Rows, evt.Cols, make([]float64, evt.Rows*evt.Cols)))
+			contents, err := pasteContents(parseTSV(evt.Paste), m.Mode)
+			if err != nil {
+				log.Printf("unable to paste cells: %v\n", err)
+			}
+			for pos, content := range contents {
+				m.setContent(pos, content)
+			}
+			c.addMatrix(m)
+		case context.DefineMatrix:
+			if err := c.defineMatrix(evt.Matrix, evt.Name, evt.Expr); err != nil {
+				log.Printf("unable to define matrix: %v\n", err)
+			}
+		case context.SetScript:
+			err := c.SetScript(evt.Src)
+			if err != nil {
+				log.Printf("unable to apply script: %v\n", err)
+			}
+			c.scriptPanel.SetError(err)
+		case context.GoalSeek:
+			if err := c.goalSeek(evt); err != nil {
+				c.solverPanel.SetStatus("", err)
+			}
+		case context.Optimize:
+			if err := c.optimize(evt); err != nil {
+				c.solverPanel.SetStatus("", err)
+			}
+		case context.SaveScenario:
+			err := c.saveScenario(evt.Name, evt.Cells)
+			c.whatIfPanel.SetStatus("saved scenario "+evt.Name, err)
+		case context.ApplyScenario:
+			err := c.applyScenario(evt.Name)
+			c.whatIfPanel.SetStatus("switched to "+evt.Name, err)
+		case context.DataTable:
+			if err := c.dataTable(evt); err != nil {
+				c.whatIfPanel.SetStatus("", err)
+			}
+		case context.ResizeMatrix:
+			if err := c.resizeMatrix(evt); err != nil {
+				log.Printf("unable to resize matrix: %v\n", err)
+			}
+		case context.SetNumericMode:
+			if err := c.setNumericMode(evt); err != nil {
+				log.Printf("unable to switch numeric mode: %v\n", err)
+			}
+		case context.ShiftCells:
+			if err := c.shiftCells(evt); err != nil {
+				log.Printf("unable to insert or delete cells: %v\n", err)
+			}
+		case context.Paste:
+			if err := c.paste(evt); err != nil {
+				log.Printf("unable to paste cells: %v\n", err)
+			}
+		case context.ClearCells:
+			c.clearCells(evt)
+		case context.FillCells:
+			c.fill(evt)
+		case context.FormatCells:
+			if err := c.formatCells(evt); err != nil {
+				log.Printf("unable to format cells: %v\n", err)
+			}
+		case context.StyleCells:
+			if err := c.styleCells(evt); err != nil {
+				log.Printf("unable to style cells: %v\n", err)
+			}
+		case context.LabelHeader:
+			if err := c.labelHeader(evt); err != nil {
+				log.Printf("unable to label header: %v\n", err)
+			}
+		case context.SortRows:
+			if err := c.sortRows(evt); err != nil {
+				log.Printf("unable to sort rows: %v\n", err)
+			}
+		case context.FilterRows:
+			if err := c.filterRows(evt); err != nil {
+				log.Printf("unable to filter rows: %v\n", err)
+			}
+		case context.Find:
+			err := c.find(evt, func(bounds f32x.Rectangle) {
+				c.reveal(bounds, gtx.Constraints.Max, float32(gtx.Dp(1)), zoomLevelPx)
 			})
+			c.findBar.SetStatus("", err)
+			// the matches are highlighted as the matrices are next laid out
+			op.InvalidateOp{}.Add(gtx.Ops)
+		case context.ReplaceAll:
+			n, err := c.replaceAll(evt)
+			c.findBar.SetStatus(fmt.Sprintf("replaced %d cells", n), err)
+		case context.Reveal:
+			c.reveal(evt.Bounds, gtx.Constraints.Max, float32(gtx.Dp(1)), zoomLevelPx)
+		case context.EditCell:
+			if err := c.editCell(evt); err != nil {
+				log.Printf("unable to edit cell: %v\n", err)
+			}
+		case context.RenameMatrix:
+			if err := c.renameMatrix(evt.From, evt.To); err != nil {
+				log.Printf("unable to rename matrix: %v\n", err)
+			}
 		}
 	}
+	// selections moved by the changes above are part of those changes
+	c.track(false)
+
+	c.recalculate()
+}
+
+// typing reports whether keys are going to a cell or a text field, so
+// that unmodified keys are not taken as shortcuts.
+func (c *Canvas) typing() bool {
+	for _, m := range c.matrices {
+		if m.Editing() || (m.nameEditor != nil && m.nameEditor.Focused()) || m.formatting.active || m.styling.active || m.labelling.active || m.sorting.active || m.filtering.active {
+			return true
+		}
+	}
+	return c.scriptPanel.Focused() || c.solverPanel.Focused() || c.whatIfPanel.Focused() || c.findBar.Focused()
 }
 
 func (c *Canvas) pressEvents(dp func(v unit.Dp) int) func(pos f32.Point, buttons pointer.Buttons) {
@@ -153,6 +344,12 @@ func (c *Canvas) pressEvents(dp func(v unit.Dp) int) func(pos f32.Point, buttons
 	}
 }
 
+func (c *Canvas) blurEvents() func(pos f32.Point, buttons pointer.Buttons) {
+	return func(pos f32.Point, buttons pointer.Buttons) {
+		c.blur = buttons == pointer.ButtonPrimary
+	}
+}
+
 func (c *Canvas) releaseEvents(dp func(v unit.Dp) int) func(pos f32.Point, buttons pointer.Buttons) {
 	return func(pos f32.Point, buttons pointer.Buttons) {
 		if buttons == pointer.ButtonPrimary {
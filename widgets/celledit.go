@@ -0,0 +1,415 @@
+package widgets
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+	"time"
+
+	"gioui.org/io/clipboard"
+	"gioui.org/io/event"
+	"gioui.org/io/key"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"github.com/tauraamui/nebula/context"
+	"github.com/tauraamui/nebula/decimal"
+	"github.com/tauraamui/nebula/formula"
+	"github.com/tauraamui/nebula/numfmt"
+	"github.com/tauraamui/nebula/units"
+)
+
+// doubleClickDuration is the longest time between two clicks on a cell
+// for them to open the cell's editor.
+const doubleClickDuration = 400 * time.Millisecond
+
+// cellKeys are the keys a matrix handles while it has the keyboard focus.
+// Those the cell editor does not handle itself also reach the matrix
+// while a cell is being edited.
+var cellKeys = key.Set(strings.Join([]string{
+	key.NameReturn, key.NameEnter, key.NameF2, key.NameEscape,
+	"(Shift)-" + key.NameTab, key.NameDeleteBackward, key.NameDeleteForward,
+	"(Shift)-(Short)-[" + strings.Join([]string{
+		key.NameLeftArrow, key.NameRightArrow, key.NameUpArrow, key.NameDownArrow,
+		key.NameHome, key.NameEnd, key.NamePageUp, key.NamePageDown,
+	}, ",") + "]",
+	"Short-[C,X,V,1,2,3,4,B,I]",
+	"Short-Alt-[" + strings.Join([]string{
+		key.NameLeftArrow, key.NameRightArrow, key.NameUpArrow, key.NameDownArrow,
+	}, ",") + "]",
+	"Short-(Shift)-" + key.NameDeleteBackward,
+}, "|"))
+
+// cellEditing holds the state of a matrix's cell editor.
+type cellEditing struct {
+	editor    *widget.Editor
+	active    bool
+	cell      image.Point
+	hadFocus  bool
+	err       error
+	focus     bool
+	focused   bool
+	lastClick time.Time
+	lastCell  image.Point
+}
+
+func (m *Matrix[T]) keyTag() event.Tag { return &m.editing }
+
+// click records a click on cell, opening its editor when it follows a
+// click on the same cell closely enough to be a double click.
+func (m *Matrix[T]) click(cell image.Point) {
+	now := time.Now()
+	if cell == m.editing.lastCell && now.Sub(m.editing.lastClick) < doubleClickDuration {
+		m.startEditing(cell, m.editText(cell))
+		m.editing.lastClick = time.Time{}
+		return
+	}
+	m.editing.lastClick, m.editing.lastCell = now, cell
+	m.editing.focus = true
+}
+
+// startEditing opens the editor over cell holding text.
+func (m *Matrix[T]) startEditing(cell image.Point, text string) {
+	if m.editing.editor == nil {
+		m.editing.editor = &widget.Editor{SingleLine: true, Submit: true}
+	}
+	m.editing.active = true
+	m.editing.cell = cell
+	m.editing.hadFocus = false
+	m.editing.err = nil
+	m.editing.editor.SetText(text)
+	m.editing.editor.SetCaret(len([]rune(text)), len([]rune(text)))
+	m.editing.editor.Focus()
+	m.selectCell(cell)
+}
+
+// editText returns what the editor of the cell at pos starts with, its
+// formula if it has one and its value otherwise.
+func (m *Matrix[T]) editText(pos image.Point) string {
+	if src, ok := m.Formula(pos); ok {
+		return "=" + src
+	}
+	return m.valueText(pos)
+}
+
+// Editing reports whether a cell of the matrix is being edited or the
+// matrix has the keyboard focus, so that typing is meant for it.
+func (m *Matrix[T]) Editing() bool {
+	return m.editing.active || m.editing.focused
+}
+
+// selectedCellPos returns the cell typing is directed to.
+func (m *Matrix[T]) selectedCellPos() (image.Point, bool) {
+	if len(m.SelectedCells) == 0 {
+		return image.Point{}, false
+	}
+	return m.SelectedCells[0], true
+}
+
+// layoutCellEditing handles the keys sent to the matrix and lays out the
+// cell editor over the cell being edited. It must be called within the
+// matrix's area so that keys the editor ignores reach the matrix.
+func (m *Matrix[T]) layoutCellEditing(gtx *context.Context, th *material.Theme) {
+	for _, e := range gtx.Queue.Events(m.keyTag()) {
+		switch e := e.(type) {
+		case key.FocusEvent:
+			m.editing.focused = e.Focus
+		case key.EditEvent:
+			if cell, ok := m.selectedCellPos(); ok && !m.editing.active {
+				m.startEditing(cell, e.Text)
+			}
+		case key.Event:
+			if e.State == key.Press {
+				m.handleCellKey(gtx, e)
+			}
+		case clipboard.Event:
+			if area, ok := m.selectionBounds(); ok {
+				gtx.PushEvent(context.Paste{Matrix: m.Name, Cell: area.Min, Text: e.Text})
+			}
+		}
+	}
+
+	// keys are only taken while focused, so that those meant for the
+	// canvas are not caught by a matrix the pointer happens to be over
+	var keys key.Set
+	if m.Editing() || m.editing.focus {
+		keys = cellKeys
+	}
+	key.InputOp{Tag: m.keyTag(), Keys: keys}.Add(gtx.Ops)
+	if m.editing.focus {
+		key.FocusOp{Tag: m.keyTag()}.Add(gtx.Ops)
+		m.editing.focus = false
+	}
+
+	if !m.editing.active {
+		return
+	}
+	ed := m.editing.editor
+	for _, e := range ed.Events() {
+		if _, ok := e.(widget.SubmitEvent); ok {
+			m.commitEdit(gtx, image.Point{})
+		}
+	}
+	if !m.editing.active {
+		return
+	}
+	if ed.Focused() {
+		m.editing.hadFocus = true
+	} else if m.editing.hadFocus {
+		// the focus moved elsewhere, keep what was typed if it is valid
+		if m.commitEdit(gtx, image.Point{}) != nil {
+			m.editing.active = false
+		}
+		return
+	}
+
+	if rows, cols := m.Data.Dims(); m.editing.cell.X >= cols || m.editing.cell.Y >= rows {
+		m.editing.active = false
+		return
+	}
+	cell := m.grid().px(gtx.Dp, m.editing.cell)
+	bgnd := clip.Rect(cell).Push(gtx.Ops)
+	paint.ColorOp{Color: color.NRGBA{R: 255, G: 255, B: 255, A: 255}}.Add(gtx.Ops)
+	paint.PaintOp{}.Add(gtx.Ops)
+	bgnd.Pop()
+
+	off := op.Offset(cell.Min.Add(image.Pt(gtx.Sp(3), (cell.Dy()-gtx.Sp(14))/2))).Push(gtx.Ops)
+	egtx := gtx.Context
+	egtx.Constraints = layout.Exact(image.Pt(cell.Dx()-gtx.Sp(3), gtx.Sp(16)))
+	e := material.Editor(th, ed, "")
+	e.TextSize = unit.Sp(14)
+	e.Color = color.NRGBA{R: 10, G: 10, B: 10, A: 255}
+	e.Layout(egtx)
+	off.Pop()
+
+	borderColor := color.NRGBA{R: 60, G: 120, B: 230, A: 255}
+	if m.editing.err != nil {
+		borderColor = color.NRGBA{R: 230, G: 90, B: 90, A: 255}
+		renderTooltip(gtx, m.editing.err.Error(), image.Pt(cell.Min.X, cell.Max.Y+gtx.Dp(2)), th)
+	}
+	border := clip.Stroke{Path: clip.RRect{Rect: cell}.Path(gtx.Ops), Width: 2 * float32(gtx.Dp(1))}.Op().Push(gtx.Ops)
+	paint.ColorOp{Color: borderColor}.Add(gtx.Ops)
+	paint.PaintOp{}.Add(gtx.Ops)
+	border.Pop()
+}
+
+func (m *Matrix[T]) handleCellKey(gtx *context.Context, e key.Event) {
+	cell, ok := m.selectedCellPos()
+	if m.editing.active {
+		cell, ok = m.editing.cell, true
+	}
+	if !ok {
+		return
+	}
+	switch e.Name {
+	case key.NameEscape:
+		if m.editing.active {
+			m.editing.active = false
+			m.editing.focus = true
+		}
+	case key.NameTab:
+		step := image.Pt(1, 0)
+		if e.Modifiers.Contain(key.ModShift) {
+			step = image.Pt(-1, 0)
+		}
+		if m.editing.active && m.commitEdit(gtx, step) != nil {
+			return
+		}
+		if !m.editing.active {
+			m.selectCell(m.nextCell(cell, step))
+		}
+	case key.NameReturn, key.NameEnter, key.NameF2:
+		if !m.editing.active {
+			m.startEditing(cell, m.editText(cell))
+		}
+	case key.NameDeleteBackward, key.NameDeleteForward:
+		if e.Modifiers.Contain(key.ModShortcut) {
+			m.deleteSelected(gtx, !e.Modifiers.Contain(key.ModShift))
+			return
+		}
+		if !m.editing.active {
+			gtx.PushEvent(context.ClearCells{Matrix: m.Name, Cells: append([]image.Point(nil), m.SelectedCells...)})
+		}
+	case "C":
+		m.copySelection(gtx)
+	case "X":
+		if m.copySelection(gtx) {
+			gtx.PushEvent(context.ClearCells{Matrix: m.Name, Cells: append([]image.Point(nil), m.SelectedCells...)})
+		}
+	case "V":
+		clipboard.ReadOp{Tag: m.keyTag()}.Add(gtx.Ops)
+	case "1":
+		m.openFormat()
+	case "2":
+		m.openStyle()
+	case "3":
+		m.openSort()
+	case "4":
+		m.openFilter()
+	case "B":
+		m.toggleStyle(gtx, "bold", "regular")
+	case "I":
+		m.toggleStyle(gtx, "italic", "upright")
+	default:
+		if e.Modifiers.Contain(key.ModShortcut | key.ModAlt) {
+			m.insertBeside(gtx, e.Name)
+			return
+		}
+		// keys the editor leaves alone, such as PageUp, close it first
+		if m.editing.active && m.commitEdit(gtx, image.Point{}) != nil {
+			return
+		}
+		m.navigate(gtx, e)
+	}
+}
+
+// commitEdit closes the editor, asking the canvas to store what was
+// typed, then moves the selection by step. Text which cannot be stored
+// keeps the editor open and is returned as an error.
+func (m *Matrix[T]) commitEdit(gtx *context.Context, step image.Point) error {
+	text := m.editing.editor.Text()
+	if _, err := parseCellContent(text, m.Mode); err != nil {
+		m.editing.err = err
+		return err
+	}
+	m.editing.active = false
+	m.editing.focus = true
+	gtx.PushEvent(context.EditCell{Matrix: m.Name, Cell: m.editing.cell, Text: text})
+	m.selectCell(m.nextCell(m.editing.cell, step))
+	return nil
+}
+
+// nextCell returns the cell step away from cell, wrapping onto the next
+// or previous row at the edges of the matrix.
+func (m *Matrix[T]) nextCell(cell, step image.Point) image.Point {
+	rows, cols := m.Data.Dims()
+	i := cell.Y*cols + cell.X + step.Y*cols + step.X
+	if i < 0 || i >= rows*cols {
+		return cell
+	}
+	return image.Pt(i%cols, i/cols)
+}
+
+// cellContent is what a cell holds: a formula, or a value with an
+// optional unit. A date is a value counting days, shown in a date format.
+type cellContent struct {
+	formula string
+	value   float64
+	decimal *decimal.Decimal
+	unit    *units.Unit
+	date    bool
+}
+
+// parseCellContent parses text typed into a cell. Text starting with =
+// is a formula, otherwise it must be a number, optionally followed by a
+// unit, or a date such as 2024-01-31. Empty text clears the cell.
+func parseCellContent(text string, mode NumericMode) (cellContent, error) {
+	text = strings.TrimSpace(text)
+	switch {
+	case text == "":
+		return cellContent{}, nil
+	case strings.HasPrefix(text, "="):
+		if _, err := formula.Parse(text); err != nil {
+			return cellContent{}, err
+		}
+		return cellContent{formula: text}, nil
+	}
+	if f, err := strconv.ParseFloat(text, 64); err == nil {
+		c := cellContent{value: f}
+		if mode == DecimalMode {
+			if d, err := decimal.Parse(text); err == nil {
+				c.decimal = &d
+			}
+		}
+		return c, nil
+	}
+	if v, ok := numfmt.ParseDate(text); ok {
+		c := cellContent{value: v, date: true}
+		if mode == DecimalMode {
+			d := decimal.New(int64(v), 0)
+			c.decimal = &d
+		}
+		return c, nil
+	}
+	if v, u, ok := units.ParseQuantity(text); ok {
+		return cellContent{value: v, unit: &u}, nil
+	}
+	return cellContent{}, fmt.Errorf("%q is not a number, quantity, date or formula", text)
+}
+
+// content returns what the cell at pos holds.
+func (m *Matrix[T]) content(pos image.Point) cellContent {
+	c := cellContent{value: m.Data.At(pos.Y, pos.X)}
+	if src, ok := m.Formula(pos); ok {
+		c.formula = "=" + src
+	}
+	if m.decimals != nil {
+		d := m.decimals.At(pos.Y, pos.X)
+		c.decimal = &d
+	}
+	if u, ok := m.cellUnits[pos]; ok {
+		c.unit = &u
+	}
+	if f, ok := m.format(pos); ok && f.IsDate() {
+		c.date = true
+	}
+	return c
+}
+
+// setContent stores c in the cell at pos. A date is given the ISO date
+// format unless the cell already shows dates.
+func (m *Matrix[T]) setContent(pos image.Point, c cellContent) {
+	if c.formula != "" {
+		m.SetFormula(pos, c.formula)
+		return
+	}
+	if c.decimal != nil {
+		m.SetDecimal(pos, *c.decimal)
+	} else {
+		m.SetValue(pos, c.value)
+	}
+	m.setUnit(pos, c.unit)
+	if f, _ := m.format(pos); c.date && !f.IsDate() {
+		m.setFormat([]image.Point{pos}, numfmt.ISODate)
+	}
+}
+
+// contentChange replaces what a cell holds.
+type contentChange struct {
+	m             *Matrix[float64]
+	pos           image.Point
+	before, after cellContent
+}
+
+func (ch contentChange) undo(*Canvas) { ch.m.setContent(ch.pos, ch.before) }
+func (ch contentChange) redo(*Canvas) { ch.m.setContent(ch.pos, ch.after) }
+
+// editCell stores the text typed into a cell, as a change which can be
+// undone. Cells of matrices derived from an expression cannot be edited,
+// as the expression would overwrite them.
+func (c *Canvas) editCell(evt context.EditCell) error {
+	m := c.matrixByName(evt.Matrix)
+	if m == nil {
+		return fmt.Errorf("no matrix named %q", evt.Matrix)
+	}
+	if rows, cols := m.Data.Dims(); evt.Cell.X >= cols || evt.Cell.Y >= rows {
+		return fmt.Errorf("cell %s is outside %s", cellName(evt.Cell), m.Name)
+	}
+	if m.expr != nil {
+		return fmt.Errorf("%s is derived from an expression, its cells cannot be edited", m.Name)
+	}
+	after, err := parseCellContent(evt.Text, m.Mode)
+	if err != nil {
+		return err
+	}
+	ch := contentChange{m: m, pos: evt.Cell, before: m.content(evt.Cell), after: after}
+	ch.redo(c)
+	c.history.push(ch)
+	return nil
+}
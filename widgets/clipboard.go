@@ -0,0 +1,216 @@
+package widgets
+
+import (
+	"encoding/csv"
+	"fmt"
+	"image"
+	"strings"
+
+	"gioui.org/io/clipboard"
+	"github.com/tauraamui/nebula/context"
+	"github.com/tauraamui/nebula/numfmt"
+)
+
+// selectionBounds returns the smallest area of cells covering the
+// selection.
+func (m *Matrix[T]) selectionBounds() (image.Rectangle, bool) {
+	if len(m.SelectedCells) == 0 {
+		return image.Rectangle{}, false
+	}
+	var r image.Rectangle
+	for i, pos := range m.SelectedCells {
+		cell := image.Rectangle{Min: pos, Max: pos.Add(image.Pt(1, 1))}
+		if i == 0 {
+			r = cell
+			continue
+		}
+		r = r.Union(cell)
+	}
+	return r, true
+}
+
+// copySelection writes the values of the selected cells to the clipboard,
+// as they are displayed, as tab separated values with a row per line.
+// Cells within the selection's bounds which are not selected are left
+// empty. Gio's clipboard.WriteOp only carries plain text, so no HTML
+// table is offered alongside; spreadsheets read tab separated text as
+// cells anyway.
+func (m *Matrix[T]) copySelection(gtx *context.Context) bool {
+	area, ok := m.selectionBounds()
+	if !ok {
+		return false
+	}
+	selected := map[image.Point]bool{}
+	for _, pos := range m.SelectedCells {
+		selected[pos] = true
+	}
+	var b strings.Builder
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			if x > area.Min.X {
+				b.WriteByte('\t')
+			}
+			if pos := image.Pt(x, y); selected[pos] {
+				b.WriteString(m.copyText(pos))
+			}
+		}
+		b.WriteByte('\n')
+	}
+	clipboard.WriteOp{Text: b.String()}.Add(gtx.Ops)
+	return true
+}
+
+// copyText returns what is copied from the cell at pos, its error code
+// if it has one and its displayed value otherwise.
+func (m *Matrix[T]) copyText(pos image.Point) string {
+	if err, ok := m.errs[pos]; ok {
+		return err.Code
+	}
+	return m.cellText(pos)
+}
+
+// parseTSV splits text copied from a spreadsheet into rows of cells.
+// Quoted cells may hold tabs and line breaks.
+func parseTSV(text string) [][]string {
+	r := csv.NewReader(strings.NewReader(text))
+	r.Comma = '\t'
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	var rows [][]string
+	for {
+		row, err := r.Read()
+		if err != nil {
+			break
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// tsvSize returns the number of rows and columns rows spans.
+func tsvSize(rows [][]string) (int, int) {
+	cols := 0
+	for _, row := range rows {
+		if len(row) > cols {
+			cols = len(row)
+		}
+	}
+	return len(rows), cols
+}
+
+// pasteContents parses the cells of rows, in the numeric mode of the
+// matrix they are pasted into. Numbers may be formatted, as copied cells
+// are, with thousands separators, percentages or currency symbols. Cells
+// which are not numbers, quantities or formulas, such as headings or
+// error codes, are left out and reported in the error returned.
+func pasteContents(rows [][]string, mode NumericMode) (map[image.Point]cellContent, error) {
+	contents := map[image.Point]cellContent{}
+	var skipped []string
+	var first error
+	for y, row := range rows {
+		for x, text := range row {
+			c, err := parseCellContent(text, mode)
+			if plain, ok := numfmt.Unformat(text); err != nil && ok {
+				c, err = parseCellContent(plain, mode)
+			}
+			if err != nil {
+				if first == nil {
+					first = err
+				}
+				skipped = append(skipped, cellName(image.Pt(x, y)))
+				continue
+			}
+			contents[image.Pt(x, y)] = c
+		}
+	}
+	if len(skipped) > 0 {
+		return contents, fmt.Errorf("%s not pasted: %w", strings.Join(skipped, ", "), first)
+	}
+	return contents, nil
+}
+
+// cellsChange replaces what a number of cells hold, growing the matrix to
+// fit them and shrinking it back when undone.
+type cellsChange struct {
+	m                *Matrix[float64]
+	before, after    map[image.Point]cellContent
+	rows, cols       int
+	newRows, newCols int
+}
+
+func (ch cellsChange) undo(c *Canvas) {
+	for pos, content := range ch.before {
+		ch.m.setContent(pos, content)
+	}
+	if rows, cols := ch.m.Data.Dims(); rows != ch.rows || cols != ch.cols {
+		ch.m.resize(ch.rows, ch.cols)
+		c.rebuildGraph()
+	}
+}
+
+func (ch cellsChange) redo(*Canvas) {
+	ch.m.grow(ch.newRows, ch.newCols)
+	for pos, content := range ch.after {
+		ch.m.setContent(pos, content)
+	}
+}
+
+// setCells stores contents in m, as a change which can be undone.
+func (c *Canvas) setCells(m *Matrix[float64], contents map[image.Point]cellContent) {
+	ch := newCellsChange(m, contents)
+	ch.redo(c)
+	c.history.push(ch)
+}
+
+// newCellsChange returns the change storing contents in m.
+func newCellsChange(m *Matrix[float64], contents map[image.Point]cellContent) cellsChange {
+	rows, cols := m.Data.Dims()
+	ch := cellsChange{m: m, before: map[image.Point]cellContent{}, after: contents, rows: rows, cols: cols, newRows: rows, newCols: cols}
+	for pos := range contents {
+		if pos.X >= ch.newCols {
+			ch.newCols = pos.X + 1
+		}
+		if pos.Y >= ch.newRows {
+			ch.newRows = pos.Y + 1
+		}
+		if pos.X < cols && pos.Y < rows {
+			ch.before[pos] = m.content(pos)
+		}
+	}
+	return ch
+}
+
+// paste writes the cells copied to the clipboard into a matrix, with the
+// top left copied cell at the selected cell. Cells which cannot be
+// parsed are left as they were and reported in the error returned.
+func (c *Canvas) paste(evt context.Paste) error {
+	m := c.matrixByName(evt.Matrix)
+	if m == nil {
+		return fmt.Errorf("no matrix named %q", evt.Matrix)
+	}
+	pasted, err := pasteContents(parseTSV(evt.Text), m.Mode)
+	contents := map[image.Point]cellContent{}
+	for pos, content := range pasted {
+		contents[pos.Add(evt.Cell)] = content
+	}
+	if len(contents) > 0 {
+		c.setCells(m, contents)
+	}
+	return err
+}
+
+// clearCells empties cells, as a change which can be undone.
+func (c *Canvas) clearCells(evt context.ClearCells) {
+	m := c.matrixByName(evt.Matrix)
+	if m == nil {
+		return
+	}
+	rows, cols := m.Data.Dims()
+	contents := map[image.Point]cellContent{}
+	for _, pos := range evt.Cells {
+		if pos.X < cols && pos.Y < rows {
+			contents[pos] = cellContent{}
+		}
+	}
+	c.setCells(m, contents)
+}
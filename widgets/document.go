@@ -0,0 +1,398 @@
+package widgets
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"gioui.org/f32"
+	"gioui.org/unit"
+	"github.com/tauraamui/nebula/decimal"
+	"github.com/tauraamui/nebula/formula"
+	"github.com/tauraamui/nebula/numfmt"
+	"github.com/tauraamui/nebula/script"
+	"github.com/tauraamui/nebula/units"
+	"gonum.org/v1/gonum/mat"
+)
+
+const defaultDocumentPath = "nebula.json"
+
+type document struct {
+	Matrices       []matrixDocument   `json:"matrices"`
+	Script         string             `json:"script,omitempty"`
+	Scenarios      []scenarioDocument `json:"scenarios,omitempty"`
+	ActiveScenario string             `json:"activeScenario,omitempty"`
+}
+
+// scenarioDocument holds a scenario's values keyed by cells written as
+// matrix1!A1.
+type scenarioDocument struct {
+	Name   string             `json:"name"`
+	Values map[string]float64 `json:"values"`
+}
+
+type matrixDocument struct {
+	Name      string                `json:"name"`
+	Pos       f32.Point             `json:"pos"`
+	Rows      int                   `json:"rows"`
+	Cols      int                   `json:"cols"`
+	Data      []float64             `json:"data"`
+	Formulas  map[string]string     `json:"formulas,omitempty"`
+	Units     map[string]units.Unit `json:"units,omitempty"`
+	Expr      string                `json:"expr,omitempty"`
+	Mode      string                `json:"mode,omitempty"`
+	Precision int                   `json:"precision,omitempty"`
+	Decimals  []decimal.Decimal     `json:"decimals,omitempty"`
+	// ColWidths and RowHeights hold the sizes in dp of the columns and
+	// rows which are not the default size, by index.
+	ColWidths  map[int]float32 `json:"colWidths,omitempty"`
+	RowHeights map[int]float32 `json:"rowHeights,omitempty"`
+	// ColFormats and Formats hold the number formats of columns, by
+	// index, and of cells, written as A1.
+	ColFormats map[int]string    `json:"colFormats,omitempty"`
+	Formats    map[string]string `json:"formats,omitempty"`
+	// Styles holds the styled ranges of cells in the order they apply.
+	Styles []styleDocument `json:"styles,omitempty"`
+	// Headers is set if the headers are shown, and ColLabels and
+	// RowLabels hold the labels of columns and rows, by index.
+	Headers   bool           `json:"headers,omitempty"`
+	ColLabels map[int]string `json:"colLabels,omitempty"`
+	RowLabels map[int]string `json:"rowLabels,omitempty"`
+	// Filter is the condition rows are filtered by, and Hidden the rows
+	// it hid.
+	Filter string `json:"filter,omitempty"`
+	Hidden []int  `json:"hidden,omitempty"`
+}
+
+// styleDocument holds a styled range of cells, written as A1:B2.
+type styleDocument struct {
+	Range string `json:"range"`
+	cellStyle
+}
+
+const decimalModeName = "decimal"
+
+func newMatrix(name string, pos f32.Point, data *mat.Dense) *Matrix[float64] {
+	return &Matrix[float64]{
+		Name:  name,
+		Pos:   pos,
+		Color: color.NRGBA{R: 245, G: 245, B: 245, A: 255},
+		Data:  data,
+	}
+}
+
+// Open loads the document at path onto the canvas, which is then saved
+// back to path. A path which does not exist yet leaves the canvas as is.
+func (c *Canvas) Open(path string) error {
+	c.path = path
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	return c.Load(f)
+}
+
+// Save writes the canvas to the path it was opened from.
+func (c *Canvas) Save() error {
+	path := c.path
+	if path == "" {
+		path = defaultDocumentPath
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := c.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Write encodes every matrix on the canvas as JSON to w.
+func (c *Canvas) Write(w io.Writer) error {
+	doc := document{Script: c.scriptSource(), ActiveScenario: c.activeScenario}
+	for _, s := range c.scenarios {
+		sd := scenarioDocument{Name: s.Name, Values: map[string]float64{}}
+		for id, v := range s.Values {
+			sd.Values[cellID(id)] = v
+		}
+		doc.Scenarios = append(doc.Scenarios, sd)
+	}
+	for _, m := range c.matrices {
+		rows, cols := m.Data.Dims()
+		md := matrixDocument{
+			Name: m.Name,
+			Pos:  m.Pos,
+			Rows: rows,
+			Cols: cols,
+			Data: make([]float64, 0, rows*cols),
+		}
+		// cells spilled into by array formulas are left empty, they are
+		// filled again when the formulas are evaluated on load
+		for i := 0; i < rows; i++ {
+			for j := 0; j < cols; j++ {
+				v := m.Data.At(i, j)
+				if m.spilledInto(image.Pt(j, i)) {
+					v = 0
+				}
+				md.Data = append(md.Data, v)
+			}
+		}
+		if m.expr != nil {
+			md.Expr = formula.Format(m.expr)
+		}
+		if m.decimals != nil {
+			md.Mode = decimalModeName
+			md.Precision = m.Precision
+			for i := 0; i < rows; i++ {
+				for j := 0; j < cols; j++ {
+					d := m.decimals.At(i, j)
+					if m.spilledInto(image.Pt(j, i)) {
+						d = decimal.New(0, 0)
+					}
+					md.Decimals = append(md.Decimals, d)
+				}
+			}
+		}
+		for pos := range m.formulas {
+			if md.Formulas == nil {
+				md.Formulas = map[string]string{}
+			}
+			src, _ := m.Formula(pos)
+			md.Formulas[cellName(pos)] = src
+		}
+		for pos, u := range m.cellUnits {
+			if m.spilledInto(pos) {
+				continue
+			}
+			if md.Units == nil {
+				md.Units = map[string]units.Unit{}
+			}
+			md.Units[cellName(pos)] = u
+		}
+		md.ColWidths = saveSizes(m.colWidths)
+		md.RowHeights = saveSizes(m.rowHeights)
+		for x, f := range m.colFormats {
+			if md.ColFormats == nil {
+				md.ColFormats = map[int]string{}
+			}
+			md.ColFormats[x] = f.String()
+		}
+		for pos, f := range m.cellFormats {
+			if md.Formats == nil {
+				md.Formats = map[string]string{}
+			}
+			md.Formats[cellName(pos)] = f.String()
+		}
+		for _, r := range m.styles {
+			name := cellName(r.Area.Min) + ":" + cellName(r.Area.Max.Sub(image.Pt(1, 1)))
+			md.Styles = append(md.Styles, styleDocument{Range: name, cellStyle: r.Style})
+		}
+		md.Headers = m.headers
+		if len(m.colLabels) > 0 {
+			md.ColLabels = copyIndexed(m.colLabels)
+		}
+		if len(m.rowLabels) > 0 {
+			md.RowLabels = copyIndexed(m.rowLabels)
+		}
+		if m.filter != nil {
+			md.Filter = formula.Format(m.filter)
+			for y := range m.hidden {
+				md.Hidden = append(md.Hidden, y)
+			}
+			sort.Ints(md.Hidden)
+		}
+		doc.Matrices = append(doc.Matrices, md)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// Load replaces every matrix on the canvas with those decoded from r.
+func (c *Canvas) Load(r io.Reader) error {
+	var doc document
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return err
+	}
+
+	matrices := make([]*Matrix[float64], 0, len(doc.Matrices))
+	for _, md := range doc.Matrices {
+		if md.Rows <= 0 || md.Cols <= 0 || len(md.Data) != md.Rows*md.Cols {
+			return fmt.Errorf("matrix %q has malformed data", md.Name)
+		}
+		m := newMatrix(md.Name, md.Pos, mat.NewDense(md.Rows, md.Cols, md.Data))
+		if md.Mode == decimalModeName {
+			if md.Decimals != nil && len(md.Decimals) != md.Rows*md.Cols {
+				return fmt.Errorf("matrix %q has malformed decimal data", md.Name)
+			}
+			m.SetNumericMode(DecimalMode, md.Precision)
+			for i, d := range md.Decimals {
+				m.setNumber(image.Pt(i%md.Cols, i/md.Cols), d.Float64(), &d)
+			}
+		}
+		if md.Expr != "" {
+			n, err := formula.Parse(md.Expr)
+			if err != nil {
+				return fmt.Errorf("matrix %q: %w", md.Name, err)
+			}
+			m.expr = n
+		}
+		for name, src := range md.Formulas {
+			pos, err := parseCellName(name)
+			if err != nil {
+				return fmt.Errorf("matrix %q: %w", md.Name, err)
+			}
+			if err := m.SetFormula(pos, src); err != nil {
+				return fmt.Errorf("matrix %q cell %s: %w", md.Name, name, err)
+			}
+		}
+		for name, u := range md.Units {
+			pos, err := parseCellName(name)
+			if err != nil {
+				return fmt.Errorf("matrix %q: %w", md.Name, err)
+			}
+			u := u
+			m.setUnit(pos, &u)
+		}
+		for x, w := range md.ColWidths {
+			if x >= 0 && x < md.Cols {
+				m.setColWidth(x, unit.Dp(w))
+			}
+		}
+		for y, h := range md.RowHeights {
+			if y >= 0 && y < md.Rows {
+				m.setRowHeight(y, unit.Dp(h))
+			}
+		}
+		for x, pattern := range md.ColFormats {
+			f, err := numfmt.Parse(pattern)
+			if err != nil {
+				return fmt.Errorf("matrix %q column %d: %w", md.Name, x, err)
+			}
+			if x >= 0 && x < md.Cols {
+				m.setFormat(columnCells(x, md.Rows), f)
+			}
+		}
+		for name, pattern := range md.Formats {
+			pos, err := parseCellName(name)
+			if err != nil {
+				return fmt.Errorf("matrix %q: %w", md.Name, err)
+			}
+			f, err := numfmt.Parse(pattern)
+			if err != nil {
+				return fmt.Errorf("matrix %q cell %s: %w", md.Name, name, err)
+			}
+			if pos.X < md.Cols && pos.Y < md.Rows {
+				m.setFormat([]image.Point{pos}, f)
+			}
+		}
+		for _, sd := range md.Styles {
+			from, to, _ := strings.Cut(sd.Range, ":")
+			min, err := parseCellName(from)
+			if err != nil {
+				return fmt.Errorf("matrix %q: %w", md.Name, err)
+			}
+			max, err := parseCellName(to)
+			if err != nil {
+				return fmt.Errorf("matrix %q: %w", md.Name, err)
+			}
+			area := image.Rectangle{Min: min, Max: max.Add(image.Pt(1, 1))}
+			m.styles = append(m.styles, styledRange{Area: area, Style: sd.cellStyle})
+		}
+		m.styles = clipStyles(m.styles, md.Rows, md.Cols)
+		m.headers = md.Headers
+		for x, l := range md.ColLabels {
+			if x >= 0 && x < md.Cols {
+				m.setLabel(header{index: x}, l)
+			}
+		}
+		for y, l := range md.RowLabels {
+			if y >= 0 && y < md.Rows {
+				m.setLabel(header{row: true, index: y}, l)
+			}
+		}
+		if md.Filter != "" {
+			n, err := formula.Parse(md.Filter)
+			if err != nil {
+				return fmt.Errorf("matrix %q filter: %w", md.Name, err)
+			}
+			m.filter = n
+			for _, y := range md.Hidden {
+				if y >= 0 && y < md.Rows {
+					if m.hidden == nil {
+						m.hidden = map[int]struct{}{}
+					}
+					m.hidden[y] = struct{}{}
+				}
+			}
+		}
+		matrices = append(matrices, m)
+	}
+
+	var prog *script.Program
+	if doc.Script != "" {
+		p, err := script.Compile(doc.Script, script.DefaultLimits)
+		if err != nil {
+			return fmt.Errorf("document script: %w", err)
+		}
+		prog = p
+	}
+
+	scenarios := make([]Scenario, 0, len(doc.Scenarios))
+	for _, sd := range doc.Scenarios {
+		s := Scenario{Name: sd.Name, Values: map[formula.CellID]float64{}}
+		for name, v := range sd.Values {
+			matrix, cell, ok := strings.Cut(name, "!")
+			pos, err := parseCellName(cell)
+			if !ok || err != nil {
+				return fmt.Errorf("scenario %q has invalid cell %q", sd.Name, name)
+			}
+			s.Values[formula.CellID{Matrix: matrix, Row: pos.Y, Col: pos.X}] = v
+		}
+		scenarios = append(scenarios, s)
+	}
+
+	c.matrices = matrices
+	c.script = prog
+	c.scenarios = scenarios
+	c.activeScenario = doc.ActiveScenario
+	c.history = history{limit: c.history.limit}
+	c.rebuildGraph()
+	return nil
+}
+
+func cellName(pos image.Point) string {
+	return formula.CellRef{Row: pos.Y, Col: pos.X}.String()
+}
+
+func parseCellName(name string) (image.Point, error) {
+	ref, ok := formula.ParseCellRef(name)
+	if !ok {
+		return image.Point{}, fmt.Errorf("invalid cell %q", name)
+	}
+	return image.Pt(ref.Col, ref.Row), nil
+}
+
+func saveSizes(sizes map[int]unit.Dp) map[int]float32 {
+	if len(sizes) == 0 {
+		return nil
+	}
+	saved := make(map[int]float32, len(sizes))
+	for i, v := range sizes {
+		saved[i] = float32(v)
+	}
+	return saved
+}
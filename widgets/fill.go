@@ -0,0 +1,476 @@
+package widgets
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"gioui.org/f32"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget/material"
+	"github.com/tauraamui/nebula/context"
+	"github.com/tauraamui/nebula/decimal"
+	"github.com/tauraamui/nebula/formula"
+	"github.com/tauraamui/nebula/gesturex"
+	"github.com/tauraamui/nebula/numfmt"
+)
+
+// fillHandleSize is the size of the square at the bottom right corner of
+// the selection which is dragged to fill cells.
+const fillHandleSize unit.Dp = 7
+
+// filling holds the state of the fill handle being dragged.
+type filling struct {
+	input  *gesturex.InputEvents
+	active bool
+	// at is where the pointer is in dp, relative to the matrix
+	at             f32.Point
+	source, target image.Rectangle
+	done           bool
+}
+
+// layoutFill draws the fill handle and, while it is dragged, the cells
+// which will be filled with a preview of what they will hold. It asks
+// for the fill once the handle is released.
+func (m *Matrix[T]) layoutFill(gtx *context.Context, th *material.Theme) {
+	f := &m.filling
+	if f.done {
+		f.done = false
+		if f.target != f.source {
+			gtx.PushEvent(context.FillCells{Matrix: m.Name, From: f.source, To: f.target})
+		}
+	}
+	area, ok := m.fillHandle(gtx.Dp)
+	if !ok || m.editing.active {
+		return
+	}
+	handle := clip.Rect(area).Push(gtx.Ops)
+	paint.ColorOp{Color: color.NRGBA{R: 230, G: 90, B: 90, A: 255}}.Add(gtx.Ops)
+	paint.PaintOp{}.Add(gtx.Ops)
+	handle.Pop()
+
+	if !f.active || f.target == f.source {
+		return
+	}
+	g := m.grid()
+	contents := m.fillContents(f.source, f.target)
+	for pos, c := range contents {
+		if m.RowHidden(pos.Y) {
+			continue
+		}
+		cell := fillCellPx(g, gtx.Dp, pos)
+		l := material.Label(th, unit.Sp(14), c.text())
+		l.Color = color.NRGBA{R: 90, G: 90, B: 90, A: 255}
+		off := op.Offset(cell.Min.Add(image.Pt(gtx.Sp(3), (cell.Dy()-gtx.Sp(14))/2))).Push(gtx.Ops)
+		l.Layout(gtx.Context)
+		off.Pop()
+	}
+	outline := fillCellPx(g, gtx.Dp, f.target.Min).Union(fillCellPx(g, gtx.Dp, f.target.Max.Sub(image.Pt(1, 1))))
+	border := clip.Stroke{Path: clip.RRect{Rect: outline}.Path(gtx.Ops), Width: 2 * float32(gtx.Dp(1))}.Op().Push(gtx.Ops)
+	paint.ColorOp{Color: color.NRGBA{R: 230, G: 90, B: 90, A: 160}}.Add(gtx.Ops)
+	paint.PaintOp{}.Add(gtx.Ops)
+	border.Pop()
+}
+
+// fillHandle returns the area of the fill handle in pixels, relative to
+// the matrix, reporting false when nothing is selected.
+func (m *Matrix[T]) fillHandle(dp func(v unit.Dp) int) (image.Rectangle, bool) {
+	bounds, ok := m.selectionBounds()
+	if !ok {
+		return image.Rectangle{}, false
+	}
+	rows, cols := m.Data.Dims()
+	if bounds.Max.X > cols || bounds.Max.Y > rows {
+		return image.Rectangle{}, false
+	}
+	corner := m.grid().px(dp, bounds.Max.Sub(image.Pt(1, 1))).Max
+	half := dp(fillHandleSize) / 2
+	return image.Rectangle{Min: corner.Sub(image.Pt(half, half)), Max: corner.Add(image.Pt(half, half))}, true
+}
+
+// fillCellPx returns the area of the cell at pos in pixels, which unlike
+// grid.px may be beyond the matrix's last row or column.
+func fillCellPx(g grid, dp func(v unit.Dp) int, pos image.Point) image.Rectangle {
+	edge := func(edges []float32, i int, def float32) int {
+		return dp(unit.Dp(extent(edges, i, def)))
+	}
+	return image.Rect(
+		edge(g.xs, pos.X, float32(cellWidth)), edge(g.ys, pos.Y, float32(cellHeight)),
+		edge(g.xs, pos.X+1, float32(cellWidth)), edge(g.ys, pos.Y+1, float32(cellHeight)),
+	)
+}
+
+// layoutFillHandle adds the input of the fill handle. Like the grid line
+// handles it must be added after the matrix's own input to be above it.
+func (m *Matrix[T]) layoutFillHandle(gtx layout.Context, origin image.Point) {
+	f := &m.filling
+	if f.input == nil {
+		f.input = &gesturex.InputEvents{Tag: f}
+	}
+	area, ok := m.fillHandle(gtx.Dp)
+	if !ok {
+		return
+	}
+	stack := clip.Rect(area.Add(origin)).Push(gtx.Ops)
+	f.input.Add(gtx.Ops)
+	f.input.Events(gtx.Metric, gtx.Ops, gtx.Queue, m.fillPressEvents(gtx.Dp), m.fillReleaseEvents(), m.fillDragEvents(gtx.Dp), nil)
+	pointer.CursorCrosshair.Add(gtx.Ops)
+	stack.Pop()
+}
+
+func (m *Matrix[T]) fillPressEvents(dp func(v unit.Dp) int) func(pos f32.Point, buttons pointer.Buttons) {
+	return func(pos f32.Point, buttons pointer.Buttons) {
+		bounds, ok := m.selectionBounds()
+		if !ok {
+			return
+		}
+		f := &m.filling
+		f.active = true
+		f.at = pos.Div(float32(dp(1))).Sub(m.Pos)
+		f.source, f.target = bounds, bounds
+	}
+}
+
+func (m *Matrix[T]) fillDragEvents(dp func(v unit.Dp) int) func(diff f32.Point) {
+	return func(diff f32.Point) {
+		f := &m.filling
+		if !f.active {
+			return
+		}
+		f.at = f.at.Add(diff.Div(float32(dp(1))))
+		f.target = fillTarget(m.grid(), f.source, f.at)
+	}
+}
+
+func (m *Matrix[T]) fillReleaseEvents() func(pos f32.Point, buttons pointer.Buttons) {
+	return func(pos f32.Point, buttons pointer.Buttons) {
+		f := &m.filling
+		if !f.active {
+			return
+		}
+		f.active = false
+		f.done = true
+	}
+}
+
+// fillTarget returns the cells to fill, source extended in the direction
+// the pointer at has been dragged furthest from it to reach it. Cells may
+// be filled beyond the last row or column, growing the matrix, but not
+// before the first.
+func fillTarget(g grid, source image.Rectangle, at f32.Point) image.Rectangle {
+	index := func(edges []float32, v, def float32) int {
+		if v < 0 {
+			return 0
+		}
+		last := edges[len(edges)-1]
+		if v >= last {
+			return len(edges) - 1 + int((v-last)/def)
+		}
+		i, _ := span(edges, v)
+		return i
+	}
+	cell := image.Pt(index(g.xs, at.X, float32(cellWidth)), index(g.ys, at.Y, float32(cellHeight)))
+	beyond := func(i, min, max int) int {
+		switch {
+		case i < min:
+			return min - i
+		case i >= max:
+			return i - max + 1
+		}
+		return 0
+	}
+	dx := beyond(cell.X, source.Min.X, source.Max.X)
+	dy := beyond(cell.Y, source.Min.Y, source.Max.Y)
+	target := source
+	switch {
+	case dy > 0 && dy >= dx:
+		if cell.Y < source.Min.Y {
+			target.Min.Y = cell.Y
+		} else {
+			target.Max.Y = cell.Y + 1
+		}
+	case dx > 0:
+		if cell.X < source.Min.X {
+			target.Min.X = cell.X
+		} else {
+			target.Max.X = cell.X + 1
+		}
+	}
+	return target
+}
+
+// fillContents returns what the cells of target outside source are
+// filled with, each row or column of source extended on its own.
+func (m *Matrix[T]) fillContents(source, target image.Rectangle) map[image.Point]cellContent {
+	contents := map[image.Point]cellContent{}
+	rows := target.Dy() != source.Dy()
+	lines, length, n := source.Dx(), source.Dy(), target.Dy()-source.Dy()
+	if !rows {
+		lines, length, n = source.Dy(), source.Dx(), target.Dx()-source.Dx()
+	}
+	backwards := target.Min != source.Min
+	for line := 0; line < lines; line++ {
+		// at returns the position of the i-th cell of the line, counted
+		// from the source cell furthest from where the fill goes
+		at := func(i int) image.Point {
+			if backwards {
+				i = length - 1 - i
+			}
+			if rows {
+				return image.Pt(source.Min.X+line, source.Min.Y+i)
+			}
+			return image.Pt(source.Min.X+i, source.Min.Y+line)
+		}
+		src := make([]cellContent, length)
+		for i := range src {
+			src[i] = m.content(at(i))
+		}
+		step := image.Pt(0, 1)
+		if !rows {
+			step = image.Pt(1, 0)
+		}
+		if backwards {
+			step = step.Mul(-1)
+		}
+		for i, c := range extendSeries(src, n, step) {
+			contents[at(length+i)] = c
+		}
+	}
+	return contents
+}
+
+// extendSeries returns the n cells following src. Numbers, and quantities
+// of a single unit, which go up by a constant step or ratio continue to
+// do so, and anything else, such as a single cell, repeats as a block.
+// Dates go on by a constant number of days, months or years, a single
+// date a day at a time. Formulas are repeated with their relative
+// references moved by step for each cell they are moved by.
+func extendSeries(src []cellContent, n int, step image.Point) []cellContent {
+	out := make([]cellContent, n)
+	next, ok := dateSeries(src)
+	if !ok {
+		next, ok = numericSeries(src)
+	}
+	if ok {
+		for i := range out {
+			out[i] = next(i + 1)
+		}
+		return out
+	}
+	for i := range out {
+		j := len(src) + i
+		c := src[j%len(src)]
+		if c.formula != "" {
+			moved := step.Mul(j - j%len(src))
+			c.formula = moveFormula(c.formula, moved)
+		}
+		out[i] = c
+	}
+	return out
+}
+
+// numericSeries returns the cell k cells after the last of src if src is
+// a linear or geometric progression of at least two numbers.
+func numericSeries(src []cellContent) (func(k int) cellContent, bool) {
+	if len(src) < 2 {
+		return nil, false
+	}
+	decimals := true
+	for _, c := range src {
+		if c.formula != "" || c.date || !sameUnit(c, src[0]) {
+			return nil, false
+		}
+		decimals = decimals && c.decimal != nil
+	}
+	if decimals {
+		return decimalSeries(src)
+	}
+	last := src[len(src)-1]
+	near := func(a, b float64) bool {
+		return math.Abs(a-b) <= 1e-9*math.Max(1, math.Max(math.Abs(a), math.Abs(b)))
+	}
+
+	diff := src[1].value - src[0].value
+	linear := true
+	for i := 2; i < len(src) && linear; i++ {
+		linear = near(src[i].value-src[i-1].value, diff)
+	}
+	if linear {
+		return func(k int) cellContent {
+			return cellContent{value: last.value + diff*float64(k), unit: last.unit}
+		}, true
+	}
+
+	if src[0].value == 0 {
+		return nil, false
+	}
+	ratio := src[1].value / src[0].value
+	for i := 2; i < len(src); i++ {
+		if src[i-1].value == 0 || !near(src[i].value/src[i-1].value, ratio) {
+			return nil, false
+		}
+	}
+	return func(k int) cellContent {
+		return cellContent{value: last.value * math.Pow(ratio, float64(k)), unit: last.unit}
+	}, true
+}
+
+// decimalSeries is numericSeries for cells holding decimals, which are
+// stepped exactly and kept to the places of the last of src.
+func decimalSeries(src []cellContent) (func(k int) cellContent, bool) {
+	last := *src[len(src)-1].decimal
+	at := func(i int) decimal.Decimal { return *src[i].decimal }
+	cell := func(d decimal.Decimal) cellContent {
+		d = d.Round(last.Scale())
+		return cellContent{value: d.Float64(), decimal: &d, unit: src[0].unit}
+	}
+
+	diff := at(1).Sub(at(0))
+	linear := true
+	for i := 2; i < len(src) && linear; i++ {
+		linear = at(i).Sub(at(i-1)).Cmp(diff) == 0
+	}
+	if linear {
+		return func(k int) cellContent {
+			return cell(last.Add(diff.Mul(decimal.New(int64(k), 0))))
+		}, true
+	}
+
+	ratio, err := at(1).Div(at(0))
+	if err != nil {
+		return nil, false
+	}
+	for i := 2; i < len(src); i++ {
+		if r, err := at(i).Div(at(i - 1)); err != nil || r.Cmp(ratio) != 0 {
+			return nil, false
+		}
+	}
+	terms := []decimal.Decimal{last}
+	return func(k int) cellContent {
+		for len(terms) <= k {
+			terms = append(terms, terms[len(terms)-1].Mul(ratio).Round(decimal.DivisionScale))
+		}
+		return cell(terms[k])
+	}, true
+}
+
+// dateSeries returns the date k cells after the last of src if src are
+// dates a constant number of months apart, or days apart if they are not
+// a month or more apart. Days past the end of a shorter month are moved
+// back to its last day, so that a series of month ends stays at them.
+func dateSeries(src []cellContent) (func(k int) cellContent, bool) {
+	for _, c := range src {
+		if !c.date || c.formula != "" || c.unit != nil {
+			return nil, false
+		}
+	}
+	first := numfmt.Date(src[0].value)
+	months := func(i int) int {
+		t := numfmt.Date(src[i].value)
+		return (t.Year()-first.Year())*12 + int(t.Month()) - int(first.Month())
+	}
+	date := func(v float64, decimals bool) cellContent {
+		c := cellContent{value: v, date: true}
+		if decimals {
+			d := decimal.New(int64(v), 0)
+			c.decimal = &d
+		}
+		return c
+	}
+	decimals := src[0].decimal != nil
+
+	step := 0
+	if len(src) > 1 {
+		step = months(1)
+	}
+	monthly := step != 0
+	for i := 1; i < len(src) && monthly; i++ {
+		monthly = numfmt.Serial(addMonths(first, i*step)) == src[i].value
+	}
+	if monthly {
+		return func(k int) cellContent {
+			return date(numfmt.Serial(addMonths(first, (len(src)-1+k)*step)), decimals)
+		}, true
+	}
+
+	days := 1.0
+	if len(src) > 1 {
+		days = src[1].value - src[0].value
+	}
+	for i := 2; i < len(src); i++ {
+		if src[i].value-src[i-1].value != days {
+			return nil, false
+		}
+	}
+	last := src[len(src)-1].value
+	return func(k int) cellContent {
+		return date(last+days*float64(k), decimals)
+	}, true
+}
+
+// addMonths returns the date n months after t, on the last day of that
+// month if it is shorter than t's day.
+func addMonths(t time.Time, n int) time.Time {
+	month := time.Date(t.Year(), t.Month()+time.Month(n), 1, 0, 0, 0, 0, time.UTC)
+	if last := month.AddDate(0, 1, -1).Day(); t.Day() > last {
+		return month.AddDate(0, 0, last-1)
+	}
+	return month.AddDate(0, 0, t.Day()-1)
+}
+
+func sameUnit(a, b cellContent) bool {
+	if a.unit == nil || b.unit == nil {
+		return a.unit == b.unit
+	}
+	return a.unit.Symbol == b.unit.Symbol
+}
+
+// moveFormula returns the formula src, starting with =, with its relative
+// references moved by the cells by.
+func moveFormula(src string, by image.Point) string {
+	n, err := formula.Parse(strings.TrimPrefix(src, "="))
+	if err != nil {
+		return src
+	}
+	return "=" + formula.Format(formula.MoveRefs(n, by.Y, by.X))
+}
+
+// text returns c as it would be typed into a cell.
+func (c cellContent) text() string {
+	if c.formula != "" {
+		return c.formula
+	}
+	if c.date && c.unit == nil {
+		return numfmt.ISODate.Format(c.value)
+	}
+	text := strconv.FormatFloat(c.value, 'f', -1, 64)
+	if c.decimal != nil {
+		text = c.decimal.String()
+	}
+	if c.unit != nil {
+		text += " " + c.unit.String()
+	}
+	return text
+}
+
+// fill fills cells of a matrix by extending the cells of evt.From across
+// evt.To, as a change which can be undone.
+func (c *Canvas) fill(evt context.FillCells) {
+	m := c.matrixByName(evt.Matrix)
+	if m == nil {
+		return
+	}
+	contents := m.fillContents(evt.From, evt.To)
+	if len(contents) == 0 {
+		return
+	}
+	c.setCells(m, contents)
+}
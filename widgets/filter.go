@@ -0,0 +1,202 @@
+package widgets
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+
+	"gioui.org/layout"
+	"gioui.org/op/clip"
+	"gioui.org/text"
+	"gioui.org/unit"
+	"gioui.org/widget/material"
+	"github.com/tauraamui/nebula/context"
+	"github.com/tauraamui/nebula/formula"
+	"github.com/tauraamui/nebula/gesturex"
+)
+
+// A filter hides the rows of a matrix its condition is false for, such
+// as B > 0 or Revenue <> 0, where columns are named by their letter or
+// label and stand for the row's cell in them. Hidden rows stay in the
+// data but take no space, so they are neither drawn nor hit. Rows are
+// filtered when the filter is set, or the rows sorted, and not again as
+// their cells change.
+
+// FilterRows hides the rows condition is false for, showing every row
+// again if condition is empty.
+func (m *Matrix[T]) FilterRows(condition string) error {
+	if strings.TrimSpace(condition) == "" {
+		m.filter, m.hidden = nil, nil
+		m.cachedOps = nil
+		return nil
+	}
+	n, err := m.parseFilter(condition)
+	if err != nil {
+		return err
+	}
+	m.filter = n
+	m.applyFilter()
+	return nil
+}
+
+// parseFilter parses condition, checking the columns it names exist.
+func (m *Matrix[T]) parseFilter(condition string) (formula.Node, error) {
+	n, err := formula.Parse(condition)
+	if err != nil {
+		return nil, err
+	}
+	formula.Rewrite(n, func(n formula.Node) formula.Node {
+		if name, ok := n.(formula.Name); ok && err == nil {
+			if _, ok := m.column(name.Name); !ok {
+				err = fmt.Errorf("no column %q", name.Name)
+			}
+		}
+		return n
+	})
+	return n, err
+}
+
+// applyFilter hides the rows the filter is false for, or fails for.
+func (m *Matrix[T]) applyFilter() {
+	rows, _ := m.Data.Dims()
+	m.hidden = nil
+	for y := 0; y < rows; y++ {
+		n := formula.Rewrite(m.filter, func(n formula.Node) formula.Node {
+			if name, ok := n.(formula.Name); ok {
+				if x, ok := m.column(name.Name); ok {
+					return formula.Ref{Cell: formula.CellRef{Row: y, Col: x}}
+				}
+			}
+			return n
+		})
+		v, err := formula.Eval(n, rowEnv[T]{m: m})
+		if err == nil {
+			var f float64
+			if f, err = formula.ToNumber(v); err == nil && f != 0 {
+				continue
+			}
+		}
+		if m.hidden == nil {
+			m.hidden = map[int]struct{}{}
+		}
+		m.hidden[y] = struct{}{}
+	}
+	m.cachedOps = nil
+}
+
+// RowHidden reports whether row y is hidden by the filter.
+func (m *Matrix[T]) RowHidden(y int) bool {
+	_, ok := m.hidden[y]
+	return ok
+}
+
+// rowEnv resolves the references of a filter's condition, which can only
+// read the matrix being filtered.
+type rowEnv[T any] struct {
+	m *Matrix[T]
+}
+
+func (e rowEnv[T]) Cell(matrix string, row, col int) (formula.Value, error) {
+	m := e.m
+	if matrix != "" && matrix != m.Name {
+		return nil, formula.RefError("a filter cannot read matrix %q", matrix)
+	}
+	pos := image.Pt(col, row)
+	if err, ok := m.errs[pos]; ok {
+		return nil, err
+	}
+	rows, cols := m.Data.Dims()
+	if row < 0 || row >= rows || col < 0 || col >= cols {
+		return nil, formula.RefError("reference %s out of range", formula.CellRef{Row: row, Col: col})
+	}
+	if u, ok := m.cellUnits[pos]; ok {
+		return formula.Quantity{Value: m.Data.At(row, col), Unit: u}, nil
+	}
+	if m.decimals != nil {
+		return m.decimals.At(row, col), nil
+	}
+	return m.Data.At(row, col), nil
+}
+
+// filterState is a matrix's filter and the rows it hides.
+type filterState struct {
+	filter formula.Node
+	hidden map[int]struct{}
+}
+
+// filterChange sets or clears the filter of a matrix.
+type filterChange struct {
+	m             *Matrix[float64]
+	before, after filterState
+}
+
+func (ch filterChange) undo(*Canvas) { ch.m.setFilter(ch.before) }
+func (ch filterChange) redo(*Canvas) { ch.m.setFilter(ch.after) }
+
+func (m *Matrix[T]) setFilter(s filterState) {
+	m.filter, m.hidden = s.filter, copyIndexed(s.hidden)
+	m.cachedOps = nil
+}
+
+// filterRows filters the rows of a matrix, as a change which can be
+// undone.
+func (c *Canvas) filterRows(evt context.FilterRows) error {
+	m := c.matrixByName(evt.Matrix)
+	if m == nil {
+		return fmt.Errorf("no matrix named %q", evt.Matrix)
+	}
+	before := filterState{filter: m.filter, hidden: copyIndexed(m.hidden)}
+	if err := m.FilterRows(evt.Condition); err != nil {
+		return err
+	}
+	c.history.push(filterChange{m: m, before: before, after: filterState{filter: m.filter, hidden: copyIndexed(m.hidden)}})
+	return nil
+}
+
+// openFilter opens the prompt for the filter, starting with the current
+// one.
+func (m *Matrix[T]) openFilter() {
+	condition := ""
+	if m.filter != nil {
+		condition = formula.Format(m.filter)
+	}
+	m.filtering.open(condition)
+}
+
+// layoutFilter lays out the filter prompt, asking for the rows to be
+// filtered once a condition is submitted.
+func (m *Matrix[T]) layoutFilter(gtx *context.Context, th *material.Theme) {
+	m.layoutPrompt(gtx, th, &m.filtering, "filter", "B > 0", func(text string) error {
+		if strings.TrimSpace(text) != "" {
+			if _, err := m.parseFilter(text); err != nil {
+				return err
+			}
+		}
+		gtx.PushEvent(context.FilterRows{Matrix: m.Name, Condition: text})
+		return nil
+	})
+}
+
+// layoutFilterBadge shows how many rows the filter hides, clearing it
+// when clicked.
+func (m *Matrix[T]) layoutFilterBadge(gtx *context.Context, th *material.Theme, size image.Point) {
+	if m.filterButton == nil {
+		m.filterButton = &gesturex.ButtonEvents{Tag: &m.filter}
+	}
+
+	l := material.Label(th, unit.Sp(11), fmt.Sprintf("%d hidden ×", len(m.hidden)))
+	l.Color = color.NRGBA{R: 245, G: 150, B: 40, A: 255}
+	l.Alignment = text.End
+	l.MaxLines = 1
+	lgtx := gtx.Context
+	lgtx.Constraints = layout.Exact(size)
+	l.Layout(lgtx)
+
+	stack := clip.Rect(image.Rectangle{Max: size}).Push(gtx.Ops)
+	m.filterButton.Add(gtx.Ops)
+	m.filterButton.Events(gtx.Metric, gtx.Ops, gtx.Queue, nil, nil, func() {
+		gtx.PushEvent(context.FilterRows{Matrix: m.Name})
+	})
+	stack.Pop()
+}
@@ -0,0 +1,307 @@
+package widgets
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"github.com/tauraamui/nebula/context"
+	"github.com/tauraamui/nebula/f32x"
+)
+
+// FindMode selects how the find bar matches cells.
+type FindMode int
+
+const (
+	// ExactMatch finds cells whose formula, or value as typed or as
+	// shown, is the text searched for.
+	ExactMatch FindMode = iota
+	// NumericMatch finds cells whose value is within a tolerance of the
+	// number searched for.
+	NumericMatch
+	// RegexMatch finds cells whose formula, or value as typed or as
+	// shown, matches the regular expression searched for.
+	RegexMatch
+)
+
+func (m FindMode) String() string {
+	switch m {
+	case NumericMatch:
+		return "numeric"
+	case RegexMatch:
+		return "regex"
+	}
+	return "exact"
+}
+
+func parseFindMode(s string) (FindMode, error) {
+	for m := ExactMatch; m <= RegexMatch; m++ {
+		if m.String() == s {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("no find mode %q", s)
+}
+
+// findQuery is what the find bar searches for.
+type findQuery struct {
+	mode              FindMode
+	text              string
+	number, tolerance float64
+	re                *regexp.Regexp
+}
+
+// parseFindQuery parses what is typed into the find bar, returning nil
+// if text is empty. An empty tolerance is no tolerance at all.
+func parseFindQuery(text, mode, tolerance string) (*findQuery, error) {
+	if text == "" {
+		return nil, nil
+	}
+	q := &findQuery{text: text}
+	var err error
+	if q.mode, err = parseFindMode(mode); err != nil {
+		return nil, err
+	}
+	switch q.mode {
+	case NumericMatch:
+		if q.number, err = strconv.ParseFloat(strings.TrimSpace(text), 64); err != nil {
+			return nil, fmt.Errorf("%q is not a number", text)
+		}
+		if strings.TrimSpace(tolerance) != "" {
+			q.tolerance, err = strconv.ParseFloat(strings.TrimSpace(tolerance), 64)
+			if err != nil || q.tolerance < 0 {
+				return nil, fmt.Errorf("%q is not a tolerance", tolerance)
+			}
+		}
+	case RegexMatch:
+		if q.re, err = regexp.Compile(text); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+// match reports whether the cell at pos matches q. Empty cells have no
+// value to match numerically.
+func (q *findQuery) match(m *Matrix[float64], pos image.Point) bool {
+	if q.mode == NumericMatch {
+		if _, failed := m.errs[pos]; failed || m.empty(pos) {
+			return false
+		}
+		return math.Abs(m.Data.At(pos.Y, pos.X)-q.number) <= q.tolerance
+	}
+	for _, s := range findTexts(m, pos) {
+		if q.mode == RegexMatch && q.re.MatchString(s) || s == q.text {
+			return true
+		}
+	}
+	return false
+}
+
+// findTexts returns the texts of the cell at pos searched: what was
+// typed into it, then what it shows.
+func findTexts(m *Matrix[float64], pos image.Point) []string {
+	shown := m.cellText(pos)
+	if err, failed := m.errs[pos]; failed {
+		shown = err.Code
+	}
+	return []string{m.content(pos).text(), shown}
+}
+
+// replace returns what the cell at pos should hold with the text q
+// matches replaced by replacement, reporting false if the cell is
+// left as it is. Only what was typed into a cell is replaced, so cells
+// found by what their formulas work out to are left alone.
+func (q *findQuery) replace(m *Matrix[float64], pos image.Point, replacement string) (string, bool) {
+	if m.spilledInto(pos) {
+		return "", false
+	}
+	c := m.content(pos)
+	typed := c.text()
+	switch q.mode {
+	case NumericMatch:
+		return replacement, c.formula == "" && q.match(m, pos)
+	case RegexMatch:
+		if q.re.MatchString(typed) {
+			return q.re.ReplaceAllString(typed, replacement), true
+		}
+		return "", false
+	}
+	return replacement, typed == q.text || c.formula == "" && m.cellText(pos) == q.text
+}
+
+// findMatch is a cell found by the find bar.
+type findMatch struct {
+	m   *Matrix[float64]
+	pos image.Point
+}
+
+// finding is the find bar's search, with the match last moved to. The
+// matches are searched for again once stale, or once the history has
+// moved on from version.
+type finding struct {
+	query   *findQuery
+	matches []findMatch
+	current int
+	stale   bool
+	version int
+}
+
+// findAll returns the cells of every matrix matching q, a matrix at a
+// time and row by row, leaving out rows hidden by a filter.
+func (c *Canvas) findAll(q *findQuery) []findMatch {
+	var matches []findMatch
+	if q == nil {
+		return nil
+	}
+	for _, m := range c.matrices {
+		rows, cols := m.Data.Dims()
+		for y := 0; y < rows; y++ {
+			if m.RowHidden(y) {
+				continue
+			}
+			for x := 0; x < cols; x++ {
+				if q.match(m, image.Pt(x, y)) {
+					matches = append(matches, findMatch{m: m, pos: image.Pt(x, y)})
+				}
+			}
+		}
+	}
+	return matches
+}
+
+// highlightMatches searches the matrices again if their cells may have
+// changed, and marks the matches on them to be highlighted.
+func (c *Canvas) highlightMatches() {
+	f := &c.finding
+	if !c.findBar.Visible && f.query != nil {
+		f.query, f.stale = nil, true
+	}
+	if !f.stale && f.version == c.history.version {
+		return
+	}
+	f.stale, f.version = false, c.history.version
+	f.matches = c.findAll(f.query)
+	if f.current >= len(f.matches) {
+		f.current = 0
+	}
+	c.markMatches()
+}
+
+// markMatches marks the matches on their matrices, the current one
+// differently.
+func (c *Canvas) markMatches() {
+	for _, m := range c.matrices {
+		m.found = nil
+	}
+	for i, match := range c.finding.matches {
+		if match.m.found == nil {
+			match.m.found = map[image.Point]bool{}
+		}
+		match.m.found[match.pos] = i == c.finding.current
+	}
+}
+
+// find searches for what the find bar holds, moving evt.Step matches on
+// from the current one, or back to the first if the search changed, and
+// calling reveal with the bounds of the match moved to.
+func (c *Canvas) find(evt context.Find, reveal func(f32x.Rectangle)) error {
+	q, err := parseFindQuery(evt.Query, evt.Mode, evt.Tolerance)
+	if err != nil {
+		c.finding = finding{}
+		c.markMatches()
+		return err
+	}
+	f := &c.finding
+	f.query, f.matches = q, c.findAll(q)
+	if evt.Step == 0 || f.current >= len(f.matches) {
+		f.current = 0
+	}
+	if len(f.matches) > 0 {
+		f.current = (f.current + evt.Step%len(f.matches) + len(f.matches)) % len(f.matches)
+	}
+	c.markMatches()
+	if len(f.matches) == 0 {
+		return nil
+	}
+	match := f.matches[f.current]
+	reveal(match.m.cellBounds(match.pos))
+	return nil
+}
+
+// replaceChange replaces cells across matrices at once.
+type replaceChange []cellsChange
+
+func (ch replaceChange) undo(c *Canvas) {
+	for i := len(ch) - 1; i >= 0; i-- {
+		ch[i].undo(c)
+	}
+}
+
+func (ch replaceChange) redo(c *Canvas) {
+	for _, cells := range ch {
+		cells.redo(c)
+	}
+}
+
+// replaceAll replaces what the find bar matches in every matrix, as a
+// change which can be undone, returning how many cells were replaced.
+// Nothing is replaced if any replacement cannot be stored.
+func (c *Canvas) replaceAll(evt context.ReplaceAll) (int, error) {
+	q, err := parseFindQuery(evt.Query, evt.Mode, evt.Tolerance)
+	if err != nil {
+		return 0, err
+	}
+	if q == nil {
+		return 0, errors.New("nothing to find")
+	}
+	replaced := 0
+	var ch replaceChange
+	contents := map[*Matrix[float64]]map[image.Point]cellContent{}
+	for _, match := range c.findAll(q) {
+		text, ok := q.replace(match.m, match.pos, evt.Replacement)
+		if !ok {
+			continue
+		}
+		content, err := parseCellContent(text, match.m.Mode)
+		if err != nil {
+			return 0, fmt.Errorf("%s!%s: %w", match.m.Name, cellName(match.pos), err)
+		}
+		if contents[match.m] == nil {
+			contents[match.m] = map[image.Point]cellContent{}
+		}
+		contents[match.m][match.pos] = content
+		replaced++
+	}
+	for _, m := range c.matrices {
+		if cells, ok := contents[m]; ok {
+			ch = append(ch, newCellsChange(m, cells))
+		}
+	}
+	if len(ch) == 0 {
+		return 0, nil
+	}
+	ch.redo(c)
+	c.history.push(ch)
+	return replaced, nil
+}
+
+// renderFoundCell highlights a cell found by the find bar, more strongly
+// if it is the match last moved to.
+func renderFoundCell(gtx *context.Context, cell image.Rectangle, current bool) {
+	fill := color.NRGBA{R: 250, G: 210, B: 60, A: 70}
+	if current {
+		fill.A = 150
+	}
+	cl := clip.Rect(cell).Push(gtx.Ops)
+	paint.ColorOp{Color: fill}.Add(gtx.Ops)
+	paint.PaintOp{}.Add(gtx.Ops)
+	cl.Pop()
+}
@@ -0,0 +1,150 @@
+package widgets
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"github.com/tauraamui/nebula/context"
+	"github.com/tauraamui/nebula/gesturex"
+)
+
+const findBarHeight unit.Dp = 52
+
+// FindBar searches the values and formulas of every matrix, moving
+// between the cells found and replacing them.
+type FindBar struct {
+	Visible bool
+	Mode    FindMode
+	query,
+	tolerance,
+	replacement *widget.Editor
+	modeButton,
+	previousButton,
+	nextButton,
+	replaceButton *gesturex.ButtonEvents
+	status string
+	err    error
+}
+
+// Toggle shows or hides the bar, taking the keyboard focus when shown.
+func (p *FindBar) Toggle() {
+	p.Visible = !p.Visible
+	if p.query == nil {
+		p.query = &widget.Editor{SingleLine: true, Submit: true}
+		p.tolerance = &widget.Editor{SingleLine: true}
+		p.replacement = &widget.Editor{SingleLine: true}
+		p.modeButton = &gesturex.ButtonEvents{Tag: &p.Mode}
+		p.previousButton = &gesturex.ButtonEvents{Tag: p.query}
+		p.nextButton = &gesturex.ButtonEvents{Tag: p}
+		p.replaceButton = &gesturex.ButtonEvents{Tag: p.replacement}
+	}
+	if p.Visible {
+		p.query.Focus()
+		p.status, p.err = "", nil
+	}
+}
+
+// Focused reports whether one of the bar's fields has the keyboard focus.
+func (p *FindBar) Focused() bool {
+	return p.Visible && p.query != nil && anyFocused(p.query, p.tolerance, p.replacement)
+}
+
+// SetStatus shows the outcome of the last search or replacement, or err
+// if it failed.
+func (p *FindBar) SetStatus(status string, err error) {
+	p.status, p.err = status, err
+}
+
+// Layout draws the bar along the bottom of the window from x, showing
+// how many cells were found and which of them is the current one.
+func (p *FindBar) Layout(gtx *context.Context, th *material.Theme, x int, size image.Point, found, current int) {
+	if !p.Visible {
+		return
+	}
+	find := func(step int) {
+		gtx.PushEvent(context.Find{Query: p.query.Text(), Mode: p.Mode.String(), Tolerance: p.tolerance.Text(), Step: step})
+	}
+	changed := false
+	for _, e := range p.query.Events() {
+		switch e.(type) {
+		case widget.ChangeEvent:
+			changed = true
+		case widget.SubmitEvent:
+			find(1)
+		}
+	}
+	for _, e := range p.tolerance.Events() {
+		if _, ok := e.(widget.ChangeEvent); ok {
+			changed = true
+		}
+	}
+	if changed {
+		find(0)
+	}
+
+	height := gtx.Dp(findBarHeight)
+	padding := gtx.Dp(8)
+	off := op.Offset(image.Pt(x, size.Y-height)).Push(gtx.Ops)
+	bgnd := clip.Rect{Max: image.Pt(size.X-x, height)}.Push(gtx.Ops)
+	paint.ColorOp{Color: color.NRGBA{R: 32, G: 32, B: 36, A: 245}}.Add(gtx.Ops)
+	paint.PaintOp{}.Add(gtx.Ops)
+	bgnd.Pop()
+
+	// buttons line up with the fields beneath their labels
+	buttonY := padding + gtx.Dp(16)
+	left := padding
+	layoutButton(gtx, th, p.modeButton, image.Pt(left, buttonY), p.Mode.String(), func() {
+		p.Mode = (p.Mode + 1) % (RegexMatch + 1)
+		find(0)
+	})
+	left += gtx.Dp(64)
+	layoutField(gtx, th, image.Pt(left, padding), gtx.Dp(200), "find", p.query, "value, formula or pattern", 0)
+	left += gtx.Dp(208)
+	if p.Mode == NumericMatch {
+		layoutField(gtx, th, image.Pt(left, padding), gtx.Dp(70), "within", p.tolerance, "0", 0)
+		left += gtx.Dp(78)
+	}
+	layoutField(gtx, th, image.Pt(left, padding), gtx.Dp(160), "replace with", p.replacement, "", 0)
+	left += gtx.Dp(168)
+	layoutButton(gtx, th, p.previousButton, image.Pt(left, buttonY), "previous", func() { find(-1) })
+	left += gtx.Dp(64)
+	layoutButton(gtx, th, p.nextButton, image.Pt(left, buttonY), "next", func() { find(1) })
+	left += gtx.Dp(40)
+	layoutButton(gtx, th, p.replaceButton, image.Pt(left, buttonY), "replace all", func() {
+		gtx.PushEvent(context.ReplaceAll{Query: p.query.Text(), Mode: p.Mode.String(), Tolerance: p.tolerance.Text(), Replacement: p.replacement.Text()})
+	})
+	left += gtx.Dp(84)
+
+	status, statusColor := p.status, color.NRGBA{R: 160, G: 160, B: 160, A: 255}
+	switch {
+	case p.err != nil:
+		status, statusColor = p.err.Error(), color.NRGBA{R: 230, G: 90, B: 90, A: 255}
+	case status != "":
+	case p.query.Text() == "":
+	case found == 0:
+		status = "no matches"
+	default:
+		status = fmt.Sprintf("%d of %d", current+1, found)
+	}
+	statusWidth := size.X - x - left - padding
+	if statusWidth < 0 {
+		statusWidth = 0
+	}
+	statusOff := op.Offset(image.Pt(left, buttonY)).Push(gtx.Ops)
+	sgtx := gtx.Context
+	sgtx.Constraints = layout.Exact(image.Pt(statusWidth, gtx.Dp(20)))
+	l := material.Label(th, unit.Sp(12), status)
+	l.Color = statusColor
+	l.MaxLines = 1
+	l.Layout(sgtx)
+	statusOff.Pop()
+	off.Pop()
+}
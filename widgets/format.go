@@ -0,0 +1,248 @@
+package widgets
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+
+	"gioui.org/io/key"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"github.com/tauraamui/nebula/context"
+	"github.com/tauraamui/nebula/numfmt"
+)
+
+// Number formats only change how values are displayed and copied, the
+// values stored, saved and computed with are left as they are. A column
+// has a format for all of its cells, which a cell's own format overrides.
+
+// format returns the number format of the cell at pos, reporting false
+// if its values are shown as they are.
+func (m *Matrix[T]) format(pos image.Point) (numfmt.Format, bool) {
+	if f, ok := m.cellFormats[pos]; ok {
+		return f, true
+	}
+	f, ok := m.colFormats[pos.X]
+	return f, ok
+}
+
+// formats holds the number formats of a matrix's columns and cells.
+type formats struct {
+	cols  map[int]numfmt.Format
+	cells map[image.Point]numfmt.Format
+}
+
+func (m *Matrix[T]) formats() formats {
+	f := formats{cols: copyIndexed(m.colFormats), cells: make(map[image.Point]numfmt.Format, len(m.cellFormats))}
+	for pos, cf := range m.cellFormats {
+		f.cells[pos] = cf
+	}
+	return f
+}
+
+func (m *Matrix[T]) setFormats(f formats) {
+	m.colFormats = copyIndexed(f.cols)
+	m.cellFormats = make(map[image.Point]numfmt.Format, len(f.cells))
+	for pos, cf := range f.cells {
+		m.cellFormats[pos] = cf
+	}
+}
+
+// setFormat gives cells the format f. Columns whose every cell is among
+// cells are given f as their format instead, replacing those of their
+// cells.
+func (m *Matrix[T]) setFormat(cells []image.Point, f numfmt.Format) {
+	rows, _ := m.Data.Dims()
+	perCol := map[int]int{}
+	for _, pos := range cells {
+		perCol[pos.X]++
+	}
+	if m.colFormats == nil {
+		m.colFormats = map[int]numfmt.Format{}
+	}
+	if m.cellFormats == nil {
+		m.cellFormats = map[image.Point]numfmt.Format{}
+	}
+	for _, pos := range cells {
+		if perCol[pos.X] == rows {
+			if f.IsGeneral() {
+				delete(m.colFormats, pos.X)
+			} else {
+				m.colFormats[pos.X] = f
+			}
+			delete(m.cellFormats, pos)
+			continue
+		}
+		if col, ok := m.colFormats[pos.X]; f.IsGeneral() && !ok || ok && col == f {
+			delete(m.cellFormats, pos)
+			continue
+		}
+		m.cellFormats[pos] = f
+	}
+}
+
+// formatChange changes the number formats of a matrix.
+type formatChange struct {
+	m             *Matrix[float64]
+	before, after formats
+}
+
+func (ch formatChange) undo(*Canvas) { ch.m.setFormats(ch.before) }
+func (ch formatChange) redo(*Canvas) { ch.m.setFormats(ch.after) }
+
+// formatCells sets the number format of cells, as a change which can be
+// undone.
+func (c *Canvas) formatCells(evt context.FormatCells) error {
+	m := c.matrixByName(evt.Matrix)
+	if m == nil {
+		return fmt.Errorf("no matrix named %q", evt.Matrix)
+	}
+	f, err := numfmt.Parse(evt.Format)
+	if err != nil {
+		return err
+	}
+	rows, cols := m.Data.Dims()
+	cells := make([]image.Point, 0, len(evt.Cells))
+	for _, pos := range evt.Cells {
+		if pos.X < cols && pos.Y < rows {
+			cells = append(cells, pos)
+		}
+	}
+	before := m.formats()
+	m.setFormat(cells, f)
+	c.history.push(formatChange{m: m, before: before, after: m.formats()})
+	return nil
+}
+
+// openFormat opens the prompt for the number format of the selection,
+// starting with the format of the cell typed into.
+func (m *Matrix[T]) openFormat() {
+	cell, ok := m.selectedCellPos()
+	if !ok {
+		return
+	}
+	f, _ := m.format(cell)
+	m.formatting.open(f.String())
+}
+
+// layoutFormat lays out the format prompt, asking for the format typed
+// to be applied once it is submitted.
+func (m *Matrix[T]) layoutFormat(gtx *context.Context, th *material.Theme) {
+	m.layoutPrompt(gtx, th, &m.formatting, "format", "general", func(text string) error {
+		if _, err := numfmt.Parse(text); err != nil {
+			return err
+		}
+		gtx.PushEvent(context.FormatCells{Matrix: m.Name, Cells: append([]image.Point(nil), m.SelectedCells...), Format: text})
+		return nil
+	})
+}
+
+// cellPrompt asks for a setting of the selected cells, such as their
+// number format.
+type cellPrompt struct {
+	editor   *widget.Editor
+	active   bool
+	hadFocus bool
+	err      error
+}
+
+// open opens the prompt with text, selected so that typing replaces it.
+func (p *cellPrompt) open(text string) {
+	if p.editor == nil {
+		p.editor = &widget.Editor{SingleLine: true, Submit: true}
+	}
+	p.active, p.hadFocus, p.err = true, false, nil
+	p.editor.SetText(text)
+	p.editor.SetCaret(len([]rune(text)), 0)
+	p.editor.Focus()
+}
+
+// layoutPrompt lays out p beneath the selection, calling submit with the
+// text submitted. The prompt stays open showing the error submit returns
+// if there is one.
+func (m *Matrix[T]) layoutPrompt(gtx *context.Context, th *material.Theme, p *cellPrompt, label, hint string, submit func(text string) error) {
+	if !p.active {
+		return
+	}
+	for _, e := range p.editor.Events() {
+		se, ok := e.(widget.SubmitEvent)
+		if !ok {
+			continue
+		}
+		if err := submit(se.Text); err != nil {
+			p.err = err
+			continue
+		}
+		p.active = false
+		m.editing.focus = true
+		return
+	}
+	for _, e := range gtx.Queue.Events(p) {
+		if e, ok := e.(key.Event); ok && e.Name == key.NameEscape {
+			p.active = false
+			m.editing.focus = true
+			return
+		}
+	}
+	if p.editor.Focused() {
+		p.hadFocus = true
+	} else if p.hadFocus {
+		p.active = false
+		return
+	}
+
+	area, ok := m.selectionBounds()
+	if !ok {
+		p.active = false
+		return
+	}
+	g := m.grid()
+	below := g.px(gtx.Dp, image.Pt(area.Min.X, area.Max.Y-1))
+	pos := image.Pt(below.Min.X, below.Max.Y+gtx.Dp(4))
+	size := image.Pt(gtx.Dp(180), gtx.Dp(24))
+	off := op.Offset(pos).Push(gtx.Ops)
+	rounded := gtx.Dp(4)
+	bg := clip.RRect{Rect: image.Rectangle{Max: size}, NE: rounded, SE: rounded, SW: rounded, NW: rounded}.Push(gtx.Ops)
+	paint.ColorOp{Color: color.NRGBA{R: 30, G: 30, B: 30, A: 235}}.Add(gtx.Ops)
+	paint.PaintOp{}.Add(gtx.Ops)
+	// escape reaches the prompt from the editor within it
+	key.InputOp{Tag: p, Keys: key.NameEscape}.Add(gtx.Ops)
+
+	padding := gtx.Dp(4)
+	l := material.Label(th, unit.Sp(12), label)
+	l.Color = color.NRGBA{R: 140, G: 140, B: 140, A: 255}
+	lgtx := gtx.Context
+	lgtx.Constraints = layout.Exact(image.Pt(gtx.Dp(44), size.Y-padding*2))
+	labelOff := op.Offset(image.Pt(padding, padding)).Push(gtx.Ops)
+	l.Layout(lgtx)
+	labelOff.Pop()
+
+	edOff := op.Offset(image.Pt(gtx.Dp(48), padding)).Push(gtx.Ops)
+	egtx := gtx.Context
+	egtx.Constraints = layout.Exact(image.Pt(size.X-gtx.Dp(48)-padding, size.Y-padding*2))
+	ed := material.Editor(th, p.editor, hint)
+	ed.TextSize = unit.Sp(12)
+	ed.Color = color.NRGBA{R: 235, G: 235, B: 235, A: 255}
+	ed.Layout(egtx)
+	edOff.Pop()
+	bg.Pop()
+	off.Pop()
+
+	if p.err != nil {
+		renderTooltip(gtx, p.err.Error(), pos.Add(image.Pt(0, size.Y+gtx.Dp(2))), th)
+	}
+}
+
+// columnCells returns every cell of column x of a matrix rows high.
+func columnCells(x, rows int) []image.Point {
+	cells := make([]image.Point, rows)
+	for y := range cells {
+		cells[y] = image.Pt(x, y)
+	}
+	return cells
+}
@@ -0,0 +1,251 @@
+package widgets
+
+import (
+	stdcontext "context"
+	"fmt"
+	"image"
+	"math"
+	"sort"
+
+	"github.com/tauraamui/nebula/decimal"
+	"github.com/tauraamui/nebula/formula"
+	nmat "github.com/tauraamui/nebula/mat"
+	"github.com/tauraamui/nebula/script"
+	"github.com/tauraamui/nebula/units"
+)
+
+// matrixEnv resolves formula references on behalf of a formula owned by
+// a matrix, against a snapshot of every matrix on the canvas. Functions
+// not built in are looked up in the document's script.
+type matrixEnv struct {
+	matrices map[string]*Matrix[float64]
+	owner    *Matrix[float64]
+	script   *script.Program
+	ctx      stdcontext.Context
+}
+
+func (e matrixEnv) Func(name string) (formula.Func, bool) {
+	if e.script == nil {
+		return nil, false
+	}
+	if e.ctx != nil {
+		return e.script.FuncContext(e.ctx, name)
+	}
+	return e.script.Func(name)
+}
+
+// Err reports whether the evaluation has been cancelled.
+func (e matrixEnv) Err() error {
+	if e.ctx == nil {
+		return nil
+	}
+	return e.ctx.Err()
+}
+
+func (e matrixEnv) Cell(matrix string, row, col int) (formula.Value, error) {
+	m := e.owner
+	if matrix != "" {
+		m = e.matrices[matrix]
+		if m == nil {
+			return nil, formula.RefError("unknown matrix %q", matrix)
+		}
+	}
+	if m.exprErr != nil {
+		return nil, m.exprErr
+	}
+	if err, ok := m.errs[image.Pt(col, row)]; ok {
+		return nil, err
+	}
+	rows, cols := m.Data.Dims()
+	if row < 0 || row >= rows || col < 0 || col >= cols {
+		return nil, formula.RefError("reference %s!%s out of range", m.Name, formula.CellRef{Row: row, Col: col})
+	}
+	if u, ok := m.cellUnits[image.Pt(col, row)]; ok {
+		return formula.Quantity{Value: m.Data.At(row, col), Unit: u}, nil
+	}
+	if m.decimals != nil {
+		return m.decimals.At(row, col), nil
+	}
+	return m.Data.At(row, col), nil
+}
+
+func (e matrixEnv) Matrix(name string) (nmat.Matrix[float64], error) {
+	m := e.matrices[name]
+	if m == nil {
+		return nil, formula.RefError("unknown matrix %q", name)
+	}
+	if m.exprErr != nil {
+		return nil, m.exprErr
+	}
+	for _, pos := range formulaCells(m) {
+		if err, ok := m.errs[pos]; ok {
+			return nil, err
+		}
+	}
+	return formula.Dense{Dense: m.Data}, nil
+}
+
+func (c *Canvas) matrixByName(name string) *Matrix[float64] {
+	for _, m := range c.matrices {
+		if m.Name == name {
+			return m
+		}
+	}
+	return nil
+}
+
+func (c *Canvas) nextMatrixName() string {
+	for i := len(c.matrices) + 1; ; i++ {
+		name := fmt.Sprintf("matrix%d", i)
+		if c.matrixByName(name) == nil {
+			return name
+		}
+	}
+}
+
+// renameMatrix renames the matrix called from and rewrites every formula
+// on the canvas which references it, as a change which can be undone.
+func (c *Canvas) renameMatrix(from, to string) error {
+	m := c.matrixByName(from)
+	if m == nil {
+		return fmt.Errorf("no matrix named %q", from)
+	}
+	before := c.structure(m)
+	if err := c.rename(m, to); err != nil {
+		return err
+	}
+	c.history.push(structureChange{before: before, after: c.structure(m)})
+	return nil
+}
+
+// rename renames m to to and rewrites every formula on the canvas which
+// references it.
+func (c *Canvas) rename(m *Matrix[float64], to string) error {
+	from := m.Name
+	if !formula.ValidName(to) {
+		return fmt.Errorf("invalid matrix name %q", to)
+	}
+	if c.matrixByName(to) != nil {
+		return fmt.Errorf("matrix name %q already in use", to)
+	}
+
+	for _, other := range c.matrices {
+		for pos, n := range other.formulas {
+			other.formulas[pos] = formula.RenameMatrix(n, from, to)
+		}
+	}
+	m.Name = to
+	c.renameScenarioCells(from, to)
+	c.rebuildGraph()
+	return nil
+}
+
+// defineMatrix renames the matrix called matrix to name and makes it
+// derived from expr, or a plain matrix again if expr is empty, as a
+// change which can be undone.
+func (c *Canvas) defineMatrix(matrix, name, expr string) error {
+	m := c.matrixByName(matrix)
+	if m == nil {
+		return fmt.Errorf("no matrix named %q", matrix)
+	}
+	var n formula.Node
+	if expr != "" {
+		var err error
+		if n, err = formula.Parse(expr); err != nil {
+			return err
+		}
+	}
+	before := c.structure(m)
+	if name != matrix {
+		if err := c.rename(m, name); err != nil {
+			return err
+		}
+	}
+	m.expr = n
+	m.exprErr = nil
+	m.formulas = nil
+	c.rebuildGraph()
+	c.history.push(structureChange{before: before, after: c.structure(m)})
+	return nil
+}
+
+// references returns the graph nodes and ranges read by the formula n
+// owned by the matrix owner. Cells of derived matrices are tracked as a
+// whole.
+func (c *Canvas) references(n formula.Node, owner string) ([]formula.CellID, []formula.CellRange) {
+	if m := c.matrixByName(owner); m != nil {
+		n = resolveLabels(n, m, c.matrixByName)
+	}
+	refs, ranges := formula.References(n, owner)
+	for i, id := range refs {
+		if m := c.matrixByName(id.Matrix); m != nil && m.expr != nil {
+			refs[i] = formula.WholeMatrix(id.Matrix)
+		}
+	}
+	plain := ranges[:0]
+	for _, r := range ranges {
+		if m := c.matrixByName(r.Matrix); m != nil && m.expr != nil {
+			refs = append(refs, formula.WholeMatrix(r.Matrix))
+			continue
+		}
+		plain = append(plain, r)
+	}
+	return refs, plain
+}
+
+// setResult stores the outcome of evaluating the formula at pos. Errors
+// are kept alongside the data as error values, leaving a zero in their
+// place so that NaN never reaches the matrix data. An array result spills
+// into the cells right of and below pos.
+func (m *Matrix[T]) setResult(pos image.Point, v formula.Value, err error) {
+	if m.errs == nil {
+		m.errs = map[image.Point]formula.Error{}
+	}
+	delete(m.errs, pos)
+	m.clearSpill(pos, nil)
+
+	if arr, ok := v.(*formula.Array); ok && err == nil && len(arr.Data) > 1 {
+		if err = m.setSpill(pos, arr); err == nil {
+			v = arr.Data[0]
+		}
+	}
+
+	var f float64
+	var u *units.Unit
+	var d *decimal.Decimal
+	if err == nil {
+		switch r := v.(type) {
+		case formula.Quantity:
+			f, u = r.Value, &r.Unit
+		case decimal.Decimal:
+			f, d = r.Float64(), &r
+		default:
+			f, err = formula.ToNumber(v)
+		}
+	}
+	if err == nil && (math.IsNaN(f) || math.IsInf(f, 0)) {
+		err = formula.ErrInvalidArgument
+	}
+	if err != nil {
+		m.errs[pos] = formula.AsError(err)
+		f, u, d = 0, nil, nil
+	}
+	m.setUnit(pos, u)
+	m.setNumber(pos, f, d)
+}
+
+// formulaCells returns the positions of m's formula cells in row-major
+// order.
+func formulaCells(m *Matrix[float64]) []image.Point {
+	cells := make([]image.Point, 0, len(m.formulas))
+	for pos := range m.formulas {
+		cells = append(cells, pos)
+	}
+	sort.Slice(cells, func(i, j int) bool {
+		if cells[i].Y != cells[j].Y {
+			return cells[i].Y < cells[j].Y
+		}
+		return cells[i].X < cells[j].X
+	})
+	return cells
+}
@@ -0,0 +1,407 @@
+package widgets
+
+import (
+	"image"
+	"math"
+	"sort"
+	"time"
+
+	"gioui.org/f32"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/unit"
+	"gioui.org/widget/material"
+	"github.com/tauraamui/nebula/context"
+	"github.com/tauraamui/nebula/f32x"
+	"github.com/tauraamui/nebula/gesturex"
+)
+
+const (
+	// minCellWidth and minCellHeight bound how far a column or row can be
+	// narrowed by dragging its edge.
+	minCellWidth  unit.Dp = 16
+	minCellHeight unit.Dp = 12
+	// edgeGrip is how near to a grid line the pointer must be to drag it.
+	edgeGrip unit.Dp = 4
+	// cellInset is the space left either side of a cell's text.
+	cellInset unit.Dp = 3
+)
+
+// grid holds the edges of a matrix's columns and rows in dp, relative to
+// its top left corner. Column x spans xs[x] to xs[x+1].
+type grid struct {
+	xs, ys []float32
+}
+
+// grid returns the current edges of the matrix's cells. Columns and rows
+// without a size of their own are cellWidth wide and cellHeight tall.
+func (m *Matrix[T]) grid() grid {
+	rows, cols := m.Data.Dims()
+	g := grid{xs: make([]float32, cols+1), ys: make([]float32, rows+1)}
+	for x := 0; x < cols; x++ {
+		g.xs[x+1] = g.xs[x] + float32(m.colWidth(x))
+	}
+	for y := 0; y < rows; y++ {
+		g.ys[y+1] = g.ys[y] + float32(m.rowHeight(y))
+	}
+	return g
+}
+
+func (m *Matrix[T]) colWidth(x int) unit.Dp {
+	if w, ok := m.colWidths[x]; ok {
+		return w
+	}
+	return cellWidth
+}
+
+func (m *Matrix[T]) rowHeight(y int) unit.Dp {
+	if m.RowHidden(y) {
+		return 0
+	}
+	if h, ok := m.rowHeights[y]; ok {
+		return h
+	}
+	return cellHeight
+}
+
+// size returns the size of the whole grid in dp.
+func (g grid) size() f32.Point {
+	return f32.Pt(g.xs[len(g.xs)-1], g.ys[len(g.ys)-1])
+}
+
+// cell returns the area of the cell at pos in dp.
+func (g grid) cell(pos image.Point) f32x.Rectangle {
+	return f32x.Rectangle{
+		Min: f32.Pt(g.xs[pos.X], g.ys[pos.Y]),
+		Max: f32.Pt(g.xs[pos.X+1], g.ys[pos.Y+1]),
+	}
+}
+
+// px returns the area of the cell at pos in pixels. Neighbouring cells
+// share their edges exactly.
+func (g grid) px(dp func(v unit.Dp) int, pos image.Point) image.Rectangle {
+	return image.Rect(
+		dp(unit.Dp(g.xs[pos.X])), dp(unit.Dp(g.ys[pos.Y])),
+		dp(unit.Dp(g.xs[pos.X+1])), dp(unit.Dp(g.ys[pos.Y+1])),
+	)
+}
+
+// at returns the cell at p, a point in dp, reporting false if p is
+// outside the grid.
+func (g grid) at(p f32.Point) (image.Point, bool) {
+	x, xok := span(g.xs, p.X)
+	y, yok := span(g.ys, p.Y)
+	return image.Pt(x, y), xok && yok
+}
+
+// pageRow returns the row a page from row y, height dp further down or,
+// if height is negative, up. It moves at least one row.
+func (g grid) pageRow(y int, height float32) int {
+	r, ok := span(g.ys, g.ys[y]+height)
+	switch {
+	case !ok && height < 0:
+		return 0
+	case !ok:
+		return len(g.ys) - 2
+	case r == y && height < 0:
+		return y - 1
+	case r == y:
+		return y + 1
+	}
+	return r
+}
+
+// span returns the index of the span of edges v falls within.
+func span(edges []float32, v float32) (int, bool) {
+	if v < edges[0] || v >= edges[len(edges)-1] {
+		return 0, false
+	}
+	return sort.Search(len(edges), func(i int) bool { return edges[i] > v }) - 1, true
+}
+
+// snap returns how many columns or rows, whose edges are given, best fit
+// length. Beyond the last edge further ones of size def are assumed.
+func snap(edges []float32, length, def float32) int {
+	last := edges[len(edges)-1]
+	if length >= last {
+		return len(edges) - 1 + snapCells(length-last, def)
+	}
+	best := 1
+	for i := 1; i < len(edges); i++ {
+		if abs32(edges[i]-length) < abs32(edges[best]-length) {
+			best = i
+		}
+	}
+	return best
+}
+
+func abs32(v float32) float32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// edgeDrag is a grid line being dragged to resize the column or row
+// before it.
+type edgeDrag struct {
+	row    bool
+	index  int
+	before unit.Dp
+	drag   float32
+}
+
+// edgeHandle lets a grid line be dragged, or double clicked to fit the
+// column or row before it to its contents.
+type edgeHandle struct {
+	input     *gesturex.InputEvents
+	row       bool
+	index     int
+	lastClick time.Time
+}
+
+// layoutEdges adds the handles for the matrix's grid lines. It must be
+// called after the matrix's own input is added so that the handles are
+// on top of it. origin is the matrix's top left corner in pixels.
+func (m *Matrix[T]) layoutEdges(gtx layout.Context, origin image.Point) {
+	g := m.grid()
+	size := m.Size.Round()
+	grip := gtx.Dp(edgeGrip)
+	handles := 0
+	add := func(row bool, index, edge int) {
+		if handles == len(m.edgeHandles) {
+			h := &edgeHandle{}
+			h.input = &gesturex.InputEvents{Tag: h}
+			m.edgeHandles = append(m.edgeHandles, h)
+		}
+		h := m.edgeHandles[handles]
+		handles++
+		h.row, h.index = row, index
+
+		area := image.Rect(edge-grip, 0, edge+grip/2, size.Y)
+		cursor := pointer.CursorColResize
+		if row {
+			area = image.Rect(0, edge-grip, size.X, edge+grip/2)
+			cursor = pointer.CursorRowResize
+		}
+		area = area.Intersect(image.Rectangle{Max: size}).Add(origin)
+		stack := clip.Rect(area).Push(gtx.Ops)
+		h.input.Add(gtx.Ops)
+		h.input.Events(gtx.Metric, gtx.Ops, gtx.Queue, m.edgePressEvents(h), m.edgeReleaseEvents(h), m.edgeDragEvents(gtx.Dp), nil)
+		cursor.Add(gtx.Ops)
+		stack.Pop()
+	}
+	for x := 1; x < len(g.xs); x++ {
+		add(false, x-1, gtx.Dp(unit.Dp(g.xs[x])))
+	}
+	for y := 1; y < len(g.ys); y++ {
+		if m.RowHidden(y - 1) {
+			continue
+		}
+		add(true, y-1, gtx.Dp(unit.Dp(g.ys[y])))
+	}
+	m.edgeHandles = m.edgeHandles[:handles]
+}
+
+func (m *Matrix[T]) edgePressEvents(h *edgeHandle) func(pos f32.Point, buttons pointer.Buttons) {
+	return func(pos f32.Point, buttons pointer.Buttons) {
+		now := time.Now()
+		if now.Sub(h.lastClick) < doubleClickDuration {
+			h.lastClick = time.Time{}
+			m.fitting = &edgeDrag{row: h.row, index: h.index}
+			return
+		}
+		h.lastClick = now
+		before := m.colWidth(h.index)
+		if h.row {
+			before = m.rowHeight(h.index)
+		}
+		m.edgeDrag = &edgeDrag{row: h.row, index: h.index, before: before}
+	}
+}
+
+func (m *Matrix[T]) edgeDragEvents(dp func(v unit.Dp) int) func(diff f32.Point) {
+	return func(diff f32.Point) {
+		d := m.edgeDrag
+		if d == nil {
+			return
+		}
+		diff = diff.Div(float32(dp(1)))
+		if d.row {
+			d.drag += diff.Y
+			m.setRowHeight(d.index, d.before+unit.Dp(d.drag))
+			return
+		}
+		d.drag += diff.X
+		m.setColWidth(d.index, d.before+unit.Dp(d.drag))
+	}
+}
+
+func (m *Matrix[T]) edgeReleaseEvents(h *edgeHandle) func(pos f32.Point, buttons pointer.Buttons) {
+	return func(pos f32.Point, buttons pointer.Buttons) {
+		d := m.edgeDrag
+		m.edgeDrag = nil
+		if d == nil || d.drag == 0 {
+			return
+		}
+		after := m.colWidth(d.index)
+		if d.row {
+			after = m.rowHeight(d.index)
+		}
+		m.sized = append(m.sized, sizeChange{row: d.row, index: d.index, before: d.before, after: after})
+	}
+}
+
+// setColWidth sets the width of column x, in whole dp.
+func (m *Matrix[T]) setColWidth(x int, w unit.Dp) {
+	w = unit.Dp(math.Round(float64(w)))
+	if w < minCellWidth {
+		w = minCellWidth
+	}
+	if m.colWidths == nil {
+		m.colWidths = map[int]unit.Dp{}
+	}
+	if w == cellWidth {
+		delete(m.colWidths, x)
+		return
+	}
+	m.colWidths[x] = w
+}
+
+// setRowHeight sets the height of row y, in whole dp.
+func (m *Matrix[T]) setRowHeight(y int, h unit.Dp) {
+	h = unit.Dp(math.Round(float64(h)))
+	if h < minCellHeight {
+		h = minCellHeight
+	}
+	if m.rowHeights == nil {
+		m.rowHeights = map[int]unit.Dp{}
+	}
+	if h == cellHeight {
+		delete(m.rowHeights, y)
+		return
+	}
+	m.rowHeights[y] = h
+}
+
+// layoutFit fits a column to the widest text in it, or a row to the
+// tallest, after an edge was double clicked. Text is measured by laying
+// it out into ops which are then thrown away.
+func (m *Matrix[T]) layoutFit(gtx *context.Context, th *material.Theme) {
+	f := m.fitting
+	if f == nil {
+		return
+	}
+	m.fitting = nil
+	rows, cols := m.Data.Dims()
+	if (f.row && f.index >= rows) || (!f.row && f.index >= cols) {
+		return
+	}
+
+	measure := func(pos image.Point) image.Point {
+		text := m.cellText(pos)
+		if err, ok := m.errs[pos]; ok {
+			text = err.Code
+		}
+		mgtx := gtx.Context
+		mgtx.Ops = new(op.Ops)
+		mgtx.Constraints.Min = image.Point{}
+		return material.Label(th, unit.Sp(14), text).Layout(mgtx).Size
+	}
+	inset := 2 * float32(cellInset)
+	var fit float32
+	for i := 0; i < rows && !f.row; i++ {
+		if w := float32(measure(image.Pt(f.index, i)).X)/float32(gtx.Dp(1)) + inset; w > fit {
+			fit = w
+		}
+	}
+	for i := 0; i < cols && f.row; i++ {
+		if h := float32(measure(image.Pt(i, f.index)).Y)/float32(gtx.Dp(1)) + inset; h > fit {
+			fit = h
+		}
+	}
+
+	ch := sizeChange{row: f.row, index: f.index, before: m.colWidth(f.index)}
+	if f.row {
+		ch.before = m.rowHeight(f.index)
+		if fit < float32(cellHeight) {
+			fit = float32(cellHeight)
+		}
+		m.setRowHeight(f.index, unit.Dp(fit))
+		ch.after = m.rowHeight(f.index)
+	} else {
+		m.setColWidth(f.index, unit.Dp(fit))
+		ch.after = m.colWidth(f.index)
+	}
+	if ch.after != ch.before {
+		m.sized = append(m.sized, ch)
+	}
+}
+
+// sizeChange changes the width of a column or the height of a row. The
+// matrix collects them as they are made and the canvas, which knows it
+// as a Matrix[float64], fills in m when recording them.
+type sizeChange struct {
+	m             *Matrix[float64]
+	row           bool
+	index         int
+	before, after unit.Dp
+}
+
+func (ch sizeChange) undo(*Canvas) { ch.set(ch.before) }
+func (ch sizeChange) redo(*Canvas) { ch.set(ch.after) }
+
+func (ch sizeChange) set(v unit.Dp) {
+	if ch.row {
+		ch.m.setRowHeight(ch.index, v)
+		return
+	}
+	ch.m.setColWidth(ch.index, v)
+}
+
+// shiftIndexed moves what is kept for the columns or rows after those
+// inserted or deleted, such as their sizes, along with them.
+func shiftIndexed[V any](values map[int]V, index func(int) (int, bool)) map[int]V {
+	if values == nil {
+		return nil
+	}
+	shifted := make(map[int]V, len(values))
+	for i, v := range values {
+		if j, ok := index(i); ok {
+			shifted[j] = v
+		}
+	}
+	return shifted
+}
+
+func (g grid) equal(o grid) bool {
+	if len(g.xs) != len(o.xs) || len(g.ys) != len(o.ys) {
+		return false
+	}
+	for i := range g.xs {
+		if g.xs[i] != o.xs[i] {
+			return false
+		}
+	}
+	for i := range g.ys {
+		if g.ys[i] != o.ys[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// extent returns the length of n columns or rows, whose edges are given,
+// with any beyond the last edge of size def.
+func extent(edges []float32, n int, def float32) float32 {
+	if last := len(edges) - 1; n > last {
+		return edges[last] + float32(n-last)*def
+	}
+	return edges[n]
+}
+
+func copyIndexed[V any](values map[int]V) map[int]V {
+	return shiftIndexed(values, func(i int) (int, bool) { return i, true })
+}
@@ -0,0 +1,387 @@
+package widgets
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+	"time"
+
+	"gioui.org/f32"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/text"
+	"gioui.org/unit"
+	"gioui.org/widget/material"
+	"github.com/tauraamui/nebula/context"
+	"github.com/tauraamui/nebula/formula"
+	"github.com/tauraamui/nebula/gesturex"
+)
+
+// Headers are shown above a matrix's columns and left of its rows when
+// turned on, naming them A, B, C and 1, 2, 3 unless given a label. A
+// label which is a valid name refers to its whole row or column in
+// formulas, bare within the matrix and as matrix1!label elsewhere.
+
+const (
+	headerHeight unit.Dp = 16
+	// headerWidth is the narrowest the row headers are, wider labels
+	// widening them all.
+	headerWidth unit.Dp = 28
+)
+
+// header is the header of a row or a column.
+type header struct {
+	row   bool
+	index int
+}
+
+// headerStrip lets the column or row headers be clicked to select their
+// columns or rows, dragged across to select several, or double clicked
+// to be labelled.
+type headerStrip struct {
+	input     *gesturex.InputEvents
+	row       bool
+	anchor    int
+	at        f32.Point
+	lastClick time.Time
+	lastIndex int
+}
+
+// headerName returns the label of h, or its letter or number.
+func (m *Matrix[T]) headerName(h header) string {
+	if h.row {
+		if l, ok := m.rowLabels[h.index]; ok {
+			return l
+		}
+		return strconv.Itoa(h.index + 1)
+	}
+	if l, ok := m.colLabels[h.index]; ok {
+		return l
+	}
+	return formula.ColumnName(h.index)
+}
+
+// headerSize returns the height of the column headers and the width of
+// the row headers in pixels, zero while headers are hidden.
+func (m *Matrix[T]) headerSize(gtx *context.Context, th *material.Theme) image.Point {
+	if !m.headers {
+		return image.Point{}
+	}
+	size := image.Pt(gtx.Dp(headerWidth), gtx.Dp(headerHeight))
+	for _, l := range m.rowLabels {
+		mgtx := gtx.Context
+		mgtx.Ops = new(op.Ops)
+		mgtx.Constraints.Min = image.Point{}
+		if w := material.Label(th, unit.Sp(11), l).Layout(mgtx).Size.X + 2*gtx.Dp(cellInset); w > size.X {
+			size.X = w
+		}
+	}
+	return size
+}
+
+// layoutHeaders draws the headers outside the grid, those of selected
+// cells highlighted.
+func (m *Matrix[T]) layoutHeaders(gtx *context.Context, th *material.Theme) {
+	m.headerPx = m.headerSize(gtx, th)
+	if !m.headers {
+		return
+	}
+	selected := map[header]bool{}
+	for _, pos := range m.SelectedCells {
+		selected[header{row: true, index: pos.Y}] = true
+		selected[header{index: pos.X}] = true
+	}
+	g := m.grid()
+	rows, cols := m.Data.Dims()
+	draw := func(h header, area image.Rectangle) {
+		bg := color.NRGBA{R: 225, G: 225, B: 225, A: 255}
+		if selected[h] {
+			bg = color.NRGBA{R: 200, G: 215, B: 240, A: 255}
+		}
+		cl := clip.Rect(area).Push(gtx.Ops)
+		paint.ColorOp{Color: bg}.Add(gtx.Ops)
+		paint.PaintOp{}.Add(gtx.Ops)
+		l := material.Label(th, unit.Sp(11), m.headerName(h))
+		l.Color = color.NRGBA{R: 90, G: 90, B: 90, A: 255}
+		l.Alignment = text.Middle
+		l.MaxLines = 1
+		lgtx := gtx.Context
+		lgtx.Constraints = layout.Exact(image.Pt(area.Dx(), gtx.Sp(11)))
+		off := op.Offset(area.Min.Add(image.Pt(0, (area.Dy()-gtx.Sp(11))/2))).Push(gtx.Ops)
+		l.Layout(lgtx)
+		off.Pop()
+		cl.Pop()
+		border := clip.Stroke{Path: clip.RRect{Rect: area}.Path(gtx.Ops), Width: float32(.25) / float32(gtx.Dp(1))}.Op().Push(gtx.Ops)
+		paint.ColorOp{Color: color.NRGBA{R: 55, G: 55, B: 55, A: 255}}.Add(gtx.Ops)
+		paint.PaintOp{}.Add(gtx.Ops)
+		border.Pop()
+	}
+	size := m.headerPx
+	for x := 0; x < cols; x++ {
+		cell := g.px(gtx.Dp, image.Pt(x, 0))
+		draw(header{index: x}, image.Rect(cell.Min.X, -size.Y, cell.Max.X, 0))
+	}
+	for y := 0; y < rows; y++ {
+		if m.RowHidden(y) {
+			continue
+		}
+		cell := g.px(gtx.Dp, image.Pt(0, y))
+		draw(header{row: true, index: y}, image.Rect(-size.X, cell.Min.Y, 0, cell.Max.Y))
+	}
+}
+
+// layoutHeaderToggle shows whether the headers are shown, showing or
+// hiding them when clicked.
+func (m *Matrix[T]) layoutHeaderToggle(gtx *context.Context, th *material.Theme, size image.Point) {
+	if m.headerButton == nil {
+		m.headerButton = &gesturex.ButtonEvents{Tag: &m.headers}
+	}
+
+	l := material.Label(th, unit.Sp(11), "A1")
+	l.Color = color.NRGBA{R: 90, G: 90, B: 90, A: 255}
+	if m.headers {
+		l.Color = color.NRGBA{R: 200, G: 200, B: 200, A: 255}
+	}
+	l.Alignment = text.End
+	lgtx := gtx.Context
+	lgtx.Constraints = layout.Exact(size)
+	l.Layout(lgtx)
+
+	stack := clip.Rect(image.Rectangle{Max: size}).Push(gtx.Ops)
+	m.headerButton.Add(gtx.Ops)
+	m.headerButton.Events(gtx.Metric, gtx.Ops, gtx.Queue, nil, nil, func() {
+		m.headers = !m.headers
+	})
+	stack.Pop()
+}
+
+// layoutHeaderInput adds the input of the headers. origin is the
+// matrix's top left corner in pixels.
+func (m *Matrix[T]) layoutHeaderInput(gtx layout.Context, origin image.Point) {
+	if !m.headers {
+		return
+	}
+	for i := range m.headerStrips {
+		s := &m.headerStrips[i]
+		if s.input == nil {
+			s.row = i == 1
+			s.input = &gesturex.InputEvents{Tag: s}
+		}
+		size := m.Size.Round()
+		area := image.Rect(0, -m.headerPx.Y, size.X, 0)
+		if s.row {
+			area = image.Rect(-m.headerPx.X, 0, 0, size.Y)
+		}
+		stack := clip.Rect(area.Add(origin)).Push(gtx.Ops)
+		s.input.Add(gtx.Ops)
+		s.input.Events(gtx.Metric, gtx.Ops, gtx.Queue, m.headerPressEvents(s, gtx.Dp), nil, m.headerDragEvents(s, gtx.Dp), nil)
+		pointer.CursorPointer.Add(gtx.Ops)
+		stack.Pop()
+	}
+}
+
+// headerAt returns the index of the column, or row, of s at p, a point
+// in pixels on the canvas, clamped to those the matrix has.
+func (m *Matrix[T]) headerAt(s *headerStrip, dp func(v unit.Dp) int, p f32.Point) int {
+	p = p.Div(float32(dp(1))).Sub(m.Pos)
+	g := m.grid()
+	edges, v := g.xs, p.X
+	if s.row {
+		edges, v = g.ys, p.Y
+	}
+	if v < 0 {
+		return 0
+	}
+	if i, ok := span(edges, v); ok {
+		return i
+	}
+	return len(edges) - 2
+}
+
+func (m *Matrix[T]) headerPressEvents(s *headerStrip, dp func(v unit.Dp) int) func(pos f32.Point, buttons pointer.Buttons) {
+	return func(pos f32.Point, buttons pointer.Buttons) {
+		if buttons != pointer.ButtonPrimary {
+			return
+		}
+		i := m.headerAt(s, dp, pos)
+		now := time.Now()
+		if i == s.lastIndex && now.Sub(s.lastClick) < doubleClickDuration {
+			s.lastClick = time.Time{}
+			m.openLabel(header{row: s.row, index: i})
+			return
+		}
+		s.lastClick, s.lastIndex = now, i
+		s.anchor, s.at = i, pos
+		m.selectHeaders(s.row, i, i)
+		m.editing.focus = true
+	}
+}
+
+func (m *Matrix[T]) headerDragEvents(s *headerStrip, dp func(v unit.Dp) int) func(diff f32.Point) {
+	return func(diff f32.Point) {
+		s.at = s.at.Add(diff)
+		m.selectHeaders(s.row, s.anchor, m.headerAt(s, dp, s.at))
+	}
+}
+
+// selectHeaders selects every cell of the rows, or columns, from anchor
+// to cursor.
+func (m *Matrix[T]) selectHeaders(row bool, anchor, cursor int) {
+	rows, cols := m.Data.Dims()
+	if row {
+		m.selectRange(image.Pt(0, anchor), image.Pt(cols-1, cursor))
+		return
+	}
+	m.selectRange(image.Pt(anchor, 0), image.Pt(cursor, rows-1))
+}
+
+// openLabel opens the prompt for the label of h.
+func (m *Matrix[T]) openLabel(h header) {
+	m.selectHeaders(h.row, h.index, h.index)
+	m.labelled = h
+	label := m.colLabels[h.index]
+	if h.row {
+		label = m.rowLabels[h.index]
+	}
+	m.labelling.open(label)
+}
+
+// layoutLabel lays out the label prompt, asking for the header to be
+// labelled once a label is submitted. An empty label removes it.
+func (m *Matrix[T]) layoutLabel(gtx *context.Context, th *material.Theme) {
+	hint := formula.ColumnName(m.labelled.index)
+	if m.labelled.row {
+		hint = strconv.Itoa(m.labelled.index + 1)
+	}
+	m.layoutPrompt(gtx, th, &m.labelling, "label", hint, func(text string) error {
+		text = strings.TrimSpace(text)
+		if err := m.checkLabel(m.labelled, text); err != nil {
+			return err
+		}
+		gtx.PushEvent(context.LabelHeader{Matrix: m.Name, Row: m.labelled.row, Index: m.labelled.index, Label: text})
+		return nil
+	})
+}
+
+// checkLabel returns an error if label cannot label h, because another
+// header of the matrix has it already.
+func (m *Matrix[T]) checkLabel(h header, label string) error {
+	if label == "" {
+		return nil
+	}
+	if o, ok := m.findLabel(label); ok && o != h {
+		return fmt.Errorf("%s already labels %s", label, m.headerKind(o))
+	}
+	return nil
+}
+
+func (m *Matrix[T]) headerKind(h header) string {
+	if h.row {
+		return "row " + strconv.Itoa(h.index+1)
+	}
+	return "column " + formula.ColumnName(h.index)
+}
+
+// findLabel returns the header labelled label, ignoring case.
+func (m *Matrix[T]) findLabel(label string) (header, bool) {
+	for x, l := range m.colLabels {
+		if strings.EqualFold(l, label) {
+			return header{index: x}, true
+		}
+	}
+	for y, l := range m.rowLabels {
+		if strings.EqualFold(l, label) {
+			return header{row: true, index: y}, true
+		}
+	}
+	return header{}, false
+}
+
+// setLabel labels h, or removes its label if label is empty.
+func (m *Matrix[T]) setLabel(h header, label string) {
+	labels := &m.colLabels
+	if h.row {
+		labels = &m.rowLabels
+	}
+	if label == "" {
+		delete(*labels, h.index)
+		return
+	}
+	if *labels == nil {
+		*labels = map[int]string{}
+	}
+	(*labels)[h.index] = label
+}
+
+// labelChange changes the label of a row or column. Formulas are
+// resolved again as the cells their labels refer to have changed.
+type labelChange struct {
+	m             *Matrix[float64]
+	h             header
+	before, after string
+}
+
+func (ch labelChange) undo(c *Canvas) {
+	ch.m.setLabel(ch.h, ch.before)
+	c.rebuildGraph()
+}
+
+func (ch labelChange) redo(c *Canvas) {
+	ch.m.setLabel(ch.h, ch.after)
+	c.rebuildGraph()
+}
+
+// labelHeader labels a row or column, as a change which can be undone.
+func (c *Canvas) labelHeader(evt context.LabelHeader) error {
+	m := c.matrixByName(evt.Matrix)
+	if m == nil {
+		return fmt.Errorf("no matrix named %q", evt.Matrix)
+	}
+	h := header{row: evt.Row, index: evt.Index}
+	rows, cols := m.Data.Dims()
+	if h.index < 0 || h.row && h.index >= rows || !h.row && h.index >= cols {
+		return fmt.Errorf("no %s in matrix %q", m.headerKind(h), m.Name)
+	}
+	if err := m.checkLabel(h, evt.Label); err != nil {
+		return err
+	}
+	ch := labelChange{m: m, h: h, before: m.colLabels[h.index], after: evt.Label}
+	if h.row {
+		ch.before = m.rowLabels[h.index]
+	}
+	if ch.before == ch.after {
+		return nil
+	}
+	ch.redo(c)
+	c.history.push(ch)
+	return nil
+}
+
+// resolveLabels returns n, a formula of owner, with the labels it uses
+// replaced by references to the rows or columns they label. matrix
+// looks matrices up by name.
+func resolveLabels(n formula.Node, owner *Matrix[float64], matrix func(name string) *Matrix[float64]) formula.Node {
+	return formula.ResolveLabels(n, func(name, label string) (formula.Node, bool) {
+		m := owner
+		if name != "" {
+			if m = matrix(name); m == nil {
+				return nil, false
+			}
+		}
+		h, ok := m.findLabel(label)
+		if !ok {
+			return nil, false
+		}
+		rows, cols := m.Data.Dims()
+		r := formula.Range{Matrix: name, From: formula.CellRef{Row: 0, Col: h.index}, To: formula.CellRef{Row: rows - 1, Col: h.index}}
+		if h.row {
+			r.From, r.To = formula.CellRef{Row: h.index, Col: 0}, formula.CellRef{Row: h.index, Col: cols - 1}
+		}
+		return r, true
+	})
+}
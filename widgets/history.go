@@ -0,0 +1,242 @@
+package widgets
+
+import (
+	"image"
+
+	"gioui.org/f32"
+	"github.com/tauraamui/nebula/units"
+)
+
+// defaultHistoryLimit is how many changes can be undone unless the canvas
+// is told otherwise with SetHistoryLimit.
+const defaultHistoryLimit = 200
+
+// change is an edit to the canvas which can be undone and redone.
+type change interface {
+	undo(c *Canvas)
+	redo(c *Canvas)
+}
+
+// merger is a change which can absorb the change made after it, so that
+// a run of small changes such as the steps of a drag is undone at once.
+type merger interface {
+	merge(next change) bool
+}
+
+// history records the changes made to the canvas so they can be undone,
+// and those undone so they can be redone until a new change is made. Only
+// the latest limit changes are kept. version counts the changes made,
+// undone and redone, so that what is worked out from the cells can tell
+// when to work it out again.
+type history struct {
+	done, undone []change
+	limit        int
+	version      int
+}
+
+func (h *history) push(ch change) {
+	h.undone = nil
+	h.version++
+	if n := len(h.done); n > 0 {
+		if m, ok := h.done[n-1].(merger); ok && m.merge(ch) {
+			return
+		}
+	}
+	h.done = append(h.done, ch)
+	h.trim()
+}
+
+// trim drops the oldest changes beyond the limit.
+func (h *history) trim() {
+	limit := h.limit
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+	if over := len(h.done) - limit; over > 0 {
+		h.done = append(h.done[:0], h.done[over:]...)
+	}
+}
+
+func (h *history) undo(c *Canvas) {
+	if len(h.done) == 0 {
+		return
+	}
+	ch := h.done[len(h.done)-1]
+	h.done = h.done[:len(h.done)-1]
+	ch.undo(c)
+	h.version++
+	h.undone = append(h.undone, ch)
+}
+
+func (h *history) redo(c *Canvas) {
+	if len(h.undone) == 0 {
+		return
+	}
+	ch := h.undone[len(h.undone)-1]
+	h.undone = h.undone[:len(h.undone)-1]
+	ch.redo(c)
+	h.version++
+	h.done = append(h.done, ch)
+}
+
+// cellValue is a plain value held by a cell of a matrix, with its unit
+// if it has one.
+type cellValue struct {
+	m     *Matrix[float64]
+	pos   image.Point
+	value float64
+	unit  *units.Unit
+}
+
+// valuesChange sets the values of cells, such as the inputs found by the
+// solver.
+type valuesChange struct {
+	before, after []cellValue
+}
+
+func (ch valuesChange) undo(*Canvas) { setValues(ch.before) }
+func (ch valuesChange) redo(*Canvas) { setValues(ch.after) }
+
+func setValues(values []cellValue) {
+	for _, v := range values {
+		v.m.SetValue(v.pos, v.value)
+		v.m.setUnit(v.pos, v.unit)
+	}
+}
+
+// SetHistoryLimit sets how many changes can be undone, dropping the oldest
+// beyond it. A limit of zero or less restores the default.
+func (c *Canvas) SetHistoryLimit(limit int) {
+	c.history.limit = limit
+	c.history.trim()
+}
+
+// matrixCreated adds a matrix to the canvas.
+type matrixCreated struct {
+	m *Matrix[float64]
+}
+
+func (ch matrixCreated) undo(c *Canvas) {
+	for i, m := range c.matrices {
+		if m == ch.m {
+			c.matrices = append(c.matrices[:i], c.matrices[i+1:]...)
+			break
+		}
+	}
+	c.rebuildGraph()
+}
+
+func (ch matrixCreated) redo(c *Canvas) {
+	c.matrices = append(c.matrices, ch.m)
+	c.rebuildGraph()
+}
+
+// addMatrix puts m on the canvas, as a change which can be undone.
+func (c *Canvas) addMatrix(m *Matrix[float64]) {
+	ch := matrixCreated{m: m}
+	ch.redo(c)
+	c.history.push(ch)
+}
+
+// matrixMoved moves a matrix across the canvas. The steps of one drag
+// are merged into a single move.
+type matrixMoved struct {
+	m        *Matrix[float64]
+	from, to f32.Point
+	drag     int
+}
+
+func (ch *matrixMoved) undo(*Canvas) { ch.m.Pos = ch.from }
+func (ch *matrixMoved) redo(*Canvas) { ch.m.Pos = ch.to }
+
+func (ch *matrixMoved) merge(next change) bool {
+	n, ok := next.(*matrixMoved)
+	if !ok || n.m != ch.m || n.drag != ch.drag {
+		return false
+	}
+	ch.to = n.to
+	return true
+}
+
+// selectionChanged changes the cells selected in a matrix. Consecutive
+// changes to the same matrix's selection are merged.
+type selectionChanged struct {
+	m             *Matrix[float64]
+	before, after selection
+}
+
+// selection is the cells selected in a matrix and the cursor extending
+// them.
+type selection struct {
+	cells  []image.Point
+	cursor image.Point
+}
+
+func (ch *selectionChanged) undo(*Canvas) { ch.m.setSelection(ch.before) }
+func (ch *selectionChanged) redo(*Canvas) { ch.m.setSelection(ch.after) }
+
+func (ch *selectionChanged) merge(next change) bool {
+	n, ok := next.(*selectionChanged)
+	if !ok || n.m != ch.m {
+		return false
+	}
+	ch.after = n.after
+	return true
+}
+
+func (m *Matrix[T]) selection() selection {
+	return selection{cells: append([]image.Point(nil), m.SelectedCells...), cursor: m.cursor}
+}
+
+func (m *Matrix[T]) setSelection(s selection) {
+	m.SelectedCells = append([]image.Point(nil), s.cells...)
+	m.cursor = s.cursor
+}
+
+func (s selection) equal(o selection) bool {
+	if s.cursor != o.cursor || len(s.cells) != len(o.cells) {
+		return false
+	}
+	for i := range s.cells {
+		if s.cells[i] != o.cells[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// tracked is what the canvas last saw of a matrix's position and
+// selection, which it compares against to find moves and selections to
+// record.
+type tracked struct {
+	pos       f32.Point
+	selection selection
+}
+
+// track records the matrices which were moved or had their selection
+// changed since it was last called. When record is false the changes are
+// only noted, such as after they were made by undo or redo. Columns and
+// rows resized are always recorded.
+func (c *Canvas) track(record bool) {
+	seen := make(map[*Matrix[float64]]tracked, len(c.matrices))
+	for _, m := range c.matrices {
+		for _, ch := range m.sized {
+			ch.m = m
+			c.history.push(ch)
+		}
+		m.sized = nil
+		now := tracked{pos: m.Pos, selection: m.selection()}
+		seen[m] = now
+		last, ok := c.tracked[m]
+		if !ok || !record {
+			continue
+		}
+		if now.pos != last.pos {
+			c.history.push(&matrixMoved{m: m, from: last.pos, to: now.pos, drag: m.drags})
+		}
+		if !now.selection.equal(last.selection) {
+			c.history.push(&selectionChanged{m: m, before: last.selection, after: now.selection})
+		}
+	}
+	c.tracked = seen
+}
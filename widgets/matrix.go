@@ -1,22 +1,32 @@
 package widgets
 
 import (
+	"fmt"
 	"image"
 	"image/color"
 	"math"
+	"strconv"
+	"strings"
 
 	"gioui.org/f32"
+	"gioui.org/font"
 	"gioui.org/io/pointer"
 	"gioui.org/layout"
 	"gioui.org/op"
 	"gioui.org/op/clip"
 	"gioui.org/op/paint"
+	"gioui.org/text"
 	"gioui.org/unit"
+	"gioui.org/widget"
 	"gioui.org/widget/material"
 	"github.com/tauraamui/nebula/context"
+	"github.com/tauraamui/nebula/decimal"
 	"github.com/tauraamui/nebula/f32x"
+	"github.com/tauraamui/nebula/formula"
 	"github.com/tauraamui/nebula/gesturex"
 	nmat "github.com/tauraamui/nebula/mat"
+	"github.com/tauraamui/nebula/numfmt"
+	"github.com/tauraamui/nebula/units"
 	"gonum.org/v1/gonum/mat"
 )
 
@@ -30,57 +40,263 @@ const (
 	cellPadding         = 1
 )
 
+// NumericMode selects how a matrix stores and computes its values.
+type NumericMode int
+
+const (
+	// FloatMode stores values as float64.
+	FloatMode NumericMode = iota
+	// DecimalMode stores values as exact decimals with a fixed number of
+	// decimal places, avoiding binary rounding errors such as 0.1+0.2.
+	DecimalMode
+)
+
+const defaultDecimalPrecision = 2
+
 type Matrix[T any] struct {
+	Name string
+	Mode NumericMode
+	// Precision is the number of decimal places kept in DecimalMode.
+	Precision int
 	Pos,
 	Size f32.Point
 	Color                  color.NRGBA
 	Data                   *mat.Dense
 	Data2                  nmat.Matrix[T]
-	cellSize               f32.Point
+	colWidths              map[int]unit.Dp
+	rowHeights             map[int]unit.Dp
+	edgeHandles            []*edgeHandle
+	edgeDrag               *edgeDrag
+	fitting                *edgeDrag
+	sized                  []sizeChange
 	inputEvents            *gesturex.InputEvents
 	selectedCell           image.Point
 	SelectedCells          []image.Point
+	cursor                 image.Point
+	drags                  int
 	pendingSelectionBounds f32x.Rectangle
 	wasMovingMinLast       bool
 	cachedOps              *op.Ops
+	cachedDims             image.Point
+	cachedGrid             grid
 	call                   op.CallOp
+	nameEditor             *widget.Editor
+	formulas               map[image.Point]formula.Node
+	errs                   map[image.Point]formula.Error
+	cellUnits              map[image.Point]units.Unit
+	decimals               nmat.Mutable[decimal.Decimal]
+	modeButton             *gesturex.ButtonEvents
+	expr                   formula.Node
+	exprErr                error
+	changed                map[image.Point]struct{}
+	pending                map[image.Point]struct{}
+	spills                 map[image.Point]spill
+	editing                cellEditing
+	resizing               resizing
+	filling                filling
+	colFormats             map[int]numfmt.Format
+	cellFormats            map[image.Point]numfmt.Format
+	formatting             cellPrompt
+	styling                cellPrompt
+	styles                 []styledRange
+	headers                bool
+	headerButton           *gesturex.ButtonEvents
+	headerPx               image.Point
+	headerStrips           [2]headerStrip
+	colLabels              map[int]string
+	rowLabels              map[int]string
+	labelling              cellPrompt
+	labelled               header
+	sorting                cellPrompt
+	filtering              cellPrompt
+	filter                 formula.Node
+	filterButton           *gesturex.ButtonEvents
+	hidden                 map[int]struct{}
+	found                  map[image.Point]bool
+	spilled                map[image.Point]struct{}
+	computing              bool
 }
 
-func (m *Matrix[T]) Layout(gtx *context.Context, th *material.Theme, debug bool) layout.Dimensions {
-	m.cellSize.X = float32(cellWidth)
-	m.cellSize.Y = float32(cellHeight)
+// SetFormula parses src and assigns it to the cell at pos, where pos.X is
+// the column and pos.Y the row. An empty src removes the cell's formula.
+func (m *Matrix[T]) SetFormula(pos image.Point, src string) error {
+	if src == "" {
+		delete(m.formulas, pos)
+		m.markChanged(pos)
+		return nil
+	}
+	n, err := formula.Parse(src)
+	if err != nil {
+		return err
+	}
+	if m.formulas == nil {
+		m.formulas = map[image.Point]formula.Node{}
+	}
+	m.formulas[pos] = n
+	m.markChanged(pos)
+	return nil
+}
 
-	off := op.Offset(image.Pt(gtx.Dp(unit.Dp(m.Pos.X)), gtx.Dp(unit.Dp(m.Pos.Y)))).Push(gtx.Ops)
+// SetValue stores v in the cell at pos, replacing any formula or unit it
+// held. In DecimalMode v is rounded to the matrix's precision.
+func (m *Matrix[T]) SetValue(pos image.Point, v float64) {
+	delete(m.formulas, pos)
+	delete(m.cellUnits, pos)
+	m.setNumber(pos, v, nil)
+	m.markChanged(pos)
+}
 
-	cellSize := f32.Point{X: float32(gtx.Dp(cellWidth)), Y: float32(gtx.Dp(cellHeight))}
+// SetDecimal stores the exact value d in the cell at pos, replacing any
+// formula or unit it held.
+func (m *Matrix[T]) SetDecimal(pos image.Point, d decimal.Decimal) {
+	delete(m.formulas, pos)
+	delete(m.cellUnits, pos)
+	m.setNumber(pos, d.Float64(), &d)
+	m.markChanged(pos)
+}
 
+// setNumber stores v, or d where given and the matrix is in DecimalMode,
+// keeping the float64 data in step with the decimal data.
+func (m *Matrix[T]) setNumber(pos image.Point, v float64, d *decimal.Decimal) {
+	if m.decimals == nil {
+		m.Data.Set(pos.Y, pos.X, v)
+		return
+	}
+	dec := decimal.FromFloat(v)
+	if d != nil {
+		dec = *d
+	}
+	dec = dec.Round(m.Precision)
+	m.decimals.Set(pos.Y, pos.X, dec)
+	m.Data.Set(pos.Y, pos.X, dec.Float64())
+}
+
+// SetNumericMode switches how the matrix stores its values, converting
+// the existing values. precision is the number of decimal places kept in
+// DecimalMode.
+func (m *Matrix[T]) SetNumericMode(mode NumericMode, precision int) {
+	m.Mode = mode
+	m.Precision = precision
+	m.syncDecimals()
 	rows, cols := m.Data.Dims()
-	totalSize := f32.Point{
-		X: float32(cols) * cellSize.X,
-		Y: float32(rows) * cellSize.Y,
+	for i := 0; i < rows; i++ {
+		for j := 0; j < cols; j++ {
+			m.markChanged(image.Pt(j, i))
+		}
 	}
-	m.Size = totalSize
+}
+
+// syncDecimals rebuilds the decimal data from the float64 data when the
+// matrix is in DecimalMode.
+func (m *Matrix[T]) syncDecimals() {
+	if m.Mode != DecimalMode {
+		m.decimals = nil
+		return
+	}
+	rows, cols := m.Data.Dims()
+	m.decimals = nmat.New[decimal.Decimal](rows, cols, nil).(nmat.Mutable[decimal.Decimal])
+	for i := 0; i < rows; i++ {
+		for j := 0; j < cols; j++ {
+			m.setNumber(image.Pt(j, i), m.Data.At(i, j), nil)
+		}
+	}
+}
+
+// cellText returns the cell's value as it is displayed, in its number
+// format.
+func (m *Matrix[T]) cellText(pos image.Point) string {
+	f, ok := m.format(pos)
+	if !ok {
+		return m.valueText(pos)
+	}
+	content := f.Format(m.Data.At(pos.Y, pos.X))
+	if u, ok := m.cellUnits[pos]; ok {
+		content += " " + u.String()
+	}
+	return content
+}
+
+// valueText returns the cell's value as it is stored.
+func (m *Matrix[T]) valueText(pos image.Point) string {
+	var content string
+	if m.decimals != nil {
+		content = m.decimals.At(pos.Y, pos.X).String()
+	} else {
+		content = strconv.FormatFloat(m.Data.At(pos.Y, pos.X), 'f', -1, 64)
+	}
+	if u, ok := m.cellUnits[pos]; ok {
+		content += " " + u.String()
+	}
+	return content
+}
+
+// SetQuantity stores v measured in u in the cell at pos, replacing any
+// formula it held.
+func (m *Matrix[T]) SetQuantity(pos image.Point, v float64, u units.Unit) {
+	m.SetValue(pos, v)
+	m.setUnit(pos, &u)
+}
+
+func (m *Matrix[T]) setUnit(pos image.Point, u *units.Unit) {
+	if u == nil {
+		delete(m.cellUnits, pos)
+		return
+	}
+	if m.cellUnits == nil {
+		m.cellUnits = map[image.Point]units.Unit{}
+	}
+	m.cellUnits[pos] = *u
+}
+
+func (m *Matrix[T]) markChanged(pos image.Point) {
+	if m.changed == nil {
+		m.changed = map[image.Point]struct{}{}
+	}
+	m.changed[pos] = struct{}{}
+}
+
+// Formula returns the source of the formula assigned to the cell at pos.
+func (m *Matrix[T]) Formula(pos image.Point) (string, bool) {
+	n, ok := m.formulas[pos]
+	if !ok {
+		return "", false
+	}
+	return formula.Format(n), true
+}
+
+func (m *Matrix[T]) Layout(gtx *context.Context, th *material.Theme, debug bool) layout.Dimensions {
+	m.layoutFit(gtx, th)
+
+	off := op.Offset(image.Pt(gtx.Dp(unit.Dp(m.Pos.X)), gtx.Dp(unit.Dp(m.Pos.Y)))).Push(gtx.Ops)
+
+	rows, cols := m.Data.Dims()
+	g := m.grid()
+	m.Size = layout.FPt(g.px(gtx.Dp, image.Pt(cols-1, rows-1)).Max)
+
+	m.layoutHeaders(gtx, th)
+	m.layoutName(gtx, th)
 
 	bgnd := clip.Rect{Min: image.Pt(0, 0), Max: image.Pt(m.Size.Round().X, m.Size.Round().Y)}.Push(gtx.Ops)
 	paint.ColorOp{Color: m.Color}.Add(gtx.Ops)
 	paint.PaintOp{}.Add(gtx.Ops)
 	bgnd.Pop()
 
-	if m.cachedOps == nil {
+	// the grid is drawn once for each size the matrix and its cells take
+	if m.cachedOps == nil || m.cachedDims != image.Pt(cols, rows) || !m.cachedGrid.equal(g) {
 		m.cachedOps = &op.Ops{}
+		m.cachedDims = image.Pt(cols, rows)
+		m.cachedGrid = g
 		macro := op.Record(m.cachedOps)
 		cells := clip.Path{}
 		cells.Begin(m.cachedOps)
 
-		cellwidth := gtx.Dp(unit.Dp(m.cellSize.X))
-		cellheight := gtx.Dp(unit.Dp(m.cellSize.Y))
-
 		for x := 0; x < cols; x++ {
 			for y := 0; y < rows; y++ {
-				cells.MoveTo(f32.Pt(float32(cellwidth*x), float32(cellheight*y)))
-				cells.LineTo(f32.Pt(float32((cellwidth*x)+cellwidth), float32(cellheight*y)))
-				cells.LineTo(f32.Pt(float32((cellwidth*x)+cellwidth), float32(cellheight*y+cellheight)))
-				cells.LineTo(f32.Pt(float32(cellwidth*x), float32(cellheight*y+cellheight)))
+				cell := g.px(gtx.Dp, image.Pt(x, y))
+				cells.MoveTo(layout.FPt(cell.Min))
+				cells.LineTo(f32.Pt(float32(cell.Max.X), float32(cell.Min.Y)))
+				cells.LineTo(layout.FPt(cell.Max))
+				cells.LineTo(f32.Pt(float32(cell.Min.X), float32(cell.Max.Y)))
 			}
 		}
 		cells.Close()
@@ -97,16 +313,44 @@ func (m *Matrix[T]) Layout(gtx *context.Context, th *material.Theme, debug bool)
 
 	m.call.Add(gtx.Ops)
 
-	/*
-		for x := 0; x < cols; x++ {
-			for y := 0; y < rows; y++ {
-				renderCell(gtx, strconv.FormatFloat(m.Data.At(y, x), 'f', -1, 64), x, y, gtx.Dp(unit.Dp(m.cellSize.X)), gtx.Dp(unit.Dp(m.cellSize.Y)), m.Color, th)
+	for x := 0; x < cols; x++ {
+		for y := 0; y < rows; y++ {
+			if _, ok := m.errs[image.Pt(x, y)]; ok || m.RowHidden(y) {
+				continue
 			}
+			renderCell(gtx, m.cellText(image.Pt(x, y)), g.px(gtx.Dp, image.Pt(x, y)), m.style(image.Pt(x, y)), m.Color, th)
 		}
-	*/
+	}
+
+	for pos, err := range m.errs {
+		if m.RowHidden(pos.Y) {
+			continue
+		}
+		renderErrorCell(gtx, err.Code, g.px(gtx.Dp, pos), th)
+	}
+
+	for pos := range m.pending {
+		if m.RowHidden(pos.Y) {
+			continue
+		}
+		renderPendingCell(gtx, g.px(gtx.Dp, pos), th)
+	}
+	if m.computing {
+		renderPendingSelectionSpan(gtx, f32x.Rectangle{Max: m.Size}, color.NRGBA{R: 120, G: 160, B: 230, A: 60})
+	}
+
+	for pos, current := range m.found {
+		if m.RowHidden(pos.Y) {
+			continue
+		}
+		renderFoundCell(gtx, g.px(gtx.Dp, pos), current)
+	}
 
 	for _, selectedCell := range m.SelectedCells {
-		renderCellSelection(gtx, selectedCell.X, selectedCell.Y, gtx.Dp(unit.Dp(m.cellSize.X)), gtx.Dp(unit.Dp(m.cellSize.Y)))
+		if m.RowHidden(selectedCell.Y) {
+			continue
+		}
+		renderCellSelection(gtx, g.px(gtx.Dp, selectedCell))
 	}
 
 	selectionBounds := m.pendingSelectionBounds.SwappedBounds()
@@ -117,11 +361,171 @@ func (m *Matrix[T]) Layout(gtx *context.Context, th *material.Theme, debug bool)
 		clip.Pop()
 	}
 
+	m.layoutFill(gtx, th)
+	m.layoutResize(gtx, th)
+
+	keys := clip.Rect{Max: m.Size.Round()}.Push(gtx.Ops)
+	m.layoutCellEditing(gtx, th)
+	keys.Pop()
+
+	m.layoutErrorCause(gtx, th)
+	m.layoutFormat(gtx, th)
+	m.layoutStyle(gtx, th)
+	m.layoutLabel(gtx, th)
+	m.layoutSort(gtx, th)
+	m.layoutFilter(gtx, th)
+
 	off.Pop()
 
 	return layout.Dimensions{Size: m.Size.Round()}
 }
 
+// layoutErrorCause shows the cause of the error in the cell beneath the
+// pointer, if there is one.
+func (m *Matrix[T]) layoutErrorCause(gtx *context.Context, th *material.Theme) {
+	if m.inputEvents == nil {
+		return
+	}
+	hoverPos, hovering := m.inputEvents.Hovered()
+	if !hovering {
+		return
+	}
+	pos := hoverPos.Div(float32(gtx.Dp(1))).Sub(m.Pos)
+	cell, ok := m.grid().at(pos)
+	if !ok {
+		return
+	}
+	err, ok := m.errs[cell]
+	if !ok {
+		return
+	}
+	tip := image.Pt(gtx.Dp(unit.Dp(pos.X))+gtx.Dp(12), gtx.Dp(unit.Dp(pos.Y))+gtx.Dp(12))
+	renderTooltip(gtx, err.Error(), tip, th)
+}
+
+func renderTooltip(gtx *context.Context, content string, pos image.Point, th *material.Theme) {
+	off := op.Offset(pos).Push(gtx.Ops)
+	padding := gtx.Dp(4)
+
+	macro := op.Record(gtx.Ops)
+	textOff := op.Offset(image.Pt(padding, padding)).Push(gtx.Ops)
+	l := material.Label(th, unit.Sp(12), content)
+	l.Color = color.NRGBA{R: 235, G: 235, B: 235, A: 255}
+	lgtx := gtx.Context
+	lgtx.Constraints.Min = image.Point{}
+	dims := l.Layout(lgtx)
+	textOff.Pop()
+	call := macro.Stop()
+
+	bounds := image.Rect(0, 0, dims.Size.X+padding*2, dims.Size.Y+padding*2)
+	rounded := gtx.Dp(4)
+	bg := clip.RRect{Rect: bounds, NE: rounded, SE: rounded, SW: rounded, NW: rounded}.Push(gtx.Ops)
+	paint.ColorOp{Color: color.NRGBA{R: 30, G: 30, B: 30, A: 235}}.Add(gtx.Ops)
+	paint.PaintOp{}.Add(gtx.Ops)
+	bg.Pop()
+	call.Add(gtx.Ops)
+	off.Pop()
+}
+
+func (m *Matrix[T]) layoutName(gtx *context.Context, th *material.Theme) {
+	if m.nameEditor == nil {
+		m.nameEditor = &widget.Editor{SingleLine: true, Submit: true}
+	}
+
+	for _, e := range m.nameEditor.Events() {
+		se, ok := e.(widget.SubmitEvent)
+		if !ok || se.Text == m.label() {
+			continue
+		}
+		if name, expr, found := strings.Cut(se.Text, "="); found || m.expr != nil {
+			gtx.PushEvent(context.DefineMatrix{Matrix: m.Name, Name: strings.TrimSpace(name), Expr: strings.TrimSpace(expr)})
+			continue
+		}
+		gtx.PushEvent(context.RenameMatrix{From: m.Name, To: strings.TrimSpace(se.Text)})
+	}
+	if !m.nameEditor.Focused() && m.nameEditor.Text() != m.label() {
+		m.nameEditor.SetText(m.label())
+	}
+
+	labelHeight := gtx.Dp(18)
+	labelWidth := int(math.Max(float64(m.Size.X), float64(gtx.Dp(cellWidth))))
+	badgeWidth := gtx.Dp(44)
+	toggleWidth := gtx.Dp(22)
+	filterWidth := 0
+	if m.filter != nil {
+		filterWidth = gtx.Dp(70)
+	}
+	off := op.Offset(image.Pt(0, -labelHeight-m.headerPx.Y)).Push(gtx.Ops)
+	ngtx := gtx.Context
+	ngtx.Constraints = layout.Exact(image.Pt(labelWidth-badgeWidth-toggleWidth-filterWidth, labelHeight))
+	ed := material.Editor(th, m.nameEditor, "")
+	ed.TextSize = unit.Sp(12)
+	ed.Color = color.NRGBA{R: 200, G: 200, B: 200, A: 255}
+	ed.Layout(ngtx)
+
+	if m.filter != nil {
+		filterOff := op.Offset(image.Pt(labelWidth-badgeWidth-toggleWidth-filterWidth, 0)).Push(gtx.Ops)
+		m.layoutFilterBadge(gtx, th, image.Pt(filterWidth, labelHeight))
+		filterOff.Pop()
+	}
+
+	toggleOff := op.Offset(image.Pt(labelWidth-badgeWidth-toggleWidth, 0)).Push(gtx.Ops)
+	m.layoutHeaderToggle(gtx, th, image.Pt(toggleWidth, labelHeight))
+	toggleOff.Pop()
+
+	badgeOff := op.Offset(image.Pt(labelWidth-badgeWidth, 0)).Push(gtx.Ops)
+	m.layoutModeBadge(gtx, th, image.Pt(badgeWidth, labelHeight))
+	badgeOff.Pop()
+	off.Pop()
+
+	if m.exprErr != nil {
+		off := op.Offset(image.Pt(0, m.Size.Round().Y+gtx.Dp(2))).Push(gtx.Ops)
+		l := material.Label(th, unit.Sp(12), m.exprErr.Error())
+		l.Color = color.NRGBA{R: 230, G: 90, B: 90, A: 255}
+		l.Layout(gtx.Context)
+		off.Pop()
+	}
+}
+
+// layoutModeBadge shows the matrix's numeric mode, asking for it to be
+// toggled between FloatMode and DecimalMode when clicked.
+func (m *Matrix[T]) layoutModeBadge(gtx *context.Context, th *material.Theme, size image.Point) {
+	if m.modeButton == nil {
+		m.modeButton = &gesturex.ButtonEvents{Tag: &m.Mode}
+	}
+
+	mode := "f64"
+	if m.Mode == DecimalMode {
+		mode = fmt.Sprintf("dec(%d)", m.Precision)
+	}
+	l := material.Label(th, unit.Sp(11), mode)
+	l.Color = color.NRGBA{R: 140, G: 140, B: 140, A: 255}
+	l.Alignment = text.End
+	lgtx := gtx.Context
+	lgtx.Constraints = layout.Exact(size)
+	l.Layout(lgtx)
+
+	stack := clip.Rect(image.Rectangle{Max: size}).Push(gtx.Ops)
+	m.modeButton.Add(gtx.Ops)
+	m.modeButton.Events(gtx.Metric, gtx.Ops, gtx.Queue, nil, nil, func() {
+		if m.Mode == DecimalMode {
+			gtx.PushEvent(context.SetNumericMode{Matrix: m.Name, Precision: m.Precision})
+			return
+		}
+		gtx.PushEvent(context.SetNumericMode{Matrix: m.Name, Decimal: true, Precision: defaultDecimalPrecision})
+	})
+	stack.Pop()
+}
+
+// label returns the text shown above the matrix, its name followed by
+// its defining expression if it is derived from other matrices.
+func (m *Matrix[T]) label() string {
+	if m.expr == nil {
+		return m.Name
+	}
+	return m.Name + " = " + formula.Format(m.expr)
+}
+
 func renderPendingSelectionSpan(gtx *context.Context, span f32x.Rectangle, color color.NRGBA) {
 	selectionArea := image.Rect(gtx.Dp(unit.Dp(span.Min.X)), gtx.Dp(unit.Dp(span.Min.Y)), gtx.Dp(unit.Dp(span.Max.X)), gtx.Dp(unit.Dp(span.Max.Y)))
 	selectionClip := clip.Rect{Min: selectionArea.Min, Max: selectionArea.Max}.Push(gtx.Ops)
@@ -130,8 +534,7 @@ func renderPendingSelectionSpan(gtx *context.Context, span f32x.Rectangle, color
 	selectionClip.Pop()
 }
 
-func renderCellSelection(gtx *context.Context, x, y, cellwidth, cellheight int) {
-	cell := image.Rect((cellwidth * x), (y * cellheight), ((cellwidth * x) + cellwidth), ((cellheight * y) + cellheight))
+func renderCellSelection(gtx *context.Context, cell image.Rectangle) {
 	// render cell border
 	borderWidth := 2 * float32(gtx.Dp(1))
 	borderColor := color.NRGBA{R: 230, G: 90, B: 90, A: 255}
@@ -141,9 +544,42 @@ func renderCellSelection(gtx *context.Context, x, y, cellwidth, cellheight int)
 	cl3.Pop()
 }
 
-func renderCell(gtx *context.Context, content string, x, y, cellwidth, cellheight int, bgcolor color.NRGBA, th *material.Theme) {
+func renderErrorCell(gtx *context.Context, code string, cell image.Rectangle, th *material.Theme) {
+	cl1 := clip.Rect{Min: cell.Min, Max: cell.Max}.Push(gtx.Ops)
+	paint.ColorOp{Color: color.NRGBA{R: 252, G: 228, B: 228, A: 255}}.Add(gtx.Ops)
+	paint.PaintOp{}.Add(gtx.Ops)
+
+	l := material.Label(th, unit.Sp(14), code)
+	l.Font.Weight = font.Bold
+	l.Color = color.NRGBA{R: 190, G: 30, B: 30, A: 255}
+	lineHeightPx := gtx.Sp(14)
+	off := op.Offset(cell.Min.Add(image.Pt(gtx.Sp(3), (cell.Dy()/2)-(lineHeightPx/2)))).Push(gtx.Ops)
+	l.Layout(gtx.Context)
+	off.Pop()
+	cl1.Pop()
+}
+
+// renderPendingCell marks a formula cell whose value is still being
+// computed.
+func renderPendingCell(gtx *context.Context, cell image.Rectangle, th *material.Theme) {
+	cl1 := clip.Rect{Min: cell.Min, Max: cell.Max}.Push(gtx.Ops)
+	paint.ColorOp{Color: color.NRGBA{R: 120, G: 160, B: 230, A: 60}}.Add(gtx.Ops)
+	paint.PaintOp{}.Add(gtx.Ops)
+
+	l := material.Label(th, unit.Sp(14), "…")
+	l.Color = color.NRGBA{R: 60, G: 90, B: 160, A: 255}
+	lineHeightPx := gtx.Sp(14)
+	off := op.Offset(cell.Min.Add(image.Pt(cell.Dx()-gtx.Sp(14), (cell.Dy()/2)-(lineHeightPx/2)))).Push(gtx.Ops)
+	l.Layout(gtx.Context)
+	off.Pop()
+	cl1.Pop()
+}
+
+func renderCell(gtx *context.Context, content string, cell image.Rectangle, style cellStyle, bgcolor color.NRGBA, th *material.Theme) {
 	// render background of cell
-	cell := image.Rect(cellwidth*x, y*cellheight, ((cellwidth * x) + cellwidth), ((cellheight * y) + cellheight))
+	if style.Fill != nil && style.Fill.A > 0 {
+		bgcolor = color.NRGBA(*style.Fill)
+	}
 	cl1 := clip.Rect{Min: cell.Min, Max: cell.Max}.Push(gtx.Ops)
 	paint.ColorOp{Color: bgcolor}.Add(gtx.Ops)
 	paint.PaintOp{}.Add(gtx.Ops)
@@ -152,16 +588,50 @@ func renderCell(gtx *context.Context, content string, x, y, cellwidth, cellheigh
 	// render cell content as text label
 	cl2 := clip.Rect{Min: cell.Min, Max: cell.Max}.Push(gtx.Ops)
 	l := material.Label(th, unit.Sp(14), content)
+	l.MaxLines = 1
 	lineHeightPx := gtx.Sp(14)
 	l.Color = color.NRGBA{R: 10, G: 10, B: 10, A: 255}
-	off := op.Offset(cell.Min.Add(image.Pt(gtx.Sp(3), (cellheight/2)-(lineHeightPx/2)))).Push(gtx.Ops)
-	l.Layout(gtx.Context)
+	if style.Text != nil {
+		l.Color = color.NRGBA(*style.Text)
+	}
+	if style.Bold != nil && *style.Bold {
+		l.Font.Weight = font.Bold
+	}
+	if style.Italic != nil && *style.Italic {
+		l.Font.Style = font.Italic
+	}
+	inset := gtx.Dp(cellInset)
+	lgtx := gtx.Context
+	lgtx.Constraints.Min = image.Point{}
+	if style.Align != nil && *style.Align != "left" {
+		// aligned text is laid out across the cell's width
+		lgtx.Constraints = layout.Exact(image.Pt(cell.Dx()-2*inset, lineHeightPx))
+		l.Alignment = text.Middle
+		if *style.Align == "right" {
+			l.Alignment = text.End
+		}
+	}
+	y := (cell.Dy() / 2) - (lineHeightPx / 2)
+	if style.VAlign != nil {
+		switch *style.VAlign {
+		case "top":
+			y = inset
+		case "bottom":
+			y = cell.Dy() - lineHeightPx - inset
+		}
+	}
+	off := op.Offset(cell.Min.Add(image.Pt(inset, y))).Push(gtx.Ops)
+	l.Layout(lgtx)
 	off.Pop()
 	cl2.Pop()
 
 	// render cell border
 	borderWidth := float32(.25) / float32(gtx.Dp(1))
 	borderColor := color.NRGBA{R: 55, G: 55, B: 55, A: 255}
+	if style.Border != nil && style.Border.Width > 0 {
+		borderWidth = style.Border.Width * float32(gtx.Dp(1))
+		borderColor = color.NRGBA(style.Border.Colour)
+	}
 	cl3 := clip.Stroke{Path: clip.RRect{Rect: cell}.Path(gtx.Ops), Width: borderWidth}.Op().Push(gtx.Ops)
 	paint.ColorOp{Color: borderColor}.Add(gtx.Ops)
 	paint.PaintOp{}.Add(gtx.Ops)
@@ -192,6 +662,15 @@ func (m *Matrix[T]) Update(gtx layout.Context, debug bool) {
 
 	m.inputEvents.Events(gtx.Metric, gtx.Ops, gtx.Queue, m.pressEvents(gtx.Dp), m.releaseEvents(gtx.Dp), m.primaryButtonDragEvents(gtx.Dp), m.secondaryButtonDragEvents(gtx.Dp))
 	stack.Pop()
+
+	m.layoutEdges(gtx, posPt)
+	m.layoutFillHandle(gtx, posPt)
+	m.layoutHeaderInput(gtx, posPt)
+
+	if m.editing.focus || (m.editing.active && !m.editing.hadFocus) || m.fitting != nil || m.filling.done {
+		// focus changes and the editor opening take effect next frame
+		op.InvalidateOp{}.Add(gtx.Ops)
+	}
 }
 
 func (m *Matrix[T]) pressEvents(dp func(v unit.Dp) int) func(pos f32.Point, buttons pointer.Buttons) {
@@ -215,48 +694,42 @@ func (m *Matrix[T]) releaseEvents(dp func(v unit.Dp) int) func(pos f32.Point, bu
 		if buttons == pointer.ButtonPrimary {
 			selectionArea := m.pendingSelectionBounds.SwappedBounds()
 			if !selectionArea.Empty() {
-				m.SelectedCells = resolveSelectedCells(m.Data.Dims())(dp, m.Pos, m.cellSize, selectionArea)
+				m.SelectedCells = resolveSelectedCells(m.grid())(dp, m.Pos, selectionArea)
+				if n := len(m.SelectedCells); n > 0 {
+					m.cursor = m.SelectedCells[n-1]
+				}
 				m.pendingSelectionBounds = f32x.Rectangle{}
 				return
 			}
-			m.SelectedCells = []image.Point{resolvePressedCell(m.Data.Dims())(dp, m.Pos, m.cellSize, pos)}
+			cell := resolvePressedCell(m.grid())(dp, m.Pos, pos)
+			m.selectCell(cell)
+			m.click(cell)
+		}
+		if buttons == pointer.ButtonSecondary {
+			// the drag moving the matrix is over
+			m.drags++
 		}
 	}
 }
 
-func in(p f32.Point, r f32x.Rectangle) bool {
-	return r.Min.X <= p.X && p.X < r.Max.X &&
-		r.Min.Y <= p.Y && p.Y < r.Max.Y
-}
-
-func resolvePressedCell(rows, cols int) func(dp func(v unit.Dp) int, pos, cellSize f32.Point, pressPos f32.Point) image.Point {
-	return func(dp func(v unit.Dp) int, pos, cellSize f32.Point, pressPos f32.Point) image.Point {
+func resolvePressedCell(g grid) func(dp func(v unit.Dp) int, pos f32.Point, pressPos f32.Point) image.Point {
+	return func(dp func(v unit.Dp) int, pos f32.Point, pressPos f32.Point) image.Point {
 		pressPos = pressPos.Div(float32(dp(1)))
 
-		var x, y float32
-		for x = 0; x < float32(cols); x++ {
-			for y = 0; y < float32(rows); y++ {
-				cell := f32x.Rectangle{Min: f32.Pt(pos.X+(cellSize.X*x), pos.Y+(cellSize.Y*y)), Max: f32.Pt(pos.X+((cellSize.X*x)+cellSize.X), pos.Y+((cellSize.Y*y)+cellSize.Y))}
-				if in(pressPos, cell) {
-					return image.Pt(int(x), int(y))
-				}
-			}
+		cell, ok := g.at(pressPos.Sub(pos))
+		if !ok {
+			return image.Pt(0, 0)
 		}
-		return image.Pt(0, 0)
+		return cell
 	}
 }
 
-func resolveSelectedCells(rows, cols int) func(dp func(v unit.Dp) int, pos, cellSize f32.Point, selection f32x.Rectangle) []image.Point {
-	return func(dp func(v unit.Dp) int, pos, cellSize f32.Point, selection f32x.Rectangle) []image.Point {
-		selection.Min = selection.Min.Add(pos)
-		selection.Max = selection.Max.Add(pos)
-
+func resolveSelectedCells(g grid) func(dp func(v unit.Dp) int, pos f32.Point, selection f32x.Rectangle) []image.Point {
+	return func(dp func(v unit.Dp) int, pos f32.Point, selection f32x.Rectangle) []image.Point {
 		selectedCells := []image.Point{}
-		var x, y float32
-		for x = 0; x < float32(cols); x++ {
-			for y = 0; y < float32(rows); y++ {
-				cell := f32x.Rectangle{Min: f32.Pt(pos.X+(cellSize.X*x), pos.Y+(cellSize.Y*y)), Max: f32.Pt(pos.X+((cellSize.X*x)+cellSize.X), pos.Y+((cellSize.Y*y)+cellSize.Y))}
-				if selection.Overlaps(cell) {
+		for x := 0; x < len(g.xs)-1; x++ {
+			for y := 0; y < len(g.ys)-1; y++ {
+				if selection.Overlaps(g.cell(image.Pt(x, y))) {
 					selectedCells = append(selectedCells, image.Pt(int(x), int(y)))
 				}
 			}
@@ -269,10 +742,7 @@ func (m *Matrix[T]) makeCellSelection(dp func(v unit.Dp) int, pos f32.Point) {
 	// make press postion relative to this matrix
 	pos = pos.Sub(f32.Pt(m.Pos.X, m.Pos.Y))
 	scaledDiff := pos.Div(float32(dp(1)))
-	cellx := math.Floor(float64(scaledDiff.X) / float64(m.cellSize.X))
-	celly := math.Floor(float64(scaledDiff.Y) / float64(m.cellSize.Y))
-	m.selectedCell.X = int(cellx)
-	m.selectedCell.Y = int(celly)
+	m.selectedCell, _ = m.grid().at(scaledDiff)
 }
 
 func (m *Matrix[T]) primaryButtonDragEvents(dp func(v unit.Dp) int) func(diff f32.Point) {
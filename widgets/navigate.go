@@ -0,0 +1,179 @@
+package widgets
+
+import (
+	"image"
+
+	"gioui.org/f32"
+	"gioui.org/io/key"
+	"github.com/tauraamui/nebula/context"
+	"github.com/tauraamui/nebula/f32x"
+)
+
+// selectCell selects the single cell pos, moving the cursor to it.
+func (m *Matrix[T]) selectCell(pos image.Point) {
+	m.selectRange(pos, pos)
+}
+
+// selectRange selects every cell in the rectangle spanned by anchor and
+// cursor. The anchor is kept first, so that typing goes to it.
+func (m *Matrix[T]) selectRange(anchor, cursor image.Point) {
+	m.cursor = cursor
+	min, max := anchor, cursor
+	if min.X > max.X {
+		min.X, max.X = max.X, min.X
+	}
+	if min.Y > max.Y {
+		min.Y, max.Y = max.Y, min.Y
+	}
+	cells := []image.Point{anchor}
+	for x := min.X; x <= max.X; x++ {
+		for y := min.Y; y <= max.Y; y++ {
+			if p := image.Pt(x, y); p != anchor {
+				cells = append(cells, p)
+			}
+		}
+	}
+	m.SelectedCells = cells
+}
+
+// navigate moves the selection for an arrow, Home, End, PageUp or
+// PageDown key. Shift extends the selection from its anchor rather than
+// moving it, and the shortcut modifier jumps to the edge of the data.
+// It reports whether e was such a key.
+func (m *Matrix[T]) navigate(gtx *context.Context, e key.Event) bool {
+	anchor, ok := m.selectedCellPos()
+	if !ok {
+		return false
+	}
+	cursor := anchor
+	if e.Modifiers.Contain(key.ModShift) {
+		cursor = m.cursor
+	}
+	from := cursor.Y
+	jump := e.Modifiers.Contain(key.ModShortcut)
+
+	rows, cols := m.Data.Dims()
+	page := float32(gtx.Constraints.Max.Y) / float32(gtx.Dp(1))
+	switch e.Name {
+	case key.NameLeftArrow:
+		cursor = m.step(cursor, image.Pt(-1, 0), jump)
+	case key.NameRightArrow:
+		cursor = m.step(cursor, image.Pt(1, 0), jump)
+	case key.NameUpArrow:
+		cursor = m.step(cursor, image.Pt(0, -1), jump)
+	case key.NameDownArrow:
+		cursor = m.step(cursor, image.Pt(0, 1), jump)
+	case key.NameHome:
+		cursor.X = 0
+		if jump {
+			cursor.Y = 0
+		}
+	case key.NameEnd:
+		cursor.X = cols - 1
+		if jump {
+			cursor.Y = rows - 1
+		}
+	case key.NamePageUp:
+		cursor.Y = m.grid().pageRow(cursor.Y, -page)
+	case key.NamePageDown:
+		cursor.Y = m.grid().pageRow(cursor.Y, page)
+	default:
+		return false
+	}
+	cursor = clampCell(cursor, rows, cols)
+	cursor.Y = m.visibleRow(cursor.Y, cursor.Y-from)
+
+	if e.Modifiers.Contain(key.ModShift) {
+		m.selectRange(anchor, cursor)
+	} else {
+		m.selectCell(cursor)
+	}
+	gtx.PushEvent(context.Reveal{Bounds: m.cellBounds(cursor)})
+	return true
+}
+
+// step moves cell by one cell in direction dir, or when jump is set to
+// the edge of the data in that direction: the last filled cell of a run
+// of filled cells, else the next filled cell, else the matrix's edge.
+func (m *Matrix[T]) step(cell, dir image.Point, jump bool) image.Point {
+	rows, cols := m.Data.Dims()
+	inside := func(p image.Point) bool {
+		return p.X >= 0 && p.Y >= 0 && p.X < cols && p.Y < rows
+	}
+	next := cell.Add(dir)
+	if !jump || !inside(next) {
+		return next
+	}
+	if !m.empty(cell) && !m.empty(next) {
+		for inside(next.Add(dir)) && !m.empty(next.Add(dir)) {
+			next = next.Add(dir)
+		}
+		return next
+	}
+	for inside(next.Add(dir)) && m.empty(next) {
+		next = next.Add(dir)
+	}
+	return next
+}
+
+// visibleRow returns the nearest row to y the filter does not hide,
+// looking in the direction of dir first, or y if every row is hidden.
+func (m *Matrix[T]) visibleRow(y, dir int) int {
+	rows, _ := m.Data.Dims()
+	if dir < 0 {
+		dir = -1
+	} else {
+		dir = 1
+	}
+	for _, d := range []int{dir, -dir} {
+		for r := y; r >= 0 && r < rows; r += d {
+			if !m.RowHidden(r) {
+				return r
+			}
+		}
+	}
+	return y
+}
+
+func clampCell(cell image.Point, rows, cols int) image.Point {
+	if cell.X < 0 {
+		cell.X = 0
+	}
+	if cell.X >= cols {
+		cell.X = cols - 1
+	}
+	if cell.Y < 0 {
+		cell.Y = 0
+	}
+	if cell.Y >= rows {
+		cell.Y = rows - 1
+	}
+	return cell
+}
+
+// cellBounds returns the area of the cell at pos on the canvas.
+func (m *Matrix[T]) cellBounds(pos image.Point) f32x.Rectangle {
+	cell := m.grid().cell(pos)
+	return f32x.Rectangle{Min: m.Pos.Add(cell.Min), Max: m.Pos.Add(cell.Max)}
+}
+
+// reveal pans the canvas as little as possible to bring bounds into view
+// within a window of size pixels shown at zoom.
+func (c *Canvas) reveal(bounds f32x.Rectangle, size image.Point, dp, zoom float32) {
+	const margin = 20
+	view := f32.Pt(float32(size.X), float32(size.Y)).Div(dp * zoom)
+	min := c.offset.Mul(-1)
+	max := min.Add(view)
+	switch {
+	case bounds.Min.X-margin < min.X:
+		c.offset.X = margin - bounds.Min.X
+	case bounds.Max.X+margin > max.X:
+		c.offset.X = view.X - bounds.Max.X - margin
+	}
+	switch {
+	case bounds.Min.Y-margin < min.Y:
+		c.offset.Y = margin - bounds.Min.Y
+	case bounds.Max.Y+margin > max.Y:
+		c.offset.Y = view.Y - bounds.Max.Y - margin
+	}
+}
@@ -0,0 +1,380 @@
+package widgets
+
+import (
+	stdcontext "context"
+	"fmt"
+	"image"
+	"sync"
+
+	"github.com/tauraamui/nebula/decimal"
+	"github.com/tauraamui/nebula/formula"
+	nmat "github.com/tauraamui/nebula/mat"
+	"github.com/tauraamui/nebula/script"
+	"github.com/tauraamui/nebula/units"
+	"gonum.org/v1/gonum/mat"
+)
+
+// recalculation is a batch of formulas being evaluated off the frame
+// loop, against a snapshot of the matrices taken when it started.
+type recalculation struct {
+	ids      []formula.CellID
+	cancel   stdcontext.CancelFunc
+	outcomes []outcome
+}
+
+// outcome is the result of evaluating a single formula cell, or a whole
+// derived matrix when res is set.
+type outcome struct {
+	id  formula.CellID
+	v   formula.Value
+	res nmat.Matrix[float64]
+	err error
+}
+
+// recalculate applies the results of a finished recalculation, then
+// updates the dependency graph with the cells changed since the last
+// call and starts re-evaluating only the formulas affected by them.
+func (c *Canvas) recalculate() {
+	c.applyFinished()
+
+	changed := []formula.CellID{}
+	for _, m := range c.matrices {
+		if len(m.changed) > 0 || len(m.spilled) > 0 {
+			changed = append(changed, formula.WholeMatrix(m.Name))
+		}
+		for pos := range m.changed {
+			id := formula.CellID{Matrix: m.Name, Row: pos.Y, Col: pos.X}
+			if anchor, ok := m.spillAt(pos); ok {
+				// the cell is in the way of a spill, which is evaluated
+				// again to either block it or take the cell back
+				m.clearSpill(anchor, m.changed)
+				changed = append(changed, formula.CellID{Matrix: m.Name, Row: anchor.Y, Col: anchor.X})
+			}
+			if n, ok := m.formulas[pos]; ok {
+				refs, ranges := c.references(n, m.Name)
+				c.graph.Set(id, refs, ranges)
+			} else {
+				c.graph.Remove(id)
+				delete(m.errs, pos)
+				m.clearSpill(pos, m.changed)
+			}
+			changed = append(changed, id)
+		}
+		for pos := range m.spilled {
+			changed = append(changed, formula.CellID{Matrix: m.Name, Row: pos.Y, Col: pos.X})
+		}
+		m.changed, m.spilled = nil, nil
+	}
+	if len(changed) == 0 {
+		return
+	}
+	c.finding.stale = true
+	c.startRecalculation(changed)
+}
+
+// rebuildGraph recreates the dependency graph from scratch and evaluates
+// every formula, used when matrix names change meaning. A search by the
+// solver is stopped, as the cells it writes to may have moved.
+func (c *Canvas) rebuildGraph() {
+	c.stopSolving()
+	c.finding.stale = true
+	c.graph = formula.NewGraph()
+	for _, m := range c.matrices {
+		m.errs = map[image.Point]formula.Error{}
+		m.changed = nil
+		if m.expr != nil {
+			refs := []formula.CellID{}
+			for _, name := range formula.MatrixNames(m.expr) {
+				refs = append(refs, formula.WholeMatrix(name))
+			}
+			c.graph.Set(formula.WholeMatrix(m.Name), refs, nil)
+		}
+		for _, pos := range formulaCells(m) {
+			refs, ranges := c.references(m.formulas[pos], m.Name)
+			c.graph.Set(formula.CellID{Matrix: m.Name, Row: pos.Y, Col: pos.X}, refs, ranges)
+		}
+	}
+	c.startRecalculation(c.graph.Formulas())
+}
+
+// startRecalculation cancels any recalculation in progress and starts a
+// new one covering the formulas affected by changed, along with those the
+// cancelled recalculation had not delivered.
+func (c *Canvas) startRecalculation(changed []formula.CellID) {
+	if r := c.inflight; r != nil {
+		r.cancel()
+		changed = append(changed, r.ids...)
+		c.setPending(r.ids, false)
+		c.inflight = nil
+	}
+
+	order, cyclic := c.graph.Affected(changed...)
+	for _, id := range cyclic {
+		m := c.matrixByName(id.Matrix)
+		if m == nil {
+			continue
+		}
+		if id == formula.WholeMatrix(id.Matrix) {
+			m.exprErr = formula.ErrCycle
+			continue
+		}
+		m.setResult(image.Pt(id.Col, id.Row), nil, formula.ErrCycle)
+	}
+	if len(order) == 0 {
+		return
+	}
+
+	ctx, cancel := stdcontext.WithCancel(stdcontext.Background())
+	r := &recalculation{ids: order, cancel: cancel}
+	c.inflight = r
+	c.setPending(order, true)
+	go c.run(ctx, r, c.snapshot(), c.script, c.levels(order))
+}
+
+// levels groups order into successive sets of formulas which only read
+// formulas from earlier sets, so each set can be evaluated concurrently.
+func (c *Canvas) levels(order []formula.CellID) [][]formula.CellID {
+	depth := map[formula.CellID]int{}
+	levels := [][]formula.CellID{}
+	for _, id := range order {
+		d := depth[id]
+		if d == len(levels) {
+			levels = append(levels, nil)
+		}
+		levels[d] = append(levels[d], id)
+		for _, dep := range c.graph.Dependents(id) {
+			if depth[dep] < d+1 {
+				depth[dep] = d + 1
+			}
+		}
+	}
+	return levels
+}
+
+// snapshot copies every matrix so that a recalculation can read them
+// while the frame loop carries on changing the originals.
+func (c *Canvas) snapshot() map[string]*Matrix[float64] {
+	matrices := make(map[string]*Matrix[float64], len(c.matrices))
+	for _, m := range c.matrices {
+		matrices[m.Name] = m.clone()
+	}
+	return matrices
+}
+
+// run evaluates r level by level on the worker pool. Outcomes of each
+// level are stored in the snapshot before the next level starts, and are
+// delivered to the frame loop once every level is done unless r has been
+// cancelled in the meantime.
+func (c *Canvas) run(ctx stdcontext.Context, r *recalculation, snapshot map[string]*Matrix[float64], prog *script.Program, levels [][]formula.CellID) {
+	for _, level := range levels {
+		outcomes := make([]outcome, len(level))
+		var wg sync.WaitGroup
+		for i, id := range level {
+			i, id := i, id
+			wg.Add(1)
+			c.pool.Go(func() {
+				defer wg.Done()
+				defer func() {
+					// a bug in evaluation fails the cell rather than the app
+					if p := recover(); p != nil {
+						outcomes[i] = outcome{id: id, err: formula.Error{Code: formula.CodeValue, Cause: fmt.Errorf("evaluation failed: %v", p)}}
+					}
+				}()
+				if ctx.Err() != nil {
+					return
+				}
+				outcomes[i] = evaluate(ctx, snapshot, prog, id)
+			})
+		}
+		wg.Wait()
+		if ctx.Err() != nil {
+			return
+		}
+		for _, o := range outcomes {
+			apply(snapshot, o)
+		}
+		r.outcomes = append(r.outcomes, outcomes...)
+	}
+
+	select {
+	case c.finished <- r:
+	case <-ctx.Done():
+		return
+	}
+	if c.invalidate != nil {
+		c.invalidate()
+	}
+}
+
+// applyFinished stores the outcomes of the current recalculation in the
+// canvas's matrices once it has finished.
+func (c *Canvas) applyFinished() {
+	for {
+		select {
+		case r := <-c.finished:
+			if r != c.inflight {
+				continue
+			}
+			matrices := make(map[string]*Matrix[float64], len(c.matrices))
+			for _, m := range c.matrices {
+				matrices[m.Name] = m
+			}
+			for _, o := range r.outcomes {
+				apply(matrices, o)
+			}
+			c.setPending(r.ids, false)
+			c.inflight = nil
+			c.finding.stale = true
+		default:
+			return
+		}
+	}
+}
+
+// setPending marks the cells of ids as being computed or not, so that
+// they can show an indicator while their result is outstanding.
+func (c *Canvas) setPending(ids []formula.CellID, pending bool) {
+	for _, id := range ids {
+		m := c.matrixByName(id.Matrix)
+		if m == nil {
+			continue
+		}
+		if id == formula.WholeMatrix(id.Matrix) {
+			m.computing = pending
+			continue
+		}
+		pos := image.Pt(id.Col, id.Row)
+		if !pending {
+			delete(m.pending, pos)
+			continue
+		}
+		if m.pending == nil {
+			m.pending = map[image.Point]struct{}{}
+		}
+		m.pending[pos] = struct{}{}
+	}
+}
+
+func evaluate(ctx stdcontext.Context, matrices map[string]*Matrix[float64], prog *script.Program, id formula.CellID) outcome {
+	m := matrices[id.Matrix]
+	if m == nil {
+		return outcome{id: id, err: formula.RefError("unknown matrix %q", id.Matrix)}
+	}
+	env := matrixEnv{matrices: matrices, owner: m, script: prog, ctx: ctx}
+	if id == formula.WholeMatrix(id.Matrix) {
+		res, err := formula.EvalMatrix(m.expr, env)
+		return outcome{id: id, res: res, err: err}
+	}
+	pos := image.Pt(id.Col, id.Row)
+	n := resolveLabels(m.formulas[pos], m, func(name string) *Matrix[float64] { return matrices[name] })
+	v, err := formula.Eval(n, env)
+	if arr, ok := v.(*formula.Array); ok && err == nil && readsSpill(n, m.Name, pos, spillArea(pos, arr)) {
+		// spilled cells are not in the graph, so this cycle is only
+		// found once the result's size is known
+		return outcome{id: id, err: errSpillCycle}
+	}
+	return outcome{id: id, v: v, err: err}
+}
+
+func apply(matrices map[string]*Matrix[float64], o outcome) {
+	m := matrices[o.id.Matrix]
+	if m == nil {
+		return
+	}
+	if o.id == formula.WholeMatrix(o.id.Matrix) {
+		m.setDerived(o.res, o.err)
+		return
+	}
+	if rows, cols := m.Data.Dims(); o.id.Row >= rows || o.id.Col >= cols {
+		return
+	}
+	m.setResult(image.Pt(o.id.Col, o.id.Row), o.v, o.err)
+}
+
+// setDerived stores the result of a derived matrix's expression, resizing
+// the matrix to the shape of the result.
+func (m *Matrix[T]) setDerived(res nmat.Matrix[float64], err error) {
+	if err != nil {
+		m.exprErr = formula.AsError(err)
+		return
+	}
+	m.exprErr = nil
+	rows, cols := res.Dims()
+	if r, c := m.Data.Dims(); r != rows || c != cols {
+		m.Data = mat.NewDense(rows, cols, nil)
+		m.cachedOps = nil
+	}
+	for i := 0; i < rows; i++ {
+		for j := 0; j < cols; j++ {
+			m.Data.Set(i, j, res.At(i, j))
+		}
+	}
+	m.syncDecimals()
+}
+
+// clone copies the parts of m read and written by formula evaluation.
+func (m *Matrix[T]) clone() *Matrix[T] {
+	c := &Matrix[T]{
+		Name:       m.Name,
+		Mode:       m.Mode,
+		Precision:  m.Precision,
+		Data:       mat.DenseCopyOf(m.Data),
+		formulas:   make(map[image.Point]formula.Node, len(m.formulas)),
+		errs:       make(map[image.Point]formula.Error, len(m.errs)),
+		cellUnits:  make(map[image.Point]units.Unit, len(m.cellUnits)),
+		spills:     make(map[image.Point]spill, len(m.spills)),
+		expr:       m.expr,
+		exprErr:    m.exprErr,
+		colWidths:  copyIndexed(m.colWidths),
+		rowHeights: copyIndexed(m.rowHeights),
+		styles:     append([]styledRange(nil), m.styles...),
+		colLabels:  copyIndexed(m.colLabels),
+		rowLabels:  copyIndexed(m.rowLabels),
+		filter:     m.filter,
+		hidden:     copyIndexed(m.hidden),
+	}
+	c.setFormats(m.formats())
+	for pos, s := range m.spills {
+		c.spills[pos] = s
+	}
+	for pos, n := range m.formulas {
+		c.formulas[pos] = n
+	}
+	for pos, err := range m.errs {
+		c.errs[pos] = err
+	}
+	for pos, u := range m.cellUnits {
+		c.cellUnits[pos] = u
+	}
+	if m.decimals != nil {
+		rows, cols := m.decimals.Dims()
+		c.decimals = nmat.New[decimal.Decimal](rows, cols, nil).(nmat.Mutable[decimal.Decimal])
+		for i := 0; i < rows; i++ {
+			for j := 0; j < cols; j++ {
+				c.decimals.Set(i, j, m.decimals.At(i, j))
+			}
+		}
+	}
+	return c
+}
+
+// post queues fn to run on the frame loop, for work done in the
+// background to store its results.
+func (c *Canvas) post(fn func()) {
+	c.jobs <- fn
+	if c.invalidate != nil {
+		c.invalidate()
+	}
+}
+
+// runJobs runs the functions queued by post.
+func (c *Canvas) runJobs() {
+	for {
+		select {
+		case fn := <-c.jobs:
+			fn()
+		default:
+			return
+		}
+	}
+}
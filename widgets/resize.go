@@ -0,0 +1,180 @@
+package widgets
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"gioui.org/f32"
+	"gioui.org/io/pointer"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget/material"
+	"github.com/tauraamui/nebula/context"
+	"github.com/tauraamui/nebula/gesturex"
+)
+
+// resizeHandleWidth is the width of the strips along the right and bottom
+// edges of a matrix which are dragged to resize it.
+const resizeHandleWidth unit.Dp = 6
+
+// resizeHandle is dragged to move the edges of a matrix in dir, the right
+// edge for (1, 0), the bottom for (0, 1) and both for (1, 1).
+type resizeHandle struct {
+	input *gesturex.InputEvents
+	dir   image.Point
+}
+
+// resizing holds the state of a matrix being resized by its handles.
+type resizing struct {
+	handles    []*resizeHandle
+	active     bool
+	dir        image.Point
+	drag       f32.Point
+	rows, cols int
+	// size is the size of the outline in dp
+	size f32.Point
+	// confirm is set while waiting to be told whether to discard the
+	// cells a smaller size would cut off
+	confirm         bool
+	discarded       int
+	discard, cancel *gesturex.ButtonEvents
+}
+
+// layoutResize lays out the resize handles outside the matrix's right and
+// bottom edges, and while dragging them an outline of the new size.
+func (m *Matrix[T]) layoutResize(gtx *context.Context, th *material.Theme) {
+	r := &m.resizing
+	if r.handles == nil {
+		for _, dir := range []image.Point{{X: 1}, {Y: 1}, {X: 1, Y: 1}} {
+			h := &resizeHandle{dir: dir}
+			h.input = &gesturex.InputEvents{Tag: h}
+			r.handles = append(r.handles, h)
+		}
+		r.discard = &gesturex.ButtonEvents{Tag: &r.discard}
+		r.cancel = &gesturex.ButtonEvents{Tag: &r.cancel}
+	}
+
+	size := m.Size.Round()
+	w := gtx.Dp(resizeHandleWidth)
+	for _, h := range r.handles {
+		area := image.Rect(0, 0, size.X, size.Y)
+		cursor := pointer.CursorColResize
+		switch h.dir {
+		case image.Pt(1, 0):
+			area.Min.X, area.Max.X = size.X, size.X+w
+		case image.Pt(0, 1):
+			area.Min.Y, area.Max.Y = size.Y, size.Y+w
+			cursor = pointer.CursorRowResize
+		default:
+			area = image.Rect(size.X, size.Y, size.X+w, size.Y+w)
+			cursor = pointer.CursorNorthWestSouthEastResize
+			knob := clip.Rect(area).Push(gtx.Ops)
+			paint.ColorOp{Color: color.NRGBA{R: 120, G: 120, B: 120, A: 255}}.Add(gtx.Ops)
+			paint.PaintOp{}.Add(gtx.Ops)
+			knob.Pop()
+		}
+		stack := clip.Rect(area).Push(gtx.Ops)
+		h.input.Add(gtx.Ops)
+		h.input.Events(gtx.Metric, gtx.Ops, gtx.Queue, m.resizePressEvents(h.dir), m.resizeReleaseEvents(gtx), m.resizeDragEvents(gtx.Dp), nil)
+		cursor.Add(gtx.Ops)
+		stack.Pop()
+	}
+
+	if r.active {
+		outline := image.Rectangle{Max: image.Pt(gtx.Dp(unit.Dp(r.size.X)), gtx.Dp(unit.Dp(r.size.Y)))}
+		border := clip.Stroke{Path: clip.RRect{Rect: outline}.Path(gtx.Ops), Width: 2 * float32(gtx.Dp(1))}.Op().Push(gtx.Ops)
+		paint.ColorOp{Color: color.NRGBA{R: 60, G: 120, B: 230, A: 255}}.Add(gtx.Ops)
+		paint.PaintOp{}.Add(gtx.Ops)
+		border.Pop()
+		renderTooltip(gtx, fmt.Sprintf("%d × %d", r.rows, r.cols), outline.Max.Add(image.Pt(gtx.Dp(4), gtx.Dp(4))), th)
+	}
+
+	if r.confirm {
+		pos := image.Pt(0, size.Y+w+gtx.Dp(4))
+		renderTooltip(gtx, fmt.Sprintf("discard %d non-empty cells?", r.discarded), pos, th)
+		pos.Y += gtx.Dp(26)
+		layoutButton(gtx, th, r.discard, pos, "discard", func() {
+			r.confirm = false
+			gtx.PushEvent(context.ResizeMatrix{Matrix: m.Name, Rows: r.rows, Cols: r.cols})
+		})
+		layoutButton(gtx, th, r.cancel, pos.Add(image.Pt(gtx.Dp(70), 0)), "cancel", func() {
+			r.confirm = false
+		})
+	}
+}
+
+func (m *Matrix[T]) resizePressEvents(dir image.Point) func(pos f32.Point, buttons pointer.Buttons) {
+	return func(pos f32.Point, buttons pointer.Buttons) {
+		r := &m.resizing
+		r.active, r.confirm = true, false
+		r.dir = dir
+		r.drag = f32.Point{}
+		r.rows, r.cols = m.Data.Dims()
+		r.size = m.grid().size()
+	}
+}
+
+// resizeDragEvents snaps the size being dragged to to whole cells.
+func (m *Matrix[T]) resizeDragEvents(dp func(v unit.Dp) int) func(diff f32.Point) {
+	return func(diff f32.Point) {
+		r := &m.resizing
+		if !r.active {
+			return
+		}
+		r.drag = r.drag.Add(diff.Div(float32(dp(1))))
+		g := m.grid()
+		rows, cols := m.Data.Dims()
+		if r.dir.X != 0 {
+			cols = snap(g.xs, g.size().X+r.drag.X, float32(cellWidth))
+		}
+		if r.dir.Y != 0 {
+			rows = snap(g.ys, g.size().Y+r.drag.Y, float32(cellHeight))
+		}
+		r.rows, r.cols = rows, cols
+		r.size = f32.Pt(extent(g.xs, cols, float32(cellWidth)), extent(g.ys, rows, float32(cellHeight)))
+	}
+}
+
+// snapCells returns the number of whole cells of size cell nearest to
+// length, at least one.
+func snapCells(length, cell float32) int {
+	n := int(math.Round(float64(length / cell)))
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// resizeReleaseEvents asks for the matrix to be resized to the size it
+// was dragged to, first asking for confirmation if cells holding
+// something would be cut off.
+func (m *Matrix[T]) resizeReleaseEvents(gtx *context.Context) func(pos f32.Point, buttons pointer.Buttons) {
+	return func(pos f32.Point, buttons pointer.Buttons) {
+		r := &m.resizing
+		if !r.active {
+			return
+		}
+		r.active = false
+		rows, cols := m.Data.Dims()
+		if r.rows == rows && r.cols == cols {
+			return
+		}
+		r.discarded = 0
+		keep := image.Rect(0, 0, r.cols, r.rows)
+		for y := 0; y < rows; y++ {
+			for x := 0; x < cols; x++ {
+				if p := image.Pt(x, y); !p.In(keep) && !m.empty(p) {
+					r.discarded++
+				}
+			}
+		}
+		if r.discarded > 0 {
+			r.confirm = true
+			return
+		}
+		gtx.PushEvent(context.ResizeMatrix{Matrix: m.Name, Rows: r.rows, Cols: r.cols})
+	}
+}
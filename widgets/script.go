@@ -0,0 +1,156 @@
+package widgets
+
+import (
+	"image"
+	"image/color"
+
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"github.com/tauraamui/nebula/context"
+	"github.com/tauraamui/nebula/gesturex"
+	"github.com/tauraamui/nebula/script"
+)
+
+const scriptPanelWidth unit.Dp = 420
+
+// ScriptPanel edits the script attached to the document, whose functions
+// can be called from formulas.
+type ScriptPanel struct {
+	Visible     bool
+	editor      *widget.Editor
+	applyButton *gesturex.ButtonEvents
+	err         error
+}
+
+// Toggle shows or hides the panel, showing src when it is shown.
+func (p *ScriptPanel) Toggle(src string) {
+	p.Visible = !p.Visible
+	if p.editor == nil {
+		p.editor = &widget.Editor{}
+	}
+	if p.Visible {
+		p.editor.SetText(src)
+		p.err = nil
+	}
+}
+
+// Focused reports whether the panel's editor has the keyboard focus.
+func (p *ScriptPanel) Focused() bool {
+	return p.Visible && p.editor != nil && p.editor.Focused()
+}
+
+// SetSource replaces what the panel's editor holds with src, if the
+// panel has been shown.
+func (p *ScriptPanel) SetSource(src string) {
+	if p.editor != nil && p.editor.Text() != src {
+		p.editor.SetText(src)
+	}
+}
+
+// SetError shows err from the last script applied, if any.
+func (p *ScriptPanel) SetError(err error) {
+	p.err = err
+}
+
+// Layout draws the panel along the right edge of the window.
+func (p *ScriptPanel) Layout(gtx *context.Context, th *material.Theme, size image.Point) {
+	if !p.Visible {
+		return
+	}
+	if p.applyButton == nil {
+		p.applyButton = &gesturex.ButtonEvents{Tag: p}
+	}
+
+	width := gtx.Dp(scriptPanelWidth)
+	padding := gtx.Dp(8)
+	off := op.Offset(image.Pt(size.X-width, 0)).Push(gtx.Ops)
+	bgnd := clip.Rect{Max: image.Pt(width, size.Y)}.Push(gtx.Ops)
+	paint.ColorOp{Color: color.NRGBA{R: 32, G: 32, B: 36, A: 245}}.Add(gtx.Ops)
+	paint.PaintOp{}.Add(gtx.Ops)
+	bgnd.Pop()
+
+	title := material.Label(th, unit.Sp(13), "script — functions are callable from formulas in upper case")
+	title.Color = color.NRGBA{R: 160, G: 160, B: 160, A: 255}
+	titleOff := op.Offset(image.Pt(padding, padding)).Push(gtx.Ops)
+	title.Layout(gtx.Context)
+	titleOff.Pop()
+
+	footerHeight := gtx.Dp(60)
+	top := padding + gtx.Dp(24)
+	edOff := op.Offset(image.Pt(padding, top)).Push(gtx.Ops)
+	egtx := gtx.Context
+	egtx.Constraints = layout.Exact(image.Pt(width-2*padding, size.Y-top-footerHeight))
+	ed := material.Editor(th, p.editor, "def double(x):\n    return x * 2")
+	ed.TextSize = unit.Sp(13)
+	ed.Font.Typeface = "Go Mono"
+	ed.Color = color.NRGBA{R: 220, G: 220, B: 220, A: 255}
+	ed.HintColor = color.NRGBA{R: 100, G: 100, B: 100, A: 255}
+	ed.Layout(egtx)
+	edOff.Pop()
+
+	footerOff := op.Offset(image.Pt(padding, size.Y-footerHeight+padding)).Push(gtx.Ops)
+	apply := material.Label(th, unit.Sp(13), "apply")
+	apply.Color = color.NRGBA{R: 120, G: 170, B: 240, A: 255}
+	dims := apply.Layout(gtx.Context)
+	stack := clip.Rect{Max: dims.Size}.Push(gtx.Ops)
+	p.applyButton.Add(gtx.Ops)
+	p.applyButton.Events(gtx.Metric, gtx.Ops, gtx.Queue, nil, nil, func() {
+		gtx.PushEvent(context.SetScript{Src: p.editor.Text()})
+	})
+	stack.Pop()
+	if p.err != nil {
+		errOff := op.Offset(image.Pt(0, dims.Size.Y+gtx.Dp(4))).Push(gtx.Ops)
+		l := material.Label(th, unit.Sp(12), p.err.Error())
+		l.Color = color.NRGBA{R: 230, G: 90, B: 90, A: 255}
+		l.MaxLines = 2
+		l.Layout(gtx.Context)
+		errOff.Pop()
+	}
+	footerOff.Pop()
+	off.Pop()
+}
+
+// SetScript compiles src and makes its functions callable from formulas,
+// then re-evaluates every formula, as a change which can be undone. An
+// empty src removes the script.
+func (c *Canvas) SetScript(src string) error {
+	var p *script.Program
+	if src != "" {
+		var err error
+		if p, err = script.Compile(src, script.DefaultLimits); err != nil {
+			return err
+		}
+	}
+	ch := scriptChange{before: c.script, after: p}
+	ch.redo(c)
+	c.history.push(ch)
+	return nil
+}
+
+// scriptChange replaces the script attached to the document.
+type scriptChange struct {
+	before, after *script.Program
+}
+
+func (ch scriptChange) undo(c *Canvas) { c.setScript(ch.before) }
+func (ch scriptChange) redo(c *Canvas) { c.setScript(ch.after) }
+
+// setScript attaches p to the document, showing its source in the script
+// panel, and re-evaluates every formula.
+func (c *Canvas) setScript(p *script.Program) {
+	c.script = p
+	c.scriptPanel.SetSource(c.scriptSource())
+	c.rebuildGraph()
+}
+
+func (c *Canvas) scriptSource() string {
+	if c.script == nil {
+		return ""
+	}
+	return c.script.Source()
+}
@@ -0,0 +1,369 @@
+package widgets
+
+import (
+	stdcontext "context"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/tauraamui/nebula/context"
+	"github.com/tauraamui/nebula/formula"
+	"github.com/tauraamui/nebula/script"
+	"github.com/tauraamui/nebula/solve"
+)
+
+// trial evaluates the canvas with trial values for some of its cells. It
+// works on a snapshot, leaving the canvas itself untouched.
+type trial struct {
+	matrices map[string]*Matrix[float64]
+	script   *script.Program
+	inputs   []formula.CellID
+	order    []formula.CellID
+	last     []float64
+}
+
+// newTrial prepares to try values for inputs, which must hold plain
+// values, re-evaluating the formulas which depend on them.
+func (c *Canvas) newTrial(inputs []formula.CellID) (*trial, error) {
+	t := &trial{matrices: c.snapshot(), script: c.script, inputs: inputs}
+	changed := append([]formula.CellID{}, inputs...)
+	for _, id := range inputs {
+		m := t.matrices[id.Matrix]
+		pos := image.Pt(id.Col, id.Row)
+		if _, ok := m.formulas[pos]; ok {
+			return nil, fmt.Errorf("%s holds a formula, inputs must hold values", cellID(id))
+		}
+		changed = append(changed, formula.WholeMatrix(id.Matrix))
+	}
+	order, cyclic := c.graph.Affected(changed...)
+	if len(cyclic) > 0 {
+		return nil, formula.ErrCycle
+	}
+	t.order = order
+	return t, nil
+}
+
+// set stores x in the inputs and re-evaluates the formulas depending on
+// them.
+func (t *trial) set(x []float64) {
+	if t.last != nil && equal(t.last, x) {
+		return
+	}
+	t.last = append(t.last[:0], x...)
+	for i, id := range t.inputs {
+		t.matrices[id.Matrix].setNumber(image.Pt(id.Col, id.Row), x[i], nil)
+	}
+	for _, id := range t.order {
+		apply(t.matrices, evaluate(stdcontext.Background(), t.matrices, t.script, id))
+	}
+}
+
+// depends reports whether the cell id is re-evaluated by set.
+func (t *trial) depends(id formula.CellID) bool {
+	for _, o := range t.order {
+		if o == id || o == formula.WholeMatrix(id.Matrix) {
+			return true
+		}
+	}
+	return false
+}
+
+// eval evaluates n as a formula of the matrix called owner.
+func (t *trial) eval(n formula.Node, owner string) (float64, error) {
+	env := matrixEnv{matrices: t.matrices, owner: t.matrices[owner], script: t.script}
+	v, err := formula.Eval(n, env)
+	if err != nil {
+		return 0, err
+	}
+	return formula.ToNumber(v)
+}
+
+func (t *trial) value(id formula.CellID) (float64, error) {
+	return t.eval(formula.Ref{Matrix: id.Matrix, Cell: formula.CellRef{Row: id.Row, Col: id.Col}}, id.Matrix)
+}
+
+func (t *trial) start() []float64 {
+	x := make([]float64, len(t.inputs))
+	for i, id := range t.inputs {
+		x[i] = t.matrices[id.Matrix].Data.At(id.Row, id.Col)
+	}
+	return x
+}
+
+func equal(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// goalSeek starts searching for the value of the input cell which makes
+// the target formula cell produce value.
+func (c *Canvas) goalSeek(evt context.GoalSeek) error {
+	targets, err := c.parseCells(evt.Target)
+	if err != nil {
+		return err
+	}
+	inputs, err := c.parseCells(evt.Input)
+	if err != nil {
+		return err
+	}
+	if len(targets) != 1 || len(inputs) != 1 {
+		return errors.New("goal seek takes a single target cell and a single input cell")
+	}
+	want, err := strconv.ParseFloat(strings.TrimSpace(evt.Value), 64)
+	if err != nil {
+		return fmt.Errorf("invalid target value %q", evt.Value)
+	}
+	t, err := c.newTrial(inputs)
+	if err != nil {
+		return err
+	}
+	target := targets[0]
+	if !t.depends(target) {
+		return fmt.Errorf("%s does not depend on %s", cellID(target), cellID(inputs[0]))
+	}
+
+	c.startSolving(inputs, func(ctx stdcontext.Context) ([]float64, error) {
+		x, err := solve.GoalSeek(ctx, func(x float64) (float64, error) {
+			t.set([]float64{x})
+			return t.value(target)
+		}, want, t.start()[0])
+		return []float64{x}, err
+	})
+	return nil
+}
+
+// optimize starts searching for the values of the variable cells which
+// minimise or maximise the objective cell, subject to constraints given
+// one per line as comparisons such as A1+B1 <= 10.
+func (c *Canvas) optimize(evt context.Optimize) error {
+	objectives, err := c.parseCells(evt.Objective)
+	if err != nil {
+		return err
+	}
+	if len(objectives) != 1 {
+		return errors.New("the objective must be a single cell")
+	}
+	objective := objectives[0]
+	inputs, err := c.parseCells(evt.Variables)
+	if err != nil {
+		return err
+	}
+	t, err := c.newTrial(inputs)
+	if err != nil {
+		return err
+	}
+	if !t.depends(objective) {
+		return fmt.Errorf("%s does not depend on the variable cells", cellID(objective))
+	}
+
+	sign := 1.0
+	if evt.Maximise {
+		sign = -1
+	}
+	problem := solve.Problem{Objective: func(x []float64) float64 {
+		t.set(x)
+		v, err := t.value(objective)
+		if err != nil {
+			return math.Inf(1)
+		}
+		return sign * v
+	}}
+	for _, line := range strings.Split(evt.Constraints, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		con, err := t.constraint(line, objective.Matrix)
+		if err != nil {
+			return err
+		}
+		problem.Constraints = append(problem.Constraints, con)
+	}
+
+	c.startSolving(inputs, func(ctx stdcontext.Context) ([]float64, error) {
+		return solve.Minimize(ctx, problem, t.start())
+	})
+	return nil
+}
+
+// constraint parses a comparison between two formulas of the matrix
+// called owner.
+func (t *trial) constraint(src, owner string) (solve.Constraint, error) {
+	n, err := formula.Parse(src)
+	if err != nil {
+		return solve.Constraint{}, err
+	}
+	cmp, ok := n.(formula.Binary)
+	if !ok || (cmp.Op != "<=" && cmp.Op != ">=" && cmp.Op != "<" && cmp.Op != ">" && cmp.Op != "=") {
+		return solve.Constraint{}, fmt.Errorf("constraint %q must compare with <=, >= or =", src)
+	}
+	lhs, rhs := cmp.X, cmp.Y
+	if cmp.Op == ">=" || cmp.Op == ">" {
+		lhs, rhs = rhs, lhs
+	}
+	return solve.Constraint{
+		Equality: cmp.Op == "=",
+		F: func(x []float64) float64 {
+			t.set(x)
+			a, err := t.eval(lhs, owner)
+			if err != nil {
+				return math.Inf(1)
+			}
+			b, err := t.eval(rhs, owner)
+			if err != nil {
+				return math.Inf(1)
+			}
+			return a - b
+		},
+	}, nil
+}
+
+// solveRun is a search by the solver running in the background.
+type solveRun struct {
+	cancel stdcontext.CancelFunc
+}
+
+// startSolving runs find in the background, replacing any search already
+// running. The values it finds for inputs are written back by
+// applySolution.
+func (c *Canvas) startSolving(inputs []formula.CellID, find func(ctx stdcontext.Context) ([]float64, error)) {
+	c.stopSolving()
+	ctx, cancel := stdcontext.WithCancel(stdcontext.Background())
+	run := &solveRun{cancel: cancel}
+	c.solving = run
+	c.solverPanel.SetStatus("solving…", nil)
+	go func() {
+		x, err := find(ctx)
+		c.post(func() {
+			if run != c.solving {
+				return
+			}
+			c.solving = nil
+			cancel()
+			c.applySolution(inputs, x, err)
+		})
+	}()
+}
+
+// stopSolving cancels the search running, if any, so that what it finds
+// is never written back.
+func (c *Canvas) stopSolving() {
+	if c.solving != nil {
+		c.solving.cancel()
+		c.solving = nil
+		c.solverPanel.SetStatus("stopped", nil)
+	}
+}
+
+// applySolution writes back the values x found for inputs as a single
+// change which can be undone. Nothing is written if an input no longer
+// holds a plain value.
+func (c *Canvas) applySolution(inputs []formula.CellID, x []float64, err error) {
+	if err != nil {
+		c.solverPanel.SetStatus("", err)
+		return
+	}
+	ch := valuesChange{}
+	found := []string{}
+	for i, id := range inputs {
+		m := c.matrixByName(id.Matrix)
+		if m == nil {
+			c.solverPanel.SetStatus("", fmt.Errorf("%s no longer exists", cellID(id)))
+			return
+		}
+		pos := image.Pt(id.Col, id.Row)
+		if rows, cols := m.Data.Dims(); id.Row >= rows || id.Col >= cols {
+			c.solverPanel.SetStatus("", fmt.Errorf("%s no longer exists", cellID(id)))
+			return
+		}
+		if _, ok := m.formulas[pos]; ok || m.expr != nil {
+			c.solverPanel.SetStatus("", fmt.Errorf("%s no longer holds a value", cellID(id)))
+			return
+		}
+		before := cellValue{m: m, pos: pos, value: m.Data.At(id.Row, id.Col)}
+		if u, ok := m.cellUnits[pos]; ok {
+			before.unit = &u
+		}
+		after := before
+		after.value = x[i]
+		ch.before = append(ch.before, before)
+		ch.after = append(ch.after, after)
+		found = append(found, fmt.Sprintf("%s = %g", cellID(id), x[i]))
+	}
+	ch.redo(c)
+	c.history.push(ch)
+	c.solverPanel.SetStatus("solved: "+strings.Join(found, ", "), nil)
+}
+
+// parseCells parses a comma separated list of cells and ranges. Cells
+// without a matrix name belong to the matrix with selected cells.
+func (c *Canvas) parseCells(src string) ([]formula.CellID, error) {
+	ids := []formula.CellID{}
+	for _, part := range strings.Split(src, ",") {
+		n, err := formula.Parse(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		var name string
+		var from, to formula.CellRef
+		switch n := n.(type) {
+		case formula.Ref:
+			name, from, to = n.Matrix, n.Cell, n.Cell
+		case formula.Range:
+			name, from, to = n.Matrix, n.From, n.To
+		default:
+			return nil, fmt.Errorf("%q is not a cell or range", part)
+		}
+		m, err := c.cellsMatrix(name)
+		if err != nil {
+			return nil, err
+		}
+		if to.Row < from.Row {
+			from.Row, to.Row = to.Row, from.Row
+		}
+		if to.Col < from.Col {
+			from.Col, to.Col = to.Col, from.Col
+		}
+		rows, cols := m.Data.Dims()
+		for r := from.Row; r <= to.Row; r++ {
+			for col := from.Col; col <= to.Col; col++ {
+				if r >= rows || col >= cols {
+					return nil, formula.RefError("%s!%s is outside the matrix", m.Name, formula.CellRef{Row: r, Col: col})
+				}
+				ids = append(ids, formula.CellID{Matrix: m.Name, Row: r, Col: col})
+			}
+		}
+	}
+	return ids, nil
+}
+
+func (c *Canvas) cellsMatrix(name string) (*Matrix[float64], error) {
+	if name != "" {
+		if m := c.matrixByName(name); m != nil {
+			return m, nil
+		}
+		return nil, formula.RefError("unknown matrix %q", name)
+	}
+	for _, m := range c.matrices {
+		if len(m.SelectedCells) > 0 {
+			return m, nil
+		}
+	}
+	if len(c.matrices) == 1 {
+		return c.matrices[0], nil
+	}
+	return nil, errors.New("name the matrix of each cell, as in matrix1!A1")
+}
+
+func cellID(id formula.CellID) string {
+	return id.Matrix + "!" + formula.CellRef{Row: id.Row, Col: id.Col}.String()
+}
@@ -0,0 +1,187 @@
+package widgets
+
+import (
+	"image"
+	"image/color"
+
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"github.com/tauraamui/nebula/context"
+	"github.com/tauraamui/nebula/gesturex"
+)
+
+const solverPanelWidth unit.Dp = 320
+
+// SolverMode selects what the solver panel searches for.
+type SolverMode int
+
+const (
+	// GoalSeekMode finds the input value giving a target cell a value.
+	GoalSeekMode SolverMode = iota
+	// MinimiseMode finds the variable values giving a cell its least
+	// value within the constraints.
+	MinimiseMode
+	// MaximiseMode finds the variable values giving a cell its greatest
+	// value within the constraints.
+	MaximiseMode
+)
+
+func (m SolverMode) String() string {
+	switch m {
+	case MinimiseMode:
+		return "minimise"
+	case MaximiseMode:
+		return "maximise"
+	}
+	return "goal seek"
+}
+
+// SolverPanel asks which cells to solve for and shows the outcome.
+type SolverPanel struct {
+	Visible bool
+	Mode    SolverMode
+	target,
+	value,
+	inputs,
+	constraints *widget.Editor
+	modeButton,
+	solveButton *gesturex.ButtonEvents
+	status string
+	err    error
+}
+
+// Toggle shows or hides the panel.
+func (p *SolverPanel) Toggle() {
+	p.Visible = !p.Visible
+}
+
+// Focused reports whether one of the panel's fields has the keyboard
+// focus.
+func (p *SolverPanel) Focused() bool {
+	return p.Visible && p.target != nil && anyFocused(p.target, p.value, p.inputs, p.constraints)
+}
+
+// SetStatus shows progress of the last search, or err if it failed.
+func (p *SolverPanel) SetStatus(status string, err error) {
+	p.status, p.err = status, err
+}
+
+// Layout draws the panel along the left edge of the window, returning
+// the width used.
+func (p *SolverPanel) Layout(gtx *context.Context, th *material.Theme, size image.Point) int {
+	if !p.Visible {
+		return 0
+	}
+	if p.target == nil {
+		p.target = &widget.Editor{SingleLine: true}
+		p.value = &widget.Editor{SingleLine: true}
+		p.inputs = &widget.Editor{SingleLine: true}
+		p.constraints = &widget.Editor{}
+		p.modeButton = &gesturex.ButtonEvents{Tag: &p.Mode}
+		p.solveButton = &gesturex.ButtonEvents{Tag: p}
+	}
+
+	width := gtx.Dp(solverPanelWidth)
+	padding := gtx.Dp(8)
+	bgnd := clip.Rect{Max: image.Pt(width, size.Y)}.Push(gtx.Ops)
+	paint.ColorOp{Color: color.NRGBA{R: 32, G: 32, B: 36, A: 245}}.Add(gtx.Ops)
+	paint.PaintOp{}.Add(gtx.Ops)
+	bgnd.Pop()
+
+	y := padding
+	y += layoutButton(gtx, th, p.modeButton, image.Pt(padding, y), "mode: "+p.Mode.String(), func() {
+		p.Mode = (p.Mode + 1) % (MaximiseMode + 1)
+	})
+	fieldWidth := width - 2*padding
+	if p.Mode == GoalSeekMode {
+		y += layoutField(gtx, th, image.Pt(padding, y), fieldWidth, "set cell", p.target, "matrix1!C1", 0)
+		y += layoutField(gtx, th, image.Pt(padding, y), fieldWidth, "to value", p.value, "100", 0)
+		y += layoutField(gtx, th, image.Pt(padding, y), fieldWidth, "by changing", p.inputs, "matrix1!A1", 0)
+	} else {
+		y += layoutField(gtx, th, image.Pt(padding, y), fieldWidth, "objective cell", p.target, "matrix1!C1", 0)
+		y += layoutField(gtx, th, image.Pt(padding, y), fieldWidth, "by changing", p.inputs, "matrix1!A1:B1", 0)
+		y += layoutField(gtx, th, image.Pt(padding, y), fieldWidth, "subject to, one per line", p.constraints, "matrix1!A1 >= 0", gtx.Dp(120))
+	}
+
+	y += layoutButton(gtx, th, p.solveButton, image.Pt(padding, y), "solve", func() {
+		if p.Mode == GoalSeekMode {
+			gtx.PushEvent(context.GoalSeek{Target: p.target.Text(), Value: p.value.Text(), Input: p.inputs.Text()})
+			return
+		}
+		gtx.PushEvent(context.Optimize{
+			Objective:   p.target.Text(),
+			Maximise:    p.Mode == MaximiseMode,
+			Variables:   p.inputs.Text(),
+			Constraints: p.constraints.Text(),
+		})
+	})
+
+	status, statusColor := p.status, color.NRGBA{R: 160, G: 160, B: 160, A: 255}
+	if p.err != nil {
+		status, statusColor = p.err.Error(), color.NRGBA{R: 230, G: 90, B: 90, A: 255}
+	}
+	off := op.Offset(image.Pt(padding, y)).Push(gtx.Ops)
+	sgtx := gtx.Context
+	sgtx.Constraints = layout.Exact(image.Pt(fieldWidth, gtx.Dp(60)))
+	l := material.Label(th, unit.Sp(12), status)
+	l.Color = statusColor
+	l.Layout(sgtx)
+	off.Pop()
+	return width
+}
+
+// layoutButton draws a clickable label at pos, returning the height used.
+func layoutButton(gtx *context.Context, th *material.Theme, btn *gesturex.ButtonEvents, pos image.Point, label string, clicked func()) int {
+	off := op.Offset(pos).Push(gtx.Ops)
+	l := material.Label(th, unit.Sp(13), label)
+	l.Color = color.NRGBA{R: 120, G: 170, B: 240, A: 255}
+	dims := l.Layout(gtx.Context)
+	stack := clip.Rect{Max: dims.Size}.Push(gtx.Ops)
+	btn.Add(gtx.Ops)
+	btn.Events(gtx.Metric, gtx.Ops, gtx.Queue, nil, nil, clicked)
+	stack.Pop()
+	off.Pop()
+	return dims.Size.Y + gtx.Dp(10)
+}
+
+// layoutField draws a labelled editor at pos, returning the height used.
+// A height of zero fits a single line.
+func layoutField(gtx *context.Context, th *material.Theme, pos image.Point, width int, label string, editor *widget.Editor, hint string, height int) int {
+	if height == 0 {
+		height = gtx.Dp(20)
+	}
+	off := op.Offset(pos).Push(gtx.Ops)
+	l := material.Label(th, unit.Sp(11), label)
+	l.Color = color.NRGBA{R: 140, G: 140, B: 140, A: 255}
+	dims := l.Layout(gtx.Context)
+
+	edOff := op.Offset(image.Pt(0, dims.Size.Y+gtx.Dp(2))).Push(gtx.Ops)
+	field := clip.Rect{Max: image.Pt(width, height)}.Push(gtx.Ops)
+	paint.ColorOp{Color: color.NRGBA{R: 48, G: 48, B: 54, A: 255}}.Add(gtx.Ops)
+	paint.PaintOp{}.Add(gtx.Ops)
+	field.Pop()
+	egtx := gtx.Context
+	egtx.Constraints = layout.Exact(image.Pt(width, height))
+	ed := material.Editor(th, editor, hint)
+	ed.TextSize = unit.Sp(13)
+	ed.Color = color.NRGBA{R: 220, G: 220, B: 220, A: 255}
+	ed.HintColor = color.NRGBA{R: 100, G: 100, B: 100, A: 255}
+	ed.Layout(egtx)
+	edOff.Pop()
+	off.Pop()
+	return dims.Size.Y + height + gtx.Dp(10)
+}
+
+func anyFocused(editors ...*widget.Editor) bool {
+	for _, e := range editors {
+		if e.Focused() {
+			return true
+		}
+	}
+	return false
+}
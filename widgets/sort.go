@@ -0,0 +1,254 @@
+package widgets
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"sort"
+	"strings"
+
+	"gioui.org/widget/material"
+	"github.com/tauraamui/nebula/context"
+	"github.com/tauraamui/nebula/formula"
+)
+
+// SortKey is a column rows are sorted by.
+type SortKey struct {
+	Col        int
+	Descending bool
+}
+
+// SortRows sorts the rows from up to to by the columns of keys, the
+// first deciding first. Empty cells and errors come last either way, and
+// rows which compare equal keep their order. A row's cells move with it
+// along with its height, label and formats, its formulas' relative
+// references moving by as many rows.
+func (m *Matrix[T]) SortRows(from, to int, keys ...SortKey) {
+	rows, cols := m.Data.Dims()
+	if from < 0 {
+		from = 0
+	}
+	if to > rows {
+		to = rows
+	}
+	if to-from < 2 || len(keys) == 0 {
+		return
+	}
+	// spills are evaluated again from wherever their formulas end up
+	for anchor := range m.spills {
+		m.clearSpill(anchor, nil)
+	}
+	m.spills = nil
+
+	blank := func(pos image.Point) bool {
+		_, failed := m.errs[pos]
+		return failed || m.empty(pos)
+	}
+	order := make([]int, to-from)
+	for i := range order {
+		order[i] = from + i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		for _, k := range keys {
+			a, b := image.Pt(k.Col, order[i]), image.Pt(k.Col, order[j])
+			if ab, bb := blank(a), blank(b); ab || bb {
+				if ab != bb {
+					return bb
+				}
+				continue
+			}
+			av, bv := m.Data.At(a.Y, a.X), m.Data.At(b.Y, b.X)
+			if av == bv {
+				continue
+			}
+			return (av < bv) != k.Descending
+		}
+		return false
+	})
+	m.errs = nil
+	m.permuteRows(from, order, cols)
+}
+
+// permuteRows moves row order[i] to row from+i.
+func (m *Matrix[T]) permuteRows(from int, order []int, cols int) {
+	contents := make([]cellContent, len(order)*cols)
+	for i, y := range order {
+		for x := 0; x < cols; x++ {
+			contents[i*cols+x] = m.content(image.Pt(x, y))
+		}
+	}
+	moved := map[int]int{}
+	for i, y := range order {
+		moved[y] = from + i
+	}
+	move := func(y int) (int, bool) {
+		if to, ok := moved[y]; ok {
+			return to, true
+		}
+		return y, true
+	}
+	for i, y := range order {
+		for x := 0; x < cols; x++ {
+			c := contents[i*cols+x]
+			if c.formula != "" {
+				c.formula = moveFormula(c.formula, image.Pt(0, from+i-y))
+			}
+			m.setContent(image.Pt(x, from+i), c)
+		}
+	}
+
+	formats := m.formats()
+	for pos := range formats.cells {
+		delete(m.cellFormats, pos)
+	}
+	for pos, f := range formats.cells {
+		pos.Y, _ = move(pos.Y)
+		m.cellFormats[pos] = f
+	}
+	m.rowHeights = shiftIndexed(m.rowHeights, move)
+	m.rowLabels = shiftIndexed(m.rowLabels, move)
+	m.hidden = shiftIndexed(m.hidden, move)
+	m.styles = permuteStyles(m.styles, from, from+len(order), moved)
+	m.cachedOps = nil
+}
+
+// permuteStyles returns styles with the rows from up to to moved as
+// moved says. Ranges across those rows are split into a range for each
+// row, those of neighbouring rows joined again once moved.
+func permuteStyles(styles []styledRange, from, to int, moved map[int]int) []styledRange {
+	var permuted []styledRange
+	for _, r := range styles {
+		rows := image.Rect(r.Area.Min.X, from, r.Area.Max.X, to)
+		cut := r.Area.Intersect(rows)
+		if cut.Empty() {
+			permuted = append(permuted, r)
+			continue
+		}
+		for _, rest := range subtract(r.Area, rows) {
+			permuted = append(permuted, styledRange{Area: rest, Style: r.Style})
+		}
+		var split []styledRange
+		for y := cut.Min.Y; y < cut.Max.Y; y++ {
+			ny := moved[y]
+			split = append(split, styledRange{Area: image.Rect(cut.Min.X, ny, cut.Max.X, ny+1), Style: r.Style})
+		}
+		sort.Slice(split, func(i, j int) bool { return split[i].Area.Min.Y < split[j].Area.Min.Y })
+		for _, s := range split {
+			if n := len(permuted); n > 0 && permuted[n-1].Style == s.Style &&
+				permuted[n-1].Area.Max.Y == s.Area.Min.Y &&
+				permuted[n-1].Area.Min.X == s.Area.Min.X && permuted[n-1].Area.Max.X == s.Area.Max.X {
+				permuted[n-1].Area.Max.Y = s.Area.Max.Y
+				continue
+			}
+			permuted = append(permuted, s)
+		}
+	}
+	return permuted
+}
+
+// column returns the column named by spec, its letter or its label.
+func (m *Matrix[T]) column(spec string) (int, bool) {
+	_, cols := m.Data.Dims()
+	if ref, ok := formula.ParseCellRef(spec + "1"); ok && !ref.AbsCol && !strings.Contains(spec, "$") && ref.Col < cols {
+		return ref.Col, true
+	}
+	if h, ok := m.findLabel(spec); ok && !h.row {
+		return h.index, true
+	}
+	return 0, false
+}
+
+// parseSortKeys parses the columns typed into the sort prompt, such as
+// "B desc, A" or "Revenue descending".
+func (m *Matrix[T]) parseSortKeys(s string) ([]SortKey, error) {
+	var keys []SortKey
+	for _, part := range strings.Split(s, ",") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, fmt.Errorf("%q is not a column to sort by", strings.TrimSpace(part))
+		}
+		col, ok := m.column(fields[0])
+		if !ok {
+			return nil, fmt.Errorf("no column %q", fields[0])
+		}
+		k := SortKey{Col: col}
+		if len(fields) == 2 {
+			switch strings.ToLower(fields[1]) {
+			case "asc", "ascending":
+			case "desc", "descending":
+				k.Descending = true
+			default:
+				return nil, fmt.Errorf("sort %s ascending or descending, not %q", fields[0], fields[1])
+			}
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// sortRows sorts rows of a matrix, as a change which can be undone.
+func (c *Canvas) sortRows(evt context.SortRows) error {
+	m := c.matrixByName(evt.Matrix)
+	if m == nil {
+		return fmt.Errorf("no matrix named %q", evt.Matrix)
+	}
+	keys, err := m.parseSortKeys(evt.By)
+	if err != nil {
+		return err
+	}
+	before := c.structure(m)
+	m.SortRows(evt.From, evt.To, keys...)
+	if m.filter != nil {
+		m.applyFilter()
+	}
+	c.rebuildGraph()
+	c.history.push(structureChange{before: before, after: c.structure(m)})
+	return nil
+}
+
+// sortSpan returns the rows the selection spans, or every row if it
+// spans just one.
+func (m *Matrix[T]) sortSpan() (int, int, bool) {
+	area, ok := m.selectionBounds()
+	if !ok {
+		return 0, 0, false
+	}
+	if area.Dy() < 2 {
+		rows, _ := m.Data.Dims()
+		return 0, rows, true
+	}
+	return area.Min.Y, area.Max.Y, true
+}
+
+// openSort opens the prompt for the columns to sort by, starting with
+// the column of the cell typed into.
+func (m *Matrix[T]) openSort() {
+	cell, ok := m.selectedCellPos()
+	if !ok {
+		return
+	}
+	name := m.headerName(header{index: cell.X})
+	if strings.ContainsAny(name, " ,") {
+		name = formula.ColumnName(cell.X)
+	}
+	m.sorting.open(name)
+}
+
+// layoutSort lays out the sort prompt, asking for the rows the selection
+// spans to be sorted once the columns to sort by are submitted.
+func (m *Matrix[T]) layoutSort(gtx *context.Context, th *material.Theme) {
+	m.layoutPrompt(gtx, th, &m.sorting, "sort", "A, B desc", func(text string) error {
+		if strings.TrimSpace(text) == "" {
+			return errors.New("name the columns to sort by")
+		}
+		if _, err := m.parseSortKeys(text); err != nil {
+			return err
+		}
+		from, to, ok := m.sortSpan()
+		if !ok {
+			return errors.New("no cells are selected")
+		}
+		gtx.PushEvent(context.SortRows{Matrix: m.Name, From: from, To: to, By: text})
+		return nil
+	})
+}
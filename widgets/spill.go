@@ -0,0 +1,297 @@
+package widgets
+
+import (
+	"errors"
+	"fmt"
+	"image"
+
+	"github.com/tauraamui/nebula/decimal"
+	"github.com/tauraamui/nebula/formula"
+	nmat "github.com/tauraamui/nebula/mat"
+	"gonum.org/v1/gonum/mat"
+)
+
+// spill is the area covered by the array result of the formula at its
+// top left cell. A blocked spill is one which could not be written
+// because a cell in its area was not empty.
+type spill struct {
+	area    image.Rectangle
+	blocked bool
+}
+
+// maxSpillCells is the most cells a spill may grow a matrix to, so that
+// a result such as SEQUENCE(1000000) cannot make it too big to show.
+const maxSpillCells = 10000
+
+// errSpillSize is the error of a spill which would grow its matrix
+// beyond maxSpillCells.
+var errSpillSize = formula.Error{Code: formula.CodeSpill, Cause: fmt.Errorf("result would grow the matrix beyond %d cells", maxSpillCells)}
+
+// errSpillCycle is the error of a formula which reads the cells its own
+// result spills into.
+var errSpillCycle = formula.Error{Code: formula.CodeCycle, Cause: errors.New("result would spill into cells it reads")}
+
+// spillArea returns the cells covered by arr written from pos.
+func spillArea(pos image.Point, arr *formula.Array) image.Rectangle {
+	return image.Rect(pos.X, pos.Y, pos.X+arr.Cols, pos.Y+arr.Rows)
+}
+
+// readsSpill reports whether n, the formula at pos of the matrix called
+// owner, reads any cell other than pos in area.
+func readsSpill(n formula.Node, owner string, pos image.Point, area image.Rectangle) bool {
+	reads := false
+	formula.Rewrite(n, func(n formula.Node) formula.Node {
+		var r image.Rectangle
+		switch n := n.(type) {
+		case formula.Ref:
+			if n.Matrix != "" && n.Matrix != owner {
+				return n
+			}
+			r = image.Rect(n.Cell.Col, n.Cell.Row, n.Cell.Col+1, n.Cell.Row+1)
+		case formula.Range:
+			if n.Matrix != "" && n.Matrix != owner {
+				return n
+			}
+			r = image.Rect(n.From.Col, n.From.Row, n.To.Col, n.To.Row).Canon()
+			r.Max = r.Max.Add(image.Pt(1, 1))
+		default:
+			return n
+		}
+		if r = r.Intersect(area); !r.Empty() && r != image.Rect(pos.X, pos.Y, pos.X+1, pos.Y+1) {
+			reads = true
+		}
+		return n
+	})
+	return reads
+}
+
+// setSpill writes arr into the cells right of and below pos, growing the
+// matrix where it is too small. If any of those cells is not empty the
+// cells are left alone and ErrSpill is returned. A cell is empty when it
+// holds zero without a formula, unit or error, or was written by pos's
+// previous result. A spill which would grow the matrix beyond
+// maxSpillCells is not written either.
+func (m *Matrix[T]) setSpill(pos image.Point, arr *formula.Array) error {
+	area := spillArea(pos, arr)
+	rows, cols := m.Data.Dims()
+	if area.Max.Y > rows || area.Max.X > cols {
+		if area.Max.Y > rows {
+			rows = area.Max.Y
+		}
+		if area.Max.X > cols {
+			cols = area.Max.X
+		}
+		if rows*cols > maxSpillCells {
+			return errSpillSize
+		}
+	}
+	if m.spills == nil {
+		m.spills = map[image.Point]spill{}
+	}
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			if cell := image.Pt(x, y); cell != pos && !m.empty(cell) {
+				m.spills[pos] = spill{area: area, blocked: true}
+				return formula.ErrSpill
+			}
+		}
+	}
+
+	m.grow(area.Max.Y, area.Max.X)
+	m.spills[pos] = spill{area: area}
+	for i := 0; i < arr.Rows; i++ {
+		for j := 0; j < arr.Cols; j++ {
+			cell := pos.Add(image.Pt(j, i))
+			if cell == pos {
+				continue
+			}
+			m.setResult(cell, arr.At(i, j), nil)
+			m.markSpilled(cell)
+		}
+	}
+	return nil
+}
+
+// clearSpill empties the cells written by the result of the formula at
+// pos, other than those in keep.
+func (m *Matrix[T]) clearSpill(pos image.Point, keep map[image.Point]struct{}) {
+	s, ok := m.spills[pos]
+	if !ok {
+		return
+	}
+	delete(m.spills, pos)
+	if s.blocked {
+		return
+	}
+	rows, cols := m.Data.Dims()
+	area := s.area.Intersect(image.Rect(0, 0, cols, rows))
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			cell := image.Pt(x, y)
+			if _, ok := keep[cell]; ok || cell == pos {
+				continue
+			}
+			delete(m.errs, cell)
+			delete(m.cellUnits, cell)
+			m.setNumber(cell, 0, nil)
+			m.markSpilled(cell)
+		}
+	}
+}
+
+// spillAt returns the top left cell of the spill covering pos, if any.
+func (m *Matrix[T]) spillAt(pos image.Point) (image.Point, bool) {
+	for anchor, s := range m.spills {
+		if anchor != pos && pos.In(s.area) {
+			return anchor, true
+		}
+	}
+	return image.Point{}, false
+}
+
+// spilledInto reports whether the cell at pos holds part of the result
+// of an array formula in another cell.
+func (m *Matrix[T]) spilledInto(pos image.Point) bool {
+	anchor, ok := m.spillAt(pos)
+	return ok && !m.spills[anchor].blocked
+}
+
+func (m *Matrix[T]) empty(pos image.Point) bool {
+	rows, cols := m.Data.Dims()
+	if pos.X >= cols || pos.Y >= rows {
+		return true
+	}
+	if _, ok := m.formulas[pos]; ok {
+		return false
+	}
+	if _, ok := m.cellUnits[pos]; ok {
+		return false
+	}
+	if _, ok := m.errs[pos]; ok {
+		return false
+	}
+	if m.spilledInto(pos) {
+		return false
+	}
+	return m.Data.At(pos.Y, pos.X) == 0
+}
+
+// markSpilled records that the value of the cell at pos was changed by a
+// spill, so that formulas reading it can be re-evaluated.
+func (m *Matrix[T]) markSpilled(pos image.Point) {
+	if m.spilled == nil {
+		m.spilled = map[image.Point]struct{}{}
+	}
+	m.spilled[pos] = struct{}{}
+}
+
+// grow enlarges the matrix to at least rows by cols, keeping its values.
+func (m *Matrix[T]) grow(rows, cols int) {
+	r, c := m.Data.Dims()
+	if rows <= r && cols <= c {
+		return
+	}
+	if rows < r {
+		rows = r
+	}
+	if cols < c {
+		cols = c
+	}
+	m.resize(rows, cols)
+}
+
+// resize makes the matrix rows by cols, keeping the values of the cells
+// in both the old and new size. Whatever the cells cut off held is
+// dropped, the canvas's graph must be rebuilt when formulas are.
+func (m *Matrix[T]) resize(rows, cols int) {
+	r, c := m.Data.Dims()
+	keep := image.Rect(0, 0, cols, rows)
+	data := mat.NewDense(rows, cols, nil)
+	kr, kc := rows, cols
+	if r < kr {
+		kr = r
+	}
+	if c < kc {
+		kc = c
+	}
+	data.Slice(0, kr, 0, kc).(*mat.Dense).Copy(m.Data.Slice(0, kr, 0, kc))
+	m.Data = data
+	if m.decimals != nil {
+		decimals := nmat.New[decimal.Decimal](rows, cols, nil).(nmat.Mutable[decimal.Decimal])
+		for i := 0; i < rows; i++ {
+			for j := 0; j < cols; j++ {
+				if i < r && j < c {
+					decimals.Set(i, j, m.decimals.At(i, j))
+					continue
+				}
+				decimals.Set(i, j, decimal.New(0, 0))
+			}
+		}
+		m.decimals = decimals
+	}
+	for pos := range m.formulas {
+		if !pos.In(keep) {
+			delete(m.formulas, pos)
+		}
+	}
+	for pos := range m.cellUnits {
+		if !pos.In(keep) {
+			delete(m.cellUnits, pos)
+		}
+	}
+	for pos := range m.errs {
+		if !pos.In(keep) {
+			delete(m.errs, pos)
+		}
+	}
+	for pos := range m.spills {
+		if !pos.In(keep) {
+			delete(m.spills, pos)
+		}
+	}
+	for x := range m.colWidths {
+		if x >= cols {
+			delete(m.colWidths, x)
+		}
+	}
+	for y := range m.rowHeights {
+		if y >= rows {
+			delete(m.rowHeights, y)
+		}
+	}
+	for x := range m.colLabels {
+		if x >= cols {
+			delete(m.colLabels, x)
+		}
+	}
+	for y := range m.rowLabels {
+		if y >= rows {
+			delete(m.rowLabels, y)
+		}
+	}
+	for y := range m.hidden {
+		if y >= rows {
+			delete(m.hidden, y)
+		}
+	}
+	for x := range m.colFormats {
+		if x >= cols {
+			delete(m.colFormats, x)
+		}
+	}
+	for pos := range m.cellFormats {
+		if !pos.In(keep) {
+			delete(m.cellFormats, pos)
+		}
+	}
+	m.styles = clipStyles(m.styles, rows, cols)
+	cells := m.SelectedCells[:0]
+	for _, pos := range m.SelectedCells {
+		if pos.In(keep) {
+			cells = append(cells, pos)
+		}
+	}
+	m.SelectedCells = cells
+	m.cursor = clampCell(m.cursor, rows, cols)
+	m.cachedOps = nil
+}
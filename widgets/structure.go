@@ -0,0 +1,321 @@
+package widgets
+
+import (
+	"fmt"
+	"image"
+
+	"gioui.org/io/key"
+	"github.com/tauraamui/nebula/context"
+	"github.com/tauraamui/nebula/decimal"
+	"github.com/tauraamui/nebula/formula"
+	nmat "github.com/tauraamui/nebula/mat"
+	"github.com/tauraamui/nebula/numfmt"
+	"github.com/tauraamui/nebula/units"
+	"gonum.org/v1/gonum/mat"
+)
+
+// shiftedCell returns where the cell at pos ends up once s is applied,
+// reporting false if it was deleted.
+func shiftedCell(pos image.Point, s formula.Shift) (image.Point, bool) {
+	if s.Rows {
+		y, ok := s.Index(pos.Y)
+		return image.Pt(pos.X, y), ok
+	}
+	x, ok := s.Index(pos.X)
+	return image.Pt(x, pos.Y), ok
+}
+
+// shift inserts or deletes the rows or columns s describes, moving the
+// cells after them along. Formulas keep their references as they are,
+// the canvas adjusts them across every matrix.
+func (m *Matrix[T]) shift(s formula.Shift) {
+	// spilled values would otherwise be left behind as plain values
+	for anchor := range m.spills {
+		m.clearSpill(anchor, nil)
+	}
+	m.spills = nil
+	m.spilled = nil
+	m.pending = nil
+	m.errs = nil
+
+	rows, cols := m.Data.Dims()
+	newRows, newCols := rows, cols
+	if s.Rows {
+		newRows += s.Count
+	} else {
+		newCols += s.Count
+	}
+
+	data := mat.NewDense(newRows, newCols, nil)
+	var decimals nmat.Mutable[decimal.Decimal]
+	if m.decimals != nil {
+		decimals = nmat.New[decimal.Decimal](newRows, newCols, nil).(nmat.Mutable[decimal.Decimal])
+		for i := 0; i < newRows; i++ {
+			for j := 0; j < newCols; j++ {
+				decimals.Set(i, j, decimal.New(0, 0))
+			}
+		}
+	}
+	for i := 0; i < rows; i++ {
+		for j := 0; j < cols; j++ {
+			to, ok := shiftedCell(image.Pt(j, i), s)
+			if !ok {
+				continue
+			}
+			data.Set(to.Y, to.X, m.Data.At(i, j))
+			if decimals != nil {
+				decimals.Set(to.Y, to.X, m.decimals.At(i, j))
+			}
+		}
+	}
+	m.Data = data
+	m.decimals = decimals
+
+	formulas := map[image.Point]formula.Node{}
+	for pos, n := range m.formulas {
+		if to, ok := shiftedCell(pos, s); ok {
+			formulas[to] = n
+		}
+	}
+	m.formulas = formulas
+	cellUnits := map[image.Point]units.Unit{}
+	for pos, u := range m.cellUnits {
+		if to, ok := shiftedCell(pos, s); ok {
+			cellUnits[to] = u
+		}
+	}
+	m.cellUnits = cellUnits
+	cellFormats := map[image.Point]numfmt.Format{}
+	for pos, f := range m.cellFormats {
+		if to, ok := shiftedCell(pos, s); ok {
+			cellFormats[to] = f
+		}
+	}
+	m.cellFormats = cellFormats
+	m.styles = shiftStyles(m.styles, s)
+	if s.Rows {
+		m.rowHeights = shiftIndexed(m.rowHeights, s.Index)
+		m.rowLabels = shiftIndexed(m.rowLabels, s.Index)
+		m.hidden = shiftIndexed(m.hidden, s.Index)
+	} else {
+		m.colWidths = shiftIndexed(m.colWidths, s.Index)
+		m.colFormats = shiftIndexed(m.colFormats, s.Index)
+		m.colLabels = shiftIndexed(m.colLabels, s.Index)
+	}
+
+	selected := []image.Point{}
+	for _, pos := range m.SelectedCells {
+		if to, ok := shiftedCell(pos, s); ok {
+			selected = append(selected, to)
+		}
+	}
+	if len(selected) == 0 {
+		selected = []image.Point{clampCell(image.Pt(s.At, s.At), newRows, newCols)}
+		if s.Rows {
+			selected[0].X = 0
+		} else {
+			selected[0].Y = 0
+		}
+	}
+	m.SelectedCells = selected
+	m.cursor = selected[len(selected)-1]
+	m.cachedOps = nil
+}
+
+// structure is what inserting or deleting rows or columns, or renaming or
+// redefining a matrix, changes: the matrix's cells, name, expression and
+// numeric mode, and the formulas and scenarios referencing it.
+type structure struct {
+	m         *Matrix[float64]
+	cells     *Matrix[float64]
+	formulas  map[*Matrix[float64]]map[image.Point]formula.Node
+	scenarios []Scenario
+}
+
+func (c *Canvas) structure(m *Matrix[float64]) structure {
+	st := structure{m: m, cells: m.clone(), formulas: map[*Matrix[float64]]map[image.Point]formula.Node{}}
+	st.cells.SelectedCells = append([]image.Point(nil), m.SelectedCells...)
+	for _, other := range c.matrices {
+		formulas := make(map[image.Point]formula.Node, len(other.formulas))
+		for pos, n := range other.formulas {
+			formulas[pos] = n
+		}
+		st.formulas[other] = formulas
+	}
+	st.scenarios = copyScenarios(c.scenarios)
+	return st
+}
+
+func (c *Canvas) restoreStructure(st structure) {
+	m, from := st.m, st.cells.clone()
+	m.Name, m.expr, m.exprErr = from.Name, from.expr, from.exprErr
+	m.Mode, m.Precision = from.Mode, from.Precision
+	m.Data = from.Data
+	m.decimals = from.decimals
+	m.cellUnits = from.cellUnits
+	m.colWidths, m.rowHeights = from.colWidths, from.rowHeights
+	m.setFormats(from.formats())
+	m.styles = from.styles
+	m.colLabels, m.rowLabels = from.colLabels, from.rowLabels
+	m.filter, m.hidden = from.filter, from.hidden
+	m.spills, m.spilled, m.pending = from.spills, nil, nil
+	m.SelectedCells = append([]image.Point(nil), st.cells.SelectedCells...)
+	if len(m.SelectedCells) > 0 {
+		m.cursor = m.SelectedCells[len(m.SelectedCells)-1]
+	}
+	m.cachedOps = nil
+	for other, formulas := range st.formulas {
+		other.formulas = make(map[image.Point]formula.Node, len(formulas))
+		for pos, n := range formulas {
+			other.formulas[pos] = n
+		}
+	}
+	c.scenarios = copyScenarios(st.scenarios)
+	c.rebuildGraph()
+}
+
+func copyScenarios(scenarios []Scenario) []Scenario {
+	copies := make([]Scenario, 0, len(scenarios))
+	for _, s := range scenarios {
+		values := make(map[formula.CellID]float64, len(s.Values))
+		for id, v := range s.Values {
+			values[id] = v
+		}
+		copies = append(copies, Scenario{Name: s.Name, Values: values})
+	}
+	return copies
+}
+
+// structureChange inserts or deletes rows or columns, or renames or
+// redefines a matrix.
+type structureChange struct {
+	before, after structure
+}
+
+func (ch structureChange) undo(c *Canvas) { c.restoreStructure(ch.before) }
+func (ch structureChange) redo(c *Canvas) { c.restoreStructure(ch.after) }
+
+// shiftCells inserts or deletes rows or columns of a matrix, adjusting
+// every formula and scenario referencing the cells moved, as a change
+// which can be undone.
+func (c *Canvas) shiftCells(evt context.ShiftCells) error {
+	m := c.matrixByName(evt.Matrix)
+	if m == nil {
+		return fmt.Errorf("no matrix named %q", evt.Matrix)
+	}
+	rows, cols := m.Data.Dims()
+	size := cols
+	if evt.Rows {
+		size = rows
+	}
+	if evt.At < 0 || evt.At > size || evt.Count == 0 {
+		return fmt.Errorf("nothing to insert or delete")
+	}
+	if evt.Count < 0 && (evt.At-evt.Count > size || -evt.Count >= size) {
+		return fmt.Errorf("cannot delete every row or column of %s", m.Name)
+	}
+
+	s := formula.Shift{Matrix: m.Name, Rows: evt.Rows, At: evt.At, Count: evt.Count}
+	before := c.structure(m)
+	m.shift(s)
+	for _, other := range c.matrices {
+		for pos, n := range other.formulas {
+			other.formulas[pos] = formula.ShiftRefs(n, other.Name, s)
+		}
+	}
+	for i, sc := range c.scenarios {
+		values := map[formula.CellID]float64{}
+		for id, v := range sc.Values {
+			if id.Matrix == m.Name {
+				pos, ok := shiftedCell(image.Pt(id.Col, id.Row), s)
+				if !ok {
+					continue
+				}
+				id.Row, id.Col = pos.Y, pos.X
+			}
+			values[id] = v
+		}
+		c.scenarios[i].Values = values
+	}
+	c.rebuildGraph()
+	c.history.push(structureChange{before: before, after: c.structure(m)})
+	return nil
+}
+
+// resizeMatrix makes a matrix rows by cols, as a change which can be
+// undone. New cells are empty and those cut off are discarded.
+func (c *Canvas) resizeMatrix(evt context.ResizeMatrix) error {
+	m := c.matrixByName(evt.Matrix)
+	if m == nil {
+		return fmt.Errorf("no matrix named %q", evt.Matrix)
+	}
+	if evt.Rows < 1 || evt.Cols < 1 {
+		return fmt.Errorf("a matrix needs at least one cell")
+	}
+	if len(m.SelectedCells) == 0 {
+		m.selectCell(m.cursor)
+	}
+	before := c.structure(m)
+	m.resize(evt.Rows, evt.Cols)
+	if len(m.SelectedCells) == 0 {
+		m.selectCell(m.cursor)
+	}
+	c.rebuildGraph()
+	c.history.push(structureChange{before: before, after: c.structure(m)})
+	return nil
+}
+
+// setNumericMode switches how a matrix stores its values, as a change
+// which can be undone. Values rounded when switching to DecimalMode are
+// restored by undoing it.
+func (c *Canvas) setNumericMode(evt context.SetNumericMode) error {
+	m := c.matrixByName(evt.Matrix)
+	if m == nil {
+		return fmt.Errorf("no matrix named %q", evt.Matrix)
+	}
+	mode := FloatMode
+	if evt.Decimal {
+		mode = DecimalMode
+	}
+	before := c.structure(m)
+	m.SetNumericMode(mode, evt.Precision)
+	c.history.push(structureChange{before: before, after: c.structure(m)})
+	return nil
+}
+
+// insertBeside asks for as many rows or columns as the selection spans to
+// be inserted on the side of it the arrow key name points to.
+func (m *Matrix[T]) insertBeside(gtx *context.Context, name string) {
+	area, ok := m.selectionBounds()
+	if !ok {
+		return
+	}
+	evt := context.ShiftCells{Matrix: m.Name}
+	switch name {
+	case key.NameUpArrow:
+		evt.Rows, evt.At, evt.Count = true, area.Min.Y, area.Dy()
+	case key.NameDownArrow:
+		evt.Rows, evt.At, evt.Count = true, area.Max.Y, area.Dy()
+	case key.NameLeftArrow:
+		evt.At, evt.Count = area.Min.X, area.Dx()
+	case key.NameRightArrow:
+		evt.At, evt.Count = area.Max.X, area.Dx()
+	default:
+		return
+	}
+	gtx.PushEvent(evt)
+}
+
+// deleteSelected asks for the rows, or columns, the selection spans to be
+// deleted.
+func (m *Matrix[T]) deleteSelected(gtx *context.Context, rows bool) {
+	area, ok := m.selectionBounds()
+	if !ok {
+		return
+	}
+	if rows {
+		gtx.PushEvent(context.ShiftCells{Matrix: m.Name, Rows: true, At: area.Min.Y, Count: -area.Dy()})
+		return
+	}
+	gtx.PushEvent(context.ShiftCells{Matrix: m.Name, At: area.Min.X, Count: -area.Dx()})
+}
@@ -0,0 +1,386 @@
+package widgets
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"gioui.org/widget/material"
+	"github.com/tauraamui/nebula/context"
+	"github.com/tauraamui/nebula/formula"
+)
+
+// Styles are kept as a list of rectangular ranges of cells, each setting
+// some attributes of a style, rather than a style per cell. A cell's
+// style is that of the ranges covering it applied in order, so a later
+// range overrides what an earlier one set.
+
+// colour is a colour written as #rrggbb, or #rrggbbaa if translucent.
+type colour color.NRGBA
+
+var namedColours = map[string]colour{
+	"black":  {A: 255},
+	"white":  {R: 255, G: 255, B: 255, A: 255},
+	"grey":   {R: 128, G: 128, B: 128, A: 255},
+	"red":    {R: 220, G: 50, B: 47, A: 255},
+	"orange": {R: 245, G: 150, B: 40, A: 255},
+	"yellow": {R: 255, G: 230, B: 110, A: 255},
+	"green":  {R: 90, G: 170, B: 80, A: 255},
+	"blue":   {R: 60, G: 120, B: 230, A: 255},
+	"purple": {R: 150, G: 90, B: 200, A: 255},
+}
+
+func parseColour(s string) (colour, error) {
+	if c, ok := namedColours[strings.ToLower(s)]; ok {
+		return c, nil
+	}
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 8 || !strings.HasPrefix(s, "#") || err != nil {
+		return colour{}, fmt.Errorf("%q is not a colour", s)
+	}
+	return colour{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
+
+func (c colour) String() string {
+	if c.A == 255 {
+		return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	}
+	return fmt.Sprintf("#%02x%02x%02x%02x", c.R, c.G, c.B, c.A)
+}
+
+func (c colour) MarshalText() ([]byte, error) { return []byte(c.String()), nil }
+
+func (c *colour) UnmarshalText(b []byte) error {
+	v, err := parseColour(string(b))
+	*c = v
+	return err
+}
+
+// border is the outline drawn around each cell of a range.
+type border struct {
+	Width  float32 `json:"width"`
+	Colour colour  `json:"colour"`
+}
+
+// cellStyle holds the attributes a range of cells sets, those left nil
+// being set by earlier ranges or left as they are by default.
+type cellStyle struct {
+	Fill   *colour `json:"fill,omitempty"`
+	Text   *colour `json:"text,omitempty"`
+	Bold   *bool   `json:"bold,omitempty"`
+	Italic *bool   `json:"italic,omitempty"`
+	// Align is left, center or right and VAlign top, middle or bottom.
+	Align  *string `json:"align,omitempty"`
+	VAlign *string `json:"valign,omitempty"`
+	Border *border `json:"border,omitempty"`
+}
+
+// apply returns s with the attributes set by o replacing its own.
+func (s cellStyle) apply(o cellStyle) cellStyle {
+	if o.Fill != nil {
+		s.Fill = o.Fill
+	}
+	if o.Text != nil {
+		s.Text = o.Text
+	}
+	if o.Bold != nil {
+		s.Bold = o.Bold
+	}
+	if o.Italic != nil {
+		s.Italic = o.Italic
+	}
+	if o.Align != nil {
+		s.Align = o.Align
+	}
+	if o.VAlign != nil {
+		s.VAlign = o.VAlign
+	}
+	if o.Border != nil {
+		s.Border = o.Border
+	}
+	return s
+}
+
+// covers reports whether s sets every attribute o sets.
+func (s cellStyle) covers(o cellStyle) bool {
+	return (o.Fill == nil || s.Fill != nil) && (o.Text == nil || s.Text != nil) &&
+		(o.Bold == nil || s.Bold != nil) && (o.Italic == nil || s.Italic != nil) &&
+		(o.Align == nil || s.Align != nil) && (o.VAlign == nil || s.VAlign != nil) &&
+		(o.Border == nil || s.Border != nil)
+}
+
+var errNoStyle = errors.New("nothing to style, try bold, italic, fill #ffee99, text red, align center, valign top, border 1 black or clear")
+
+// parseStyle parses the attributes typed into the style prompt, such as
+// "bold fill #ffee99 align right". clear reports whether the styles of
+// the cells are to be removed first.
+func parseStyle(s string) (style cellStyle, clear bool, err error) {
+	fields := strings.Fields(s)
+	flag := func(v bool) *bool { return &v }
+	word := func(v string) *string { return &v }
+	next := func(i *int) (string, bool) {
+		if *i+1 >= len(fields) {
+			return "", false
+		}
+		*i++
+		return fields[*i], true
+	}
+	for i := 0; i < len(fields); i++ {
+		switch f := strings.ToLower(fields[i]); f {
+		case "clear":
+			clear = true
+		case "bold":
+			style.Bold = flag(true)
+		case "regular":
+			style.Bold = flag(false)
+		case "italic":
+			style.Italic = flag(true)
+		case "upright":
+			style.Italic = flag(false)
+		case "fill", "text":
+			arg, ok := next(&i)
+			if !ok {
+				return cellStyle{}, false, fmt.Errorf("%s needs a colour", f)
+			}
+			c := colour{}
+			if f == "text" || arg != "none" {
+				if c, err = parseColour(arg); err != nil {
+					return cellStyle{}, false, err
+				}
+			}
+			if f == "fill" {
+				style.Fill = &c
+			} else {
+				style.Text = &c
+			}
+		case "align", "valign":
+			arg, _ := next(&i)
+			arg = strings.ToLower(arg)
+			if f == "align" && (arg == "left" || arg == "center" || arg == "right") {
+				style.Align = word(arg)
+			} else if f == "valign" && (arg == "top" || arg == "middle" || arg == "bottom") {
+				style.VAlign = word(arg)
+			} else {
+				return cellStyle{}, false, fmt.Errorf("cannot %s %q", f, arg)
+			}
+		case "border":
+			arg, ok := next(&i)
+			if !ok {
+				return cellStyle{}, false, errors.New("border needs a width, or none")
+			}
+			b := border{Colour: colour{A: 255}}
+			if arg != "none" {
+				w, err := strconv.ParseFloat(arg, 32)
+				if err != nil || w < 0 || w > 8 {
+					return cellStyle{}, false, fmt.Errorf("%q is not a border width", arg)
+				}
+				b.Width = float32(w)
+				if i+1 < len(fields) {
+					if c, err := parseColour(fields[i+1]); err == nil {
+						b.Colour = c
+						i++
+					}
+				}
+			}
+			style.Border = &b
+		default:
+			return cellStyle{}, false, fmt.Errorf("unknown style %q", fields[i])
+		}
+	}
+	if !clear && style == (cellStyle{}) {
+		return cellStyle{}, false, errNoStyle
+	}
+	return style, clear, nil
+}
+
+// styledRange is a range of cells and the attributes it sets.
+type styledRange struct {
+	Area  image.Rectangle
+	Style cellStyle
+}
+
+// style returns the style of the cell at pos.
+func (m *Matrix[T]) style(pos image.Point) cellStyle {
+	var s cellStyle
+	for _, r := range m.styles {
+		if pos.In(r.Area) {
+			s = s.apply(r.Style)
+		}
+	}
+	return s
+}
+
+// setStyle applies style to the cells of area, first removing their
+// styles if clear is set. Earlier ranges which style nothing anymore are
+// dropped, so that restyling cells does not keep adding ranges.
+func (m *Matrix[T]) setStyle(area image.Rectangle, style cellStyle, clear bool) {
+	styles := make([]styledRange, 0, len(m.styles)+1)
+	for _, r := range m.styles {
+		if clear {
+			for _, rest := range subtract(r.Area, area) {
+				styles = append(styles, styledRange{Area: rest, Style: r.Style})
+			}
+			continue
+		}
+		if r.Area.In(area) && style.covers(r.Style) {
+			continue
+		}
+		styles = append(styles, r)
+	}
+	if style != (cellStyle{}) {
+		if n := len(styles); n > 0 && styles[n-1].Area == area {
+			styles[n-1].Style = styles[n-1].Style.apply(style)
+		} else {
+			styles = append(styles, styledRange{Area: area, Style: style})
+		}
+	}
+	m.styles = styles
+}
+
+// subtract returns the parts of r outside area, as up to four rectangles.
+func subtract(r, area image.Rectangle) []image.Rectangle {
+	cut := r.Intersect(area)
+	if cut.Empty() {
+		return []image.Rectangle{r}
+	}
+	var rest []image.Rectangle
+	for _, part := range []image.Rectangle{
+		{Min: r.Min, Max: image.Pt(r.Max.X, cut.Min.Y)},
+		{Min: image.Pt(r.Min.X, cut.Max.Y), Max: r.Max},
+		{Min: image.Pt(r.Min.X, cut.Min.Y), Max: image.Pt(cut.Min.X, cut.Max.Y)},
+		{Min: image.Pt(cut.Max.X, cut.Min.Y), Max: image.Pt(r.Max.X, cut.Max.Y)},
+	} {
+		if !part.Empty() {
+			rest = append(rest, part)
+		}
+	}
+	return rest
+}
+
+// shiftStyles moves and stretches the styled ranges for the rows or
+// columns s inserts or deletes, dropping those wholly deleted.
+func shiftStyles(styles []styledRange, s formula.Shift) []styledRange {
+	shifted := make([]styledRange, 0, len(styles))
+	for _, r := range styles {
+		min, max := r.Area.Min.X, r.Area.Max.X
+		if s.Rows {
+			min, max = r.Area.Min.Y, r.Area.Max.Y
+		}
+		lo, hi := -1, -1
+		for i := min; i < max; i++ {
+			j, ok := s.Index(i)
+			if !ok {
+				continue
+			}
+			if lo < 0 {
+				lo = j
+			}
+			hi = j
+		}
+		if lo < 0 {
+			continue
+		}
+		if s.Rows {
+			r.Area.Min.Y, r.Area.Max.Y = lo, hi+1
+		} else {
+			r.Area.Min.X, r.Area.Max.X = lo, hi+1
+		}
+		shifted = append(shifted, r)
+	}
+	return shifted
+}
+
+// clipStyles returns styles cut down to a matrix rows by cols.
+func clipStyles(styles []styledRange, rows, cols int) []styledRange {
+	clipped := make([]styledRange, 0, len(styles))
+	for _, r := range styles {
+		r.Area = r.Area.Intersect(image.Rect(0, 0, cols, rows))
+		if !r.Area.Empty() {
+			clipped = append(clipped, r)
+		}
+	}
+	return clipped
+}
+
+// styleChange changes the styles of a matrix's cells.
+type styleChange struct {
+	m             *Matrix[float64]
+	before, after []styledRange
+}
+
+func (ch styleChange) undo(*Canvas) { ch.m.styles = append([]styledRange(nil), ch.before...) }
+func (ch styleChange) redo(*Canvas) { ch.m.styles = append([]styledRange(nil), ch.after...) }
+
+// styleCells styles an area of a matrix, as a change which can be undone.
+func (c *Canvas) styleCells(evt context.StyleCells) error {
+	m := c.matrixByName(evt.Matrix)
+	if m == nil {
+		return fmt.Errorf("no matrix named %q", evt.Matrix)
+	}
+	style, clear, err := parseStyle(evt.Style)
+	if err != nil {
+		return err
+	}
+	rows, cols := m.Data.Dims()
+	area := evt.Area.Intersect(image.Rect(0, 0, cols, rows))
+	if area.Empty() {
+		return nil
+	}
+	before := append([]styledRange(nil), m.styles...)
+	m.setStyle(area, style, clear)
+	c.history.push(styleChange{m: m, before: before, after: append([]styledRange(nil), m.styles...)})
+	return nil
+}
+
+// toggleStyle asks for the selection to be made bold, or italic, unless
+// the cell typed into already is, in which case it is made regular.
+func (m *Matrix[T]) toggleStyle(gtx *context.Context, on, off string) {
+	area, ok := m.selectionBounds()
+	cell, _ := m.selectedCellPos()
+	if !ok {
+		return
+	}
+	s := m.style(cell)
+	set := s.Bold
+	if on == "italic" {
+		set = s.Italic
+	}
+	style := on
+	if set != nil && *set {
+		style = off
+	}
+	gtx.PushEvent(context.StyleCells{Matrix: m.Name, Area: area, Style: style})
+}
+
+// openStyle opens the prompt for the style of the selection.
+func (m *Matrix[T]) openStyle() {
+	if _, ok := m.selectionBounds(); ok {
+		m.styling.open("")
+	}
+}
+
+// layoutStyle lays out the style prompt, asking for the style typed to
+// be applied to the selection once it is submitted.
+func (m *Matrix[T]) layoutStyle(gtx *context.Context, th *material.Theme) {
+	m.layoutPrompt(gtx, th, &m.styling, "style", "bold fill yellow", func(text string) error {
+		if _, _, err := parseStyle(text); err != nil {
+			return err
+		}
+		area, ok := m.selectionBounds()
+		if !ok {
+			return errors.New("no cells are selected")
+		}
+		gtx.PushEvent(context.StyleCells{Matrix: m.Name, Area: area, Style: text})
+		return nil
+	})
+}
@@ -0,0 +1,248 @@
+package widgets
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+
+	"gioui.org/f32"
+	"github.com/tauraamui/nebula/context"
+	"github.com/tauraamui/nebula/formula"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Scenario is a named set of values for input cells, such as the best,
+// base or worst case of a model.
+type Scenario struct {
+	Name   string
+	Values map[formula.CellID]float64
+}
+
+// maxTableSize bounds the number of cells in a data table.
+const maxTableSize = 10000
+
+// saveScenario records the current values of the cells in src as the
+// scenario called name, replacing any scenario of that name.
+func (c *Canvas) saveScenario(name, src string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("a scenario needs a name")
+	}
+	ids, err := c.parseCells(src)
+	if err != nil {
+		return err
+	}
+	s := Scenario{Name: name, Values: map[formula.CellID]float64{}}
+	for _, id := range ids {
+		m := c.matrixByName(id.Matrix)
+		if _, ok := m.formulas[image.Pt(id.Col, id.Row)]; ok {
+			return fmt.Errorf("%s holds a formula, scenarios override values", cellID(id))
+		}
+		s.Values[id] = m.Data.At(id.Row, id.Col)
+	}
+	for i, other := range c.scenarios {
+		if other.Name == name {
+			c.scenarios[i] = s
+			c.activeScenario = name
+			return nil
+		}
+	}
+	c.scenarios = append(c.scenarios, s)
+	c.activeScenario = name
+	return nil
+}
+
+// applyScenario stores the values of the scenario called name in their
+// cells, as a change which can be undone.
+func (c *Canvas) applyScenario(name string) error {
+	var s *Scenario
+	for i := range c.scenarios {
+		if c.scenarios[i].Name == name {
+			s = &c.scenarios[i]
+		}
+	}
+	if s == nil {
+		return fmt.Errorf("no scenario named %q", name)
+	}
+
+	ch := valuesChange{}
+	for id, v := range s.Values {
+		m := c.matrixByName(id.Matrix)
+		if m == nil {
+			continue
+		}
+		pos := image.Pt(id.Col, id.Row)
+		if rows, cols := m.Data.Dims(); id.Row >= rows || id.Col >= cols {
+			continue
+		}
+		if _, ok := m.formulas[pos]; ok {
+			continue
+		}
+		before := cellValue{m: m, pos: pos, value: m.Data.At(id.Row, id.Col)}
+		if u, ok := m.cellUnits[pos]; ok {
+			before.unit = &u
+		}
+		after := before
+		after.value = v
+		ch.before = append(ch.before, before)
+		ch.after = append(ch.after, after)
+	}
+	ch.redo(c)
+	c.history.push(ch)
+	c.activeScenario = name
+	return nil
+}
+
+// renameScenarioCells follows the rename of a matrix in every scenario.
+func (c *Canvas) renameScenarioCells(from, to string) {
+	for _, s := range c.scenarios {
+		for id, v := range s.Values {
+			if id.Matrix != from {
+				continue
+			}
+			delete(s.Values, id)
+			id.Matrix = to
+			s.Values[id] = v
+		}
+	}
+}
+
+// dataTable starts evaluating the target cell across values of one or
+// two input cells, creating a new matrix of the results once done. With
+// one input the table has a row per value, holding the value and the
+// result. With two the first values run down the first column, the
+// second values along the first row and the current result sits in the
+// corner.
+func (c *Canvas) dataTable(evt context.DataTable) error {
+	targets, err := c.parseCells(evt.Target)
+	if err != nil {
+		return err
+	}
+	if len(targets) != 1 {
+		return errors.New("the table's formula must be a single cell")
+	}
+	target := targets[0]
+	inputs, err := c.parseCells(evt.Input)
+	if err != nil {
+		return err
+	}
+	values, err := parseSeries(evt.Values)
+	if err != nil {
+		return err
+	}
+	var values2 []float64
+	if strings.TrimSpace(evt.Input2) != "" {
+		input2, err := c.parseCells(evt.Input2)
+		if err != nil {
+			return err
+		}
+		if values2, err = parseSeries(evt.Values2); err != nil {
+			return err
+		}
+		inputs = append(inputs, input2...)
+	}
+	want := 1
+	if values2 != nil {
+		want = 2
+	}
+	if len(inputs) != want {
+		return errors.New("each input must be a single cell")
+	}
+	if (len(values)+1)*(len(values2)+1) > maxTableSize {
+		return fmt.Errorf("tables are limited to %d cells", maxTableSize)
+	}
+	t, err := c.newTrial(inputs)
+	if err != nil {
+		return err
+	}
+	if !t.depends(target) {
+		return fmt.Errorf("%s does not depend on the input cells", cellID(target))
+	}
+	source := c.matrixByName(target.Matrix)
+	pos := source.Pos.Add(f32.Pt(source.grid().size().X+40, 0))
+
+	c.whatIfPanel.SetStatus("evaluating table…", nil)
+	go func() {
+		base := t.start()
+		type result struct {
+			v   formula.Value
+			err error
+		}
+		at := func(x []float64) result {
+			t.set(x)
+			v, err := t.value(target)
+			return result{v, err}
+		}
+
+		var data *mat.Dense
+		results := map[image.Point]result{}
+		if values2 == nil {
+			data = mat.NewDense(len(values), 2, nil)
+			for i, v := range values {
+				data.Set(i, 0, v)
+				results[image.Pt(1, i)] = at([]float64{v})
+			}
+		} else {
+			data = mat.NewDense(len(values)+1, len(values2)+1, nil)
+			results[image.Pt(0, 0)] = at(base)
+			for j, v := range values2 {
+				data.Set(0, j+1, v)
+			}
+			for i, v := range values {
+				data.Set(i+1, 0, v)
+				for j, v2 := range values2 {
+					results[image.Pt(j+1, i+1)] = at([]float64{v, v2})
+				}
+			}
+		}
+
+		c.post(func() {
+			m := newMatrix(c.nextMatrixName(), pos, data)
+			for cell, r := range results {
+				m.setResult(cell, r.v, r.err)
+			}
+			c.addMatrix(m)
+			c.whatIfPanel.SetStatus("created "+m.Name, nil)
+		})
+	}()
+	return nil
+}
+
+// parseSeries parses either a comma separated list of numbers, or a
+// series written start:stop:step which includes stop when reached.
+func parseSeries(src string) ([]float64, error) {
+	src = strings.TrimSpace(src)
+	if parts := strings.Split(src, ":"); len(parts) == 3 {
+		bounds := make([]float64, 3)
+		for i, p := range parts {
+			f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid series %q", src)
+			}
+			bounds[i] = f
+		}
+		start, stop, step := bounds[0], bounds[1], bounds[2]
+		if step == 0 || (stop-start)/step < 0 || (stop-start)/step >= maxTableSize {
+			return nil, fmt.Errorf("invalid series %q", src)
+		}
+		n := int(math.Floor((stop-start)/step+1e-9)) + 1
+		values := make([]float64, n)
+		for i := range values {
+			values[i] = start + float64(i)*step
+		}
+		return values, nil
+	}
+
+	values := []float64{}
+	for _, p := range strings.Split(src, ",") {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q", p)
+		}
+		values = append(values, f)
+	}
+	return values, nil
+}
@@ -0,0 +1,146 @@
+package widgets
+
+import (
+	"image"
+	"image/color"
+
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"github.com/tauraamui/nebula/context"
+	"github.com/tauraamui/nebula/gesturex"
+)
+
+const whatIfPanelWidth unit.Dp = 320
+
+// WhatIfPanel saves and switches between scenarios, and creates data
+// tables.
+type WhatIfPanel struct {
+	Visible bool
+	scenarioName,
+	scenarioCells,
+	target,
+	input,
+	values,
+	input2,
+	values2 *widget.Editor
+	saveButton,
+	tableButton *gesturex.ButtonEvents
+	scenarioButtons map[string]*gesturex.ButtonEvents
+	status          string
+	err             error
+}
+
+// Toggle shows or hides the panel.
+func (p *WhatIfPanel) Toggle() {
+	p.Visible = !p.Visible
+}
+
+// Focused reports whether one of the panel's fields has the keyboard
+// focus.
+func (p *WhatIfPanel) Focused() bool {
+	return p.Visible && p.target != nil && anyFocused(p.scenarioName, p.scenarioCells, p.target, p.input, p.values, p.input2, p.values2)
+}
+
+// SetStatus shows the outcome of the last action, or err if it failed.
+func (p *WhatIfPanel) SetStatus(status string, err error) {
+	p.status, p.err = status, err
+}
+
+// Layout draws the panel with its left edge at x, listing scenarios with
+// the active one highlighted. It returns the width used.
+func (p *WhatIfPanel) Layout(gtx *context.Context, th *material.Theme, x int, size image.Point, scenarios []Scenario, active string) int {
+	if !p.Visible {
+		return 0
+	}
+	if p.scenarioName == nil {
+		p.scenarioName = &widget.Editor{SingleLine: true}
+		p.scenarioCells = &widget.Editor{SingleLine: true}
+		p.target = &widget.Editor{SingleLine: true}
+		p.input = &widget.Editor{SingleLine: true}
+		p.values = &widget.Editor{SingleLine: true}
+		p.input2 = &widget.Editor{SingleLine: true}
+		p.values2 = &widget.Editor{SingleLine: true}
+		p.saveButton = &gesturex.ButtonEvents{Tag: p.scenarioName}
+		p.tableButton = &gesturex.ButtonEvents{Tag: p.target}
+		p.scenarioButtons = map[string]*gesturex.ButtonEvents{}
+	}
+
+	width := gtx.Dp(whatIfPanelWidth)
+	padding := gtx.Dp(8)
+	fieldWidth := width - 2*padding
+	off := op.Offset(image.Pt(x, 0)).Push(gtx.Ops)
+	bgnd := clip.Rect{Max: image.Pt(width, size.Y)}.Push(gtx.Ops)
+	paint.ColorOp{Color: color.NRGBA{R: 36, G: 34, B: 32, A: 245}}.Add(gtx.Ops)
+	paint.PaintOp{}.Add(gtx.Ops)
+	bgnd.Pop()
+
+	y := padding
+	y += layoutHeading(gtx, th, image.Pt(padding, y), "scenarios")
+	for _, s := range scenarios {
+		name := s.Name
+		btn, ok := p.scenarioButtons[name]
+		if !ok {
+			btn = &gesturex.ButtonEvents{}
+			btn.Tag = btn
+			p.scenarioButtons[name] = btn
+		}
+		label := name
+		if name == active {
+			label = "● " + name
+		}
+		y += layoutButton(gtx, th, btn, image.Pt(padding, y), label, func() {
+			gtx.PushEvent(context.ApplyScenario{Name: name})
+		})
+	}
+	y += layoutField(gtx, th, image.Pt(padding, y), fieldWidth, "name", p.scenarioName, "best case", 0)
+	y += layoutField(gtx, th, image.Pt(padding, y), fieldWidth, "input cells", p.scenarioCells, "matrix1!A1:A3", 0)
+	y += layoutButton(gtx, th, p.saveButton, image.Pt(padding, y), "save current values as scenario", func() {
+		gtx.PushEvent(context.SaveScenario{Name: p.scenarioName.Text(), Cells: p.scenarioCells.Text()})
+	})
+
+	y += gtx.Dp(10)
+	y += layoutHeading(gtx, th, image.Pt(padding, y), "data table")
+	y += layoutField(gtx, th, image.Pt(padding, y), fieldWidth, "formula cell", p.target, "matrix1!C1", 0)
+	y += layoutField(gtx, th, image.Pt(padding, y), fieldWidth, "input cell, values down the first column", p.input, "matrix1!A1", 0)
+	y += layoutField(gtx, th, image.Pt(padding, y), fieldWidth, "values, as a list or start:stop:step", p.values, "0:10:1", 0)
+	y += layoutField(gtx, th, image.Pt(padding, y), fieldWidth, "second input cell, values along the first row", p.input2, "optional", 0)
+	y += layoutField(gtx, th, image.Pt(padding, y), fieldWidth, "second values", p.values2, "1, 2, 5", 0)
+	y += layoutButton(gtx, th, p.tableButton, image.Pt(padding, y), "create table", func() {
+		gtx.PushEvent(context.DataTable{
+			Target:  p.target.Text(),
+			Input:   p.input.Text(),
+			Values:  p.values.Text(),
+			Input2:  p.input2.Text(),
+			Values2: p.values2.Text(),
+		})
+	})
+
+	status, statusColor := p.status, color.NRGBA{R: 160, G: 160, B: 160, A: 255}
+	if p.err != nil {
+		status, statusColor = p.err.Error(), color.NRGBA{R: 230, G: 90, B: 90, A: 255}
+	}
+	statusOff := op.Offset(image.Pt(padding, y)).Push(gtx.Ops)
+	sgtx := gtx.Context
+	sgtx.Constraints = layout.Exact(image.Pt(fieldWidth, gtx.Dp(60)))
+	l := material.Label(th, unit.Sp(12), status)
+	l.Color = statusColor
+	l.Layout(sgtx)
+	statusOff.Pop()
+	off.Pop()
+	return width
+}
+
+// layoutHeading draws a section heading at pos, returning the height used.
+func layoutHeading(gtx *context.Context, th *material.Theme, pos image.Point, heading string) int {
+	off := op.Offset(pos).Push(gtx.Ops)
+	l := material.Label(th, unit.Sp(13), heading)
+	l.Color = color.NRGBA{R: 200, G: 200, B: 200, A: 255}
+	dims := l.Layout(gtx.Context)
+	off.Pop()
+	return dims.Size.Y + gtx.Dp(6)
+}
@@ -0,0 +1,30 @@
+package worker
+
+// Pool runs functions on a fixed number of long lived goroutines.
+type Pool struct {
+	tasks chan func()
+}
+
+// NewPool starts a pool of size goroutines.
+func NewPool(size int) *Pool {
+	p := &Pool{tasks: make(chan func(), size)}
+	for i := 0; i < size; i++ {
+		go func() {
+			for fn := range p.tasks {
+				fn()
+			}
+		}()
+	}
+	return p
+}
+
+// Go queues fn to run on the pool, blocking while every goroutine is busy
+// and the queue is full.
+func (p *Pool) Go(fn func()) {
+	p.tasks <- fn
+}
+
+// Close stops the pool's goroutines once queued functions have run.
+func (p *Pool) Close() {
+	close(p.tasks)
+}